@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"comments-system/internal/config"
+	"comments-system/internal/pubsub"
+	"comments-system/internal/service"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/storagetest"
+	"comments-system/internal/tenant"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// BenchmarkGraphQL measures the API end to end: HTTP, gqlgen, resolvers,
+// services and an in-memory storage seeded with each of storagetest.Sizes.
+// Compare runs with benchstat.
+func BenchmarkGraphQL(b *testing.B) {
+	storagetest.EachSize(b, func(b *testing.B, size storagetest.Size) {
+		ctx := context.Background()
+		s := inmemory.NewInMemory()
+		d := storagetest.Seed(b, s, size.Config())
+
+		// Mutations and subscriptions need a post open for comments.
+		post, err := s.GetPost(ctx, d.Busiest)
+		if err != nil {
+			b.Fatal(err)
+		}
+		post.CommentsEnabled = true
+		if err := s.UpdatePost(ctx, post); err != nil {
+			b.Fatal(err)
+		}
+
+		log := slog.New(slog.DiscardHandler)
+		services := &service.Service{
+			PostService:    service.NewPostService(s, log),
+			CommentService: service.NewCommentService(s, log),
+			SearchService:  service.NewSearchService(s, log),
+		}
+		ps := pubsub.NewPubSub()
+		// Without sites configured every request is served the default site,
+		// where the seed data is.
+		sites, err := tenant.New(config.Tenancy{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		srv := httptest.NewServer(queryHandler(services, ps, sites, log))
+		b.Cleanup(srv.Close)
+		c := &client{url: srv.URL, http: srv.Client()}
+
+		query(b, c, "Posts", `query { posts(limit: 20) { id title author commentCount createdAt } }`, nil)
+		query(b, c, "Post", `query($id: ID!) { post(id: $id) { id title content commentCount rootCommentCount } }`,
+			map[string]any{"id": d.Busiest})
+		query(b, c, "Comments", `query($postId: ID!) {
+			comments(postId: $postId, limit: 20) { total comments { id author content createdAt depth } }
+		}`, map[string]any{"postId": d.Busiest})
+		query(b, c, "CommentReplies", `query($id: ID!) { commentReplies(parentId: $id) { id author content depth } }`,
+			map[string]any{"id": d.MostReplied})
+		query(b, c, "CommentThread", `query($id: ID!) { commentThread(commentId: $id) { id parentId depth content } }`,
+			map[string]any{"id": d.Largest})
+		query(b, c, "Search", `query { search(query: "latency", first: 20) { hits { score snippet } hasNextPage } }`, nil)
+
+		query(b, c, "CreatePost", `mutation {
+			createPost(input: {title: "Title", content: "Content", author: "bench", commentsEnabled: true}) { id }
+		}`, nil)
+		query(b, c, "CreateComment", `mutation($postId: ID!) {
+			createComment(input: {postId: $postId, author: "bench", content: "Content"}) { id }
+		}`, map[string]any{"postId": d.Busiest})
+
+		for _, n := range []int{1, 10, 100} {
+			b.Run(fmt.Sprintf("CommentAdded/subscribers=%d", n), func(b *testing.B) {
+				benchCommentAdded(b, c, ps, d.Busiest, n)
+			})
+		}
+	})
+}
+
+// benchCommentAdded measures the time from a createComment request to its
+// delivery to all n commentAdded subscribers of the post.
+func benchCommentAdded(b *testing.B, c *client, ps *pubsub.PubSub, postID string, n int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Subscribers of an earlier run leave once their connections close.
+	waitViewers(b, ps, postID, 0)
+
+	received := make(chan error, n)
+	for i := 0; i < n; i++ {
+		conn := c.subscribe(b, `subscription($postId: ID!) { commentAdded(postId: $postId) { id author content } }`,
+			map[string]any{"postId": postID})
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+		go func() {
+			for {
+				var msg wsMessage
+				if err := conn.ReadJSON(&msg); err != nil {
+					if ctx.Err() == nil {
+						received <- err
+					}
+					return
+				}
+				switch msg.Type {
+				case "next":
+					received <- nil
+				case "error":
+					received <- fmt.Errorf("subscription error: %s", msg.Payload)
+				}
+			}
+		}()
+	}
+
+	waitViewers(b, ps, postID, n)
+
+	mutation := `mutation($postId: ID!) { createComment(input: {postId: $postId, author: "bench", content: "Content"}) { id } }`
+	vars := map[string]any{"postId": postID}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.do(mutation, vars); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < n; j++ {
+			select {
+			case err := <-received:
+				if err != nil {
+					b.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				b.Fatalf("comment %d reached %d of %d subscribers", i, j, n)
+			}
+		}
+	}
+}
+
+// waitViewers waits until the post has exactly n subscribers.
+func waitViewers(b *testing.B, ps *pubsub.PubSub, postID string, n int) {
+	b.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ps.Presence(tenant.DefaultSite, postID).Viewers != n {
+		if time.Now().After(deadline) {
+			b.Fatalf("post has %d subscribers, want %d", ps.Presence(tenant.DefaultSite, postID).Viewers, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// query benchmarks one GraphQL request as a sub-benchmark of b.
+func query(b *testing.B, c *client, name, q string, vars map[string]any) {
+	b.Run(name, func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := c.do(q, vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// client is a bare GraphQL client for the test server.
+type client struct {
+	url  string
+	http *http.Client
+}
+
+type request struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+// do posts a request and fails on transport or GraphQL errors. The data is
+// read in full and discarded.
+func (c *client) do(q string, vars map[string]any) error {
+	body, err := json.Marshal(request{Query: q, Variables: vars})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Data   json.RawMessage   `json:"data"`
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("status %d: %w", resp.StatusCode, err)
+	}
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("graphql error: %s", res.Errors[0])
+	}
+	return nil
+}
+
+// wsMessage is a message of the graphql-transport-ws protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscribe opens a websocket, completes the graphql-transport-ws handshake
+// and starts the subscription q on it.
+func (c *client) subscribe(b *testing.B, q string, vars map[string]any) *websocket.Conn {
+	b.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(c.url, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if err := conn.WriteJSON(wsMessage{Type: "connection_init"}); err != nil {
+		b.Fatal(err)
+	}
+	var ack wsMessage
+	if err := conn.ReadJSON(&ack); err != nil {
+		b.Fatal(err)
+	}
+	if ack.Type != "connection_ack" {
+		b.Fatalf("expected connection_ack, got %s", ack.Type)
+	}
+
+	payload, err := json.Marshal(request{Query: q, Variables: vars})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := conn.WriteJSON(wsMessage{ID: "1", Type: "subscribe", Payload: payload}); err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
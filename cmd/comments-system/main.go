@@ -4,14 +4,20 @@ import (
 	"comments-system/internal/config"
 	"comments-system/internal/graph"
 	"comments-system/internal/graph/generated"
+	"comments-system/internal/models"
 	"comments-system/internal/pubsub"
 	"comments-system/internal/service"
 	"comments-system/internal/storage"
+	"comments-system/internal/storage/cache"
 	"comments-system/internal/storage/inmemory"
 	"comments-system/internal/storage/postgres"
+	"comments-system/internal/storage/sqlite"
+	"comments-system/internal/tenant"
 	"comments-system/pkg/logger/sl"
 	"comments-system/pkg/logger/slogpretty"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -38,53 +44,111 @@ func main() {
 	log := setupLogger(cfg.Env)
 	log.Info("Starting server", "env", cfg.Env, "storage", cfg.Storage)
 
+	sites, err := tenant.New(cfg.Tenancy)
+	if err != nil {
+		log.Error("Invalid tenancy config", sl.Err(err))
+		os.Exit(1)
+	}
+	moderation := models.ModerationMode(cfg.Comments.Moderation)
+	if !moderation.IsValid() {
+		log.Error("Invalid comments config", "moderation", cfg.Comments.Moderation)
+		os.Exit(1)
+	}
+
 	var storage storage.Storage
-	var err error
+	var pg *postgres.Storage
 
 	switch cfg.Storage {
 	case "postgres":
-		storage, err = postgres.NewPostgresDB(cfg.Database)
+		pg, err = postgres.NewPostgresDB(cfg.Database)
 		if err != nil {
 			log.Error("Failed to init postgres", sl.Err(err))
 			os.Exit(1)
 		}
-		log.Info("Using PostgreSQL storage")
+		storage = pg
+		log.Info("Using PostgreSQL storage",
+			"max_open_conns", cfg.Database.MaxOpenConns, "statement_timeout", cfg.Database.StatementTimeout)
+	case "sqlite":
+		storage, err = sqlite.NewSQLiteDB(cfg.SQLite)
+		if err != nil {
+			log.Error("Failed to init sqlite", sl.Err(err))
+			os.Exit(1)
+		}
+		log.Info("Using SQLite storage", "path", cfg.SQLite.Path)
 	case "inmemory":
-		storage = inmemory.NewInMemory()
-		log.Info("Using in-memory storage")
+		if cfg.InMemory.Persistence.Enabled {
+			storage, err = inmemory.NewInMemoryWithPersistence(cfg.InMemory.Persistence)
+			if err != nil {
+				log.Error("Failed to restore in-memory storage", sl.Err(err))
+				os.Exit(1)
+			}
+			log.Info("Using in-memory storage with persistence", "dir", cfg.InMemory.Persistence.Dir)
+		} else {
+			storage = inmemory.NewInMemory()
+			log.Info("Using in-memory storage")
+		}
+	}
+
+	var cached *cache.Storage
+	if cfg.Cache.Enabled {
+		cached = cache.NewCache(storage, cfg.Cache)
+		storage = cached
+		log.Info("Using storage cache", "size", cfg.Cache.Size, "ttl", cfg.Cache.TTL)
 	}
 
-	postService := service.NewPostService(storage, log)
-	commentService := service.NewCommentService(storage, log)
+	serviceOpts := []service.Option{
+		service.WithIdempotencyTTL(cfg.Idempotency.TTL),
+		service.WithMaxReplyDepth(cfg.Comments.MaxDepth),
+		service.WithMaxCommentLength(cfg.Comments.MaxLength),
+		service.WithModeration(moderation),
+	}
+	for _, site := range sites.List() {
+		serviceOpts = append(serviceOpts, service.WithSiteSettings(site.ID, site.Settings))
+	}
+	log.Info("Serving sites", "count", len(sites.List()), "require_site", cfg.Tenancy.RequireSite)
+	postService := service.NewPostService(storage, log, serviceOpts...)
+	commentService := service.NewCommentService(storage, log, serviceOpts...)
 	services := &service.Service{
 		PostService:    postService,
 		CommentService: commentService,
+		SearchService:  service.NewSearchService(storage, log),
 	}
 
 	ps := pubsub.NewPubSub()
 
-	srv := handler.New(generated.NewExecutableSchema(generated.Config{
-		Resolvers: graph.NewResolver(services, ps, log),
-	}))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	srv.AddTransport(transport.POST{})
-	srv.AddTransport(transport.Websocket{
-		KeepAlivePingInterval: 10 * time.Second,
-	})
-	srv.Use(extension.Introspection{})
+	if cached != nil {
+		events, err := ps.SubscribeAll(ctx, "")
+		if err != nil {
+			log.Error("Failed to subscribe cache to comments", sl.Err(err))
+			os.Exit(1)
+		}
+		go cached.Listen(events)
+	}
 
 	router := http.NewServeMux()
 	router.Handle("/", playground.Handler("GraphQL Playground", "/query"))
-	router.Handle("/query", graph.ContentTypeMiddleware(srv))
-
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	router.Handle("/query", queryHandler(services, ps, sites, log))
 
 	server := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
 		Handler: router,
 	}
 
+	// Diagnostics stay off the public router: they are served on their own
+	// listener, which only the host can reach unless configured otherwise.
+	var debugServer *http.Server
+	if pg != nil {
+		debugRouter := http.NewServeMux()
+		debugRouter.Handle("/debug/db", poolStatsHandler(pg, log))
+		debugServer = &http.Server{
+			Addr:    cfg.Server.DebugAddr,
+			Handler: debugRouter,
+		}
+	}
+
 	g, gCtx := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		log.Info("Server listening on", "port", cfg.Server.Port)
@@ -93,6 +157,15 @@ func main() {
 		}
 		return nil
 	})
+	if debugServer != nil {
+		g.Go(func() error {
+			log.Info("Debug server listening on", "addr", cfg.Server.DebugAddr)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				return fmt.Errorf("debug server error: %w", err)
+			}
+			return nil
+		})
+	}
 
 	g.Go(func() error {
 		<-gCtx.Done()
@@ -101,8 +174,26 @@ func main() {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		// Every step runs even if an earlier one fails, so the storage is
+		// always closed.
+		var errs []error
+		if debugServer != nil {
+			if err := debugServer.Shutdown(shutdownCtx); err != nil {
+				errs = append(errs, fmt.Errorf("debug server shutdown failed: %w", err))
+			}
+		}
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			return fmt.Errorf("graceful shutdown failed: %w", err)
+			errs = append(errs, fmt.Errorf("graceful shutdown failed: %w", err))
+		}
+		if cached != nil {
+			stats := cached.Stats()
+			log.Info("Storage cache stats", "hits", stats.Hits, "misses", stats.Misses, "entries", stats.Entries)
+		}
+		if err := storage.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("storage close failed: %w", err))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
 		}
 		log.Info("Server stopped")
 		return nil
@@ -114,6 +205,34 @@ func main() {
 	}
 }
 
+// queryHandler serves the GraphQL API, subscriptions included, to the
+// sites of sites.
+func queryHandler(services *service.Service, ps *pubsub.PubSub, sites *tenant.Sites, log *slog.Logger) http.Handler {
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers: graph.NewResolver(services, ps, log),
+	}))
+
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+	})
+	srv.Use(extension.Introspection{})
+	srv.AroundOperations(graph.RequestScope)
+
+	return graph.ContentTypeMiddleware(graph.SiteMiddleware(sites)(
+		graph.SessionMiddleware(graph.IdempotencyKeyMiddleware(srv))))
+}
+
+// poolStatsHandler reports the connection pools of pg as JSON.
+func poolStatsHandler(pg *postgres.Storage, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(pg.PoolStats()); err != nil {
+			log.Error("Failed to write pool stats", sl.Err(err))
+		}
+	})
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/importers"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/postgres"
+	"comments-system/internal/storage/sqlite"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const usage = `Usage: commentsctl [flags] command [args]
+
+Commands:
+  posts                  list posts, newest first
+  post ID                show a post
+  thread ID              dump the comments of a post, or the thread under a comment, as a tree
+  enable-comments ID     allow new comments on a post
+  disable-comments ID    close a post to new comments
+  hide ID                hide a comment from readers
+  unhide ID              show a hidden comment again
+  delete ID              delete a comment with all its replies (needs -yes)
+  recount                repair the comment counters of all posts
+  purge AUTHOR           delete all posts and comments of an author (needs -yes)
+  export [FILE]          write all posts and comments as NDJSON to FILE or stdout
+  import FILE            load an export into the storage; FILE "-" reads stdin
+  import-disqus FILE     load the comments of a Disqus XML export
+  import-wxr FILE        load the posts and comments of a WordPress WXR export
+
+Commands act on every site unless -site names one; imports into a site put
+all posts there.
+
+Flags:
+`
+
+// options are the flags shared by all commands.
+type options struct {
+	output string
+	site   string
+	author string
+	limit  int
+	offset int
+	yes    bool
+}
+
+// commentsctl operates on the storage directly. Changes it makes bypass the
+// server: caches catch up within their TTL and subscribers are not notified.
+func main() {
+	flags := flag.NewFlagSet("commentsctl", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to config file")
+	var opts options
+	flags.StringVar(&opts.output, "o", "table", "output format: table or json")
+	flags.StringVar(&opts.site, "site", "", "only act on this site")
+	flags.StringVar(&opts.author, "author", "", "only list posts of this author")
+	flags.IntVar(&opts.limit, "limit", 20, "posts to list")
+	flags.IntVar(&opts.offset, "offset", 0, "posts to skip")
+	flags.BoolVar(&opts.yes, "yes", false, "confirm a destructive command")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	// Flags may come before or after the command and its argument.
+	var args []string
+	for rest := os.Args[1:]; ; {
+		_ = flags.Parse(rest)
+		rest = flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		args = append(args, rest[0])
+		rest = rest[1:]
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if opts.output != "table" && opts.output != "json" {
+		slog.Error("Unknown output format", "format", opts.output)
+		os.Exit(2)
+	}
+
+	cfg := config.MustLoadPath(*configPath)
+
+	s, err := openStorage(cfg)
+	if err != nil {
+		slog.Error("Failed to open storage", "error", err)
+		os.Exit(1)
+	}
+
+	err = run(context.Background(), s, os.Stdout, args[0], args[1:], opts)
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		slog.Error("Command failed", "command", args[0], "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, s storage.Storage, w io.Writer, cmd string, args []string, opts options) error {
+	p := printer{w: w, json: opts.output == "json"}
+	if opts.site != "" {
+		ctx = tenant.WithSite(ctx, opts.site)
+	}
+
+	switch cmd {
+	case "posts":
+		if len(args) != 0 {
+			return stderrors.New("posts takes no arguments")
+		}
+		var filter models.PostFilter
+		if opts.author != "" {
+			filter.Author = &opts.author
+		}
+		posts, err := s.GetPosts(ctx, filter, opts.limit, opts.offset)
+		if err != nil {
+			return err
+		}
+		return p.posts(posts)
+
+	case "post":
+		id, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		post, err := s.GetPost(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.post(post)
+
+	case "thread":
+		id, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		threads, err := loadThreads(ctx, s, id)
+		if err != nil {
+			return err
+		}
+		return p.threads(threads)
+
+	case "enable-comments", "disable-comments":
+		id, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		post, err := s.GetPost(ctx, id)
+		if err != nil {
+			return err
+		}
+		post.CommentsEnabled = cmd == "enable-comments"
+		if err := s.UpdatePost(ctx, post); err != nil {
+			return err
+		}
+		post, err = s.GetPost(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.post(post)
+
+	case "hide", "unhide":
+		id, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		if err := s.HideComment(ctx, id, cmd == "hide"); err != nil {
+			return err
+		}
+		comment, err := s.GetComment(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.comment(comment)
+
+	case "delete":
+		id, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		if !opts.yes {
+			return stderrors.New("delete removes the comment with all its replies; pass -yes to confirm")
+		}
+		deleted, err := s.DeleteComment(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.result(map[string]int{"deletedComments": deleted})
+
+	case "recount":
+		if len(args) != 0 {
+			return stderrors.New("recount takes no arguments")
+		}
+		fixed, err := s.RecountComments(ctx)
+		if err != nil {
+			return err
+		}
+		return p.result(map[string]int{"fixedPosts": fixed})
+
+	case "purge":
+		author, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		if !opts.yes {
+			return fmt.Errorf("purge removes every post and comment of %q; pass -yes to confirm", author)
+		}
+		purged, err := s.PurgeAuthor(ctx, author)
+		if err != nil {
+			return err
+		}
+		return p.result(map[string]int{"deletedPosts": purged.Posts, "deletedComments": purged.Comments})
+
+	case "export":
+		if len(args) > 1 {
+			return stderrors.New("export takes at most one argument")
+		}
+		if len(args) == 0 || args[0] == "-" {
+			exported, err := exportDump(ctx, s, w)
+			if err != nil {
+				return err
+			}
+			// stdout holds the dump itself.
+			slog.Info("Exported", "posts", exported.Posts, "comments", exported.Comments)
+			return nil
+		}
+
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		exported, err := exportDump(ctx, s, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		return p.result(map[string]int{"exportedPosts": exported.Posts, "exportedComments": exported.Comments})
+
+	case "import":
+		path, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		r := io.Reader(os.Stdin)
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		imported, err := importDump(ctx, s, r)
+		if err != nil {
+			return fmt.Errorf("import stopped after %d posts and %d comments: %w", imported.Posts, imported.Comments, err)
+		}
+		return p.result(map[string]int{"importedPosts": imported.Posts, "importedComments": imported.Comments})
+
+	case "import-disqus", "import-wxr":
+		path, err := oneArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		parse := importers.ParseDisqus
+		if cmd == "import-wxr" {
+			parse = importers.ParseWXR
+		}
+		res, err := parse(f)
+		if err != nil {
+			return err
+		}
+
+		imported, err := importResult(ctx, s, res)
+		if err != nil {
+			return fmt.Errorf("import stopped after %d posts and %d comments: %w", imported.Posts, imported.Comments, err)
+		}
+		return p.report(map[string]int{
+			"importedPosts":    imported.Posts,
+			"importedComments": imported.Comments,
+			"authors":          res.Authors,
+			"skipped":          len(res.Skipped),
+		}, res.Skipped)
+
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func oneArg(cmd string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s takes exactly one argument", cmd)
+	}
+	return args[0], nil
+}
+
+// loadThreads returns the threads of post id, oldest first, or the single
+// thread under comment id.
+func loadThreads(ctx context.Context, s storage.Storage, id string) ([]*thread, error) {
+	var roots []models.Comment
+	if _, err := s.GetPost(ctx, id); err == nil {
+		if roots, err = rootComments(ctx, s, id); err != nil {
+			return nil, err
+		}
+	} else if stderrors.Is(err, errors.ErrNotFound) {
+		comment, err := s.GetComment(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("no post or comment %q: %w", id, err)
+		}
+		roots = []models.Comment{comment}
+	} else {
+		return nil, err
+	}
+
+	threads := make([]*thread, 0, len(roots))
+	for _, root := range roots {
+		subtree, err := s.GetCommentSubtree(ctx, root.ID, 0)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, buildThread(root, subtree))
+	}
+	return threads, nil
+}
+
+// rootComments returns all root comments of a post, oldest first.
+func rootComments(ctx context.Context, s storage.Storage, postID string) ([]models.Comment, error) {
+	const pageSize = 100
+
+	var roots []models.Comment
+	for offset := 0; ; offset += pageSize {
+		page, err := s.GetCommentsByPost(ctx, postID, models.CommentFilter{}, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, page...)
+		if len(page) < pageSize {
+			break
+		}
+	}
+
+	for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+		roots[i], roots[j] = roots[j], roots[i]
+	}
+	return roots, nil
+}
+
+func openStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.Storage {
+	case "postgres":
+		return postgres.NewPostgresDB(cfg.Database)
+	case "sqlite":
+		return sqlite.NewSQLiteDB(cfg.SQLite)
+	case "inmemory":
+		if !cfg.InMemory.Persistence.Enabled {
+			return nil, fmt.Errorf("in-memory storage without persistence has no data to operate on")
+		}
+		return inmemory.NewInMemoryWithPersistence(cfg.InMemory.Persistence)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"comments-system/internal/models"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	s := inmemory.NewInMemory()
+
+	post, err := s.CreatePost(ctx, models.Post{ID: "p1", Title: "Post", Author: "alice", CommentsEnabled: true})
+	require.NoError(t, err)
+	root, err := s.CreateComment(ctx, models.Comment{ID: "c1", PostID: post.ID, Author: "bob", Content: "root"})
+	require.NoError(t, err)
+	reply, err := s.CreateComment(ctx, models.Comment{ID: "c2", PostID: post.ID, ParentID: &root.ID, Author: "carol", Content: "reply"})
+	require.NoError(t, err)
+	_, err = s.CreateComment(ctx, models.Comment{ID: "c3", PostID: post.ID, ParentID: &reply.ID, Author: "bob", Content: "deep"})
+	require.NoError(t, err)
+
+	exec := func(cmd string, args []string, opts options) (string, error) {
+		var out bytes.Buffer
+		err := run(ctx, s, &out, cmd, args, opts)
+		return out.String(), err
+	}
+
+	t.Run("Thread Table", func(t *testing.T) {
+		out, err := exec("thread", []string{"p1"}, options{output: "table"})
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "c1 "))
+		assert.True(t, strings.HasPrefix(lines[1], "  c2 "))
+		assert.True(t, strings.HasPrefix(lines[2], "    c3 "))
+	})
+
+	t.Run("Thread JSON", func(t *testing.T) {
+		out, err := exec("thread", []string{"c2"}, options{output: "json"})
+		require.NoError(t, err)
+
+		var threads []thread
+		require.NoError(t, json.Unmarshal([]byte(out), &threads))
+		require.Len(t, threads, 1)
+		assert.Equal(t, "c2", threads[0].ID)
+		require.Len(t, threads[0].Replies, 1)
+		assert.Equal(t, "c3", threads[0].Replies[0].ID)
+	})
+
+	t.Run("Hide", func(t *testing.T) {
+		out, err := exec("hide", []string{"c2"}, options{output: "table"})
+		require.NoError(t, err)
+		assert.Contains(t, out, "[hidden]")
+	})
+
+	t.Run("Delete Needs Confirmation", func(t *testing.T) {
+		_, err := exec("delete", []string{"c2"}, options{output: "table"})
+		require.Error(t, err)
+
+		_, err = s.GetComment(ctx, "c2")
+		require.NoError(t, err)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		out, err := exec("delete", []string{"c2"}, options{output: "json", yes: true})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"deletedComments": 2}`, out)
+
+		post, err := s.GetPost(ctx, "p1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, post.CommentCount)
+	})
+
+	t.Run("Site", func(t *testing.T) {
+		out, err := exec("posts", nil, options{output: "json", site: "shop", limit: 20})
+		require.NoError(t, err)
+		assert.JSONEq(t, `[]`, out)
+
+		_, err = exec("post", []string{"p1"}, options{output: "table", site: "shop"})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		out, err = exec("post", []string{"p1"}, options{output: "table", site: tenant.DefaultSite})
+		require.NoError(t, err)
+		assert.Contains(t, out, "p1")
+	})
+
+	t.Run("Unknown Command", func(t *testing.T) {
+		_, err := exec("frobnicate", nil, options{output: "table"})
+		require.Error(t, err)
+	})
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := inmemory.NewInMemory()
+
+	for _, id := range []string{"p1", "p2"} {
+		_, err := src.CreatePost(ctx, models.Post{ID: id, Title: "Post " + id, Author: "alice", CommentsEnabled: true})
+		require.NoError(t, err)
+	}
+	root, err := src.CreateComment(ctx, models.Comment{ID: "c1", PostID: "p1", Author: "bob", Content: "root"})
+	require.NoError(t, err)
+	reply, err := src.CreateComment(ctx, models.Comment{ID: "c2", PostID: "p1", ParentID: &root.ID, Author: "carol", Content: "reply"})
+	require.NoError(t, err)
+	_, err = src.CreateComment(ctx, models.Comment{ID: "c3", PostID: "p1", ParentID: &reply.ID, Author: "bob", Content: "deep"})
+	require.NoError(t, err)
+	_, err = src.CreateComment(ctx, models.Comment{ID: "c4", PostID: "p2", Author: "bob", Content: "other"})
+	require.NoError(t, err)
+	require.NoError(t, src.HideComment(ctx, "c2", true))
+
+	var dump bytes.Buffer
+	exported, err := exportDump(ctx, src, &dump)
+	require.NoError(t, err)
+	assert.Equal(t, transferred{Posts: 2, Comments: 4}, exported)
+
+	requireSame := func(t *testing.T, dst *inmemory.Storage) {
+		t.Helper()
+		for _, id := range []string{"p1", "p2"} {
+			want, err := src.GetPost(ctx, id)
+			require.NoError(t, err)
+			got, err := dst.GetPost(ctx, id)
+			require.NoError(t, err)
+			assert.True(t, want.CreatedAt.Equal(got.CreatedAt))
+			got.CreatedAt = want.CreatedAt
+			assert.Equal(t, want, got)
+		}
+		for _, id := range []string{"c1", "c2", "c3", "c4"} {
+			want, err := src.GetComment(ctx, id)
+			require.NoError(t, err)
+			got, err := dst.GetComment(ctx, id)
+			require.NoError(t, err)
+			assert.True(t, want.CreatedAt.Equal(got.CreatedAt))
+			got.CreatedAt = want.CreatedAt
+			assert.Equal(t, want, got)
+		}
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		dst := inmemory.NewInMemory()
+		imported, err := importDump(ctx, dst, bytes.NewReader(dump.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, exported, imported)
+		requireSame(t, dst)
+	})
+
+	t.Run("Replies Before Parents", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+			lines[i], lines[j] = lines[j], lines[i]
+		}
+
+		dst := inmemory.NewInMemory()
+		imported, err := importDump(ctx, dst, strings.NewReader(strings.Join(lines, "\n")))
+		require.NoError(t, err)
+		assert.Equal(t, exported, imported)
+		requireSame(t, dst)
+	})
+
+	t.Run("Missing Parent", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+		var kept []string
+		for _, line := range lines {
+			if !strings.Contains(line, `"id":"c1"`) {
+				kept = append(kept, line)
+			}
+		}
+
+		_, err := importDump(ctx, inmemory.NewInMemory(), strings.NewReader(strings.Join(kept, "\n")))
+		require.ErrorContains(t, err, "2 comments refer to posts or parents missing")
+	})
+
+	t.Run("Existing Data", func(t *testing.T) {
+		imported, err := importDump(ctx, src, bytes.NewReader(dump.Bytes()))
+		require.Error(t, err)
+		assert.Equal(t, transferred{}, imported)
+	})
+}
+
+func TestRun_ImportWXR(t *testing.T) {
+	ctx := context.Background()
+	s := inmemory.NewInMemory()
+
+	path := filepath.Join(t.TempDir(), "export.xml")
+	require.NoError(t, os.WriteFile(path, []byte(`<rss xmlns:wp="http://wordpress.org/export/1.2/"><channel>
+		<item>
+			<title>Post</title>
+			<wp:post_id>1</wp:post_id>
+			<wp:post_date_gmt>2020-01-01 00:00:00</wp:post_date_gmt>
+			<wp:comment_status>open</wp:comment_status>
+			<wp:status>publish</wp:status>
+			<wp:post_type>post</wp:post_type>
+			<wp:comment>
+				<wp:comment_id>1</wp:comment_id>
+				<wp:comment_author>Reader</wp:comment_author>
+				<wp:comment_date_gmt>2020-01-01 01:00:00</wp:comment_date_gmt>
+				<wp:comment_content>Hello</wp:comment_content>
+				<wp:comment_approved>1</wp:comment_approved>
+			</wp:comment>
+			<wp:comment>
+				<wp:comment_id>2</wp:comment_id>
+				<wp:comment_author>Bot</wp:comment_author>
+				<wp:comment_date_gmt>2020-01-01 02:00:00</wp:comment_date_gmt>
+				<wp:comment_content>Spam</wp:comment_content>
+				<wp:comment_approved>spam</wp:comment_approved>
+			</wp:comment>
+		</item>
+	</channel></rss>`), 0o644))
+
+	var out bytes.Buffer
+	require.NoError(t, run(ctx, s, &out, "import-wxr", []string{path}, options{output: "json"}))
+
+	var report struct {
+		Counts  map[string]int
+		Skipped []map[string]string
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, map[string]int{"importedPosts": 1, "importedComments": 1, "authors": 2, "skipped": 1}, report.Counts)
+	assert.Equal(t, []map[string]string{{"kind": "comment", "id": "2", "reason": "spam"}}, report.Skipped)
+
+	posts, err := s.GetPosts(ctx, models.PostFilter{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, 1, posts[0].CommentCount)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"comments-system/internal/importers"
+	"comments-system/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// thread is a comment with its replies nested under it.
+type thread struct {
+	models.Comment
+	Replies []*thread `json:"replies,omitempty"`
+}
+
+// buildThread nests subtree, as returned by GetCommentSubtree, under root.
+func buildThread(root models.Comment, subtree []models.Comment) *thread {
+	top := &thread{Comment: root}
+	byID := map[string]*thread{root.ID: top}
+	for _, c := range subtree {
+		node := &thread{Comment: c}
+		byID[c.ID] = node
+		if parent := byID[*c.ParentID]; parent != nil {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	// Subtrees come in path order; readers expect replies oldest first.
+	for _, node := range byID {
+		sort.SliceStable(node.Replies, func(i, j int) bool {
+			return node.Replies[i].CreatedAt.Before(node.Replies[j].CreatedAt)
+		})
+	}
+	return top
+}
+
+// printer writes results as aligned tables or as indented JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p printer) encode(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p printer) posts(posts []models.Post) error {
+	if p.json {
+		if posts == nil {
+			posts = []models.Post{}
+		}
+		return p.encode(posts)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSITE\tAUTHOR\tCREATED\tCOMMENTS\tOPEN\tTITLE")
+	for _, post := range posts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%t\t%s\n",
+			post.ID, post.SiteID, post.Author, post.CreatedAt.Format(time.DateTime), post.CommentCount, post.CommentsEnabled,
+			truncate(post.Title, 60))
+	}
+	return tw.Flush()
+}
+
+func (p printer) post(post models.Post) error {
+	if p.json {
+		return p.encode(post)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\t%s\n", post.ID)
+	fmt.Fprintf(tw, "Site\t%s\n", post.SiteID)
+	fmt.Fprintf(tw, "Title\t%s\n", post.Title)
+	fmt.Fprintf(tw, "Author\t%s\n", post.Author)
+	fmt.Fprintf(tw, "Created\t%s\n", post.CreatedAt.Format(time.DateTime))
+	fmt.Fprintf(tw, "Version\t%d\n", post.Version)
+	fmt.Fprintf(tw, "Comments enabled\t%t\n", post.CommentsEnabled)
+	fmt.Fprintf(tw, "Comments\t%d (%d root)\n", post.CommentCount, post.RootCommentCount)
+	fmt.Fprintf(tw, "Content\t%s\n", truncate(post.Content, 200))
+	return tw.Flush()
+}
+
+func (p printer) comment(comment models.Comment) error {
+	if p.json {
+		return p.encode(comment)
+	}
+	_, err := fmt.Fprintln(p.w, commentLine(comment))
+	return err
+}
+
+func (p printer) threads(threads []*thread) error {
+	if p.json {
+		if threads == nil {
+			threads = []*thread{}
+		}
+		return p.encode(threads)
+	}
+
+	for _, t := range threads {
+		if err := p.thread(t, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p printer) thread(t *thread, indent string) error {
+	if _, err := fmt.Fprintf(p.w, "%s%s\n", indent, commentLine(t.Comment)); err != nil {
+		return err
+	}
+	for _, reply := range t.Replies {
+		if err := p.thread(reply, indent+"  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p printer) result(counts map[string]int) error {
+	if p.json {
+		return p.encode(counts)
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%d\n", k, counts[k])
+	}
+	return tw.Flush()
+}
+
+// report prints the counts of an import followed by the items it skipped.
+func (p printer) report(counts map[string]int, skipped []importers.Skipped) error {
+	if p.json {
+		if skipped == nil {
+			skipped = []importers.Skipped{}
+		}
+		return p.encode(struct {
+			Counts  map[string]int      `json:"counts"`
+			Skipped []importers.Skipped `json:"skipped"`
+		}{counts, skipped})
+	}
+
+	if err := p.result(counts); err != nil {
+		return err
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nSKIPPED\tID\tREASON")
+	for _, item := range skipped {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", item.Kind, item.ID, item.Reason)
+	}
+	return tw.Flush()
+}
+
+func commentLine(c models.Comment) string {
+	var flags []string
+	if c.Hidden {
+		flags = append(flags, "hidden")
+	}
+	if c.Locked {
+		flags = append(flags, "locked")
+	}
+
+	line := fmt.Sprintf("%s %s %s: %s", c.ID, c.CreatedAt.Format(time.DateTime), c.Author, truncate(c.Content, 80))
+	if len(flags) > 0 {
+		line += " [" + strings.Join(flags, ", ") + "]"
+	}
+	return line
+}
+
+// truncate shortens s to n runes on one line.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
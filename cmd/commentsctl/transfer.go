@@ -0,0 +1,252 @@
+package main
+
+import (
+	"comments-system/internal/importers"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+)
+
+// record is one line of a dump: either a post or a comment. A dump lists
+// every post before its comments and every comment before its replies.
+type record struct {
+	Post    *models.Post    `json:"post,omitempty"`
+	Comment *models.Comment `json:"comment,omitempty"`
+}
+
+// transferred counts the posts and comments an export or import handled.
+type transferred struct {
+	Posts    int
+	Comments int
+}
+
+// postCounts are the comment counters expected for an imported post.
+type postCounts struct {
+	comments int
+	roots    int
+}
+
+// importBatch is how many records go into one transaction on import.
+const importBatch = 500
+
+// exportDump writes all posts, newest first, each followed by its threads,
+// oldest first and depth-first. Writes made while it runs may or may not
+// make it into the dump.
+func exportDump(ctx context.Context, s storage.Storage, w io.Writer) (transferred, error) {
+	const pageSize = 100
+
+	var exported transferred
+	enc := json.NewEncoder(w)
+
+	for offset := 0; ; offset += pageSize {
+		posts, err := s.GetPosts(ctx, models.PostFilter{}, pageSize, offset)
+		if err != nil {
+			return exported, err
+		}
+
+		for _, post := range posts {
+			if err := enc.Encode(record{Post: &post}); err != nil {
+				return exported, err
+			}
+			exported.Posts++
+
+			roots, err := rootComments(ctx, s, post.ID)
+			if err != nil {
+				return exported, err
+			}
+			for _, root := range roots {
+				subtree, err := s.GetCommentSubtree(ctx, root.ID, 0)
+				if err != nil {
+					return exported, err
+				}
+				for _, comment := range append([]models.Comment{root}, subtree...) {
+					if err := enc.Encode(record{Comment: &comment}); err != nil {
+						return exported, err
+					}
+					exported.Comments++
+				}
+			}
+		}
+
+		if len(posts) < pageSize {
+			return exported, nil
+		}
+	}
+}
+
+// importer restores a dump in topological order: records that arrive before
+// their post or parent wait until it has been imported.
+type importer struct {
+	// imported holds the IDs of imported comments.
+	imported map[string]struct{}
+	// counts holds the comments and root comments imported per post.
+	counts map[string]postCounts
+
+	waitingPost   map[string][]models.Comment
+	waitingParent map[string][]models.Comment
+	waiting       int
+}
+
+func newImporter() *importer {
+	return &importer{
+		imported:      make(map[string]struct{}),
+		counts:        make(map[string]postCounts),
+		waitingPost:   make(map[string][]models.Comment),
+		waitingParent: make(map[string][]models.Comment),
+	}
+}
+
+// importDump reads a dump written by exportDump, or any other dump with the
+// same records in any order, into s. See importRecords.
+func importDump(ctx context.Context, s storage.Storage, r io.Reader) (transferred, error) {
+	dec := json.NewDecoder(r)
+	return importRecords(ctx, s, func() (record, error) {
+		var rec record
+		err := dec.Decode(&rec)
+		return rec, err
+	})
+}
+
+// importResult loads what an importer of another system mapped.
+func importResult(ctx context.Context, s storage.Storage, res *importers.Result) (transferred, error) {
+	i := 0
+	return importRecords(ctx, s, func() (record, error) {
+		defer func() { i++ }()
+		switch {
+		case i < len(res.Posts):
+			return record{Post: &res.Posts[i]}, nil
+		case i < len(res.Posts)+len(res.Comments):
+			return record{Comment: &res.Comments[i-len(res.Posts)]}, nil
+		default:
+			return record{}, io.EOF
+		}
+	})
+}
+
+// importRecords imports the records next returns until io.EOF and checks
+// the comment counters of the imported posts afterwards. Nothing imported
+// may exist in s yet.
+//
+// Records are imported in batches, one transaction each; on failure the
+// returned counts cover the batches committed before it. A batch consumes
+// records as it goes and cannot run twice; it never has to, since nothing
+// else uses the storage in this process.
+func importRecords(ctx context.Context, s storage.Storage, next func() (record, error)) (transferred, error) {
+	im := newImporter()
+
+	var committed transferred
+	for n, done := 0, false; !done; {
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			for i := 0; i < importBatch; i++ {
+				rec, err := next()
+				if err == io.EOF {
+					done = true
+					return nil
+				}
+				n++
+				if err != nil {
+					return fmt.Errorf("record %d: %w", n, err)
+				}
+				if err := im.add(ctx, tx, rec); err != nil {
+					return fmt.Errorf("record %d: %w", n, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return committed, err
+		}
+		committed = im.result()
+	}
+
+	if im.waiting > 0 {
+		return committed, fmt.Errorf("%d comments refer to posts or parents missing from the dump", im.waiting)
+	}
+
+	return committed, im.verify(ctx, s)
+}
+
+func (im *importer) add(ctx context.Context, s storage.Storage, rec record) error {
+	switch {
+	case rec.Post != nil && rec.Comment == nil:
+		if err := s.ImportPost(ctx, *rec.Post); err != nil {
+			return fmt.Errorf("post %s: %w", rec.Post.ID, err)
+		}
+		im.counts[rec.Post.ID] = postCounts{}
+
+		waiting := im.waitingPost[rec.Post.ID]
+		delete(im.waitingPost, rec.Post.ID)
+		im.waiting -= len(waiting)
+		return im.addComments(ctx, s, waiting)
+
+	case rec.Comment != nil && rec.Post == nil:
+		return im.addComments(ctx, s, []models.Comment{*rec.Comment})
+
+	default:
+		return stderrors.New("a record must hold either a post or a comment")
+	}
+}
+
+// addComments imports comments along with the replies that were waiting
+// for them, or sets them aside until their post or parent is imported.
+func (im *importer) addComments(ctx context.Context, s storage.Storage, queue []models.Comment) error {
+	for len(queue) > 0 {
+		comment := queue[0]
+		queue = queue[1:]
+
+		if _, ok := im.counts[comment.PostID]; !ok {
+			im.waitingPost[comment.PostID] = append(im.waitingPost[comment.PostID], comment)
+			im.waiting++
+			continue
+		}
+		if comment.ParentID != nil {
+			if _, ok := im.imported[*comment.ParentID]; !ok {
+				im.waitingParent[*comment.ParentID] = append(im.waitingParent[*comment.ParentID], comment)
+				im.waiting++
+				continue
+			}
+		}
+
+		if err := s.ImportComment(ctx, comment); err != nil {
+			return fmt.Errorf("comment %s: %w", comment.ID, err)
+		}
+		im.imported[comment.ID] = struct{}{}
+
+		counts := im.counts[comment.PostID]
+		counts.comments++
+		if comment.ParentID == nil {
+			counts.roots++
+		}
+		im.counts[comment.PostID] = counts
+
+		replies := im.waitingParent[comment.ID]
+		delete(im.waitingParent, comment.ID)
+		im.waiting -= len(replies)
+		queue = append(queue, replies...)
+	}
+	return nil
+}
+
+// verify compares the counters the storage keeps for the imported posts
+// with the comments imported into them.
+func (im *importer) verify(ctx context.Context, s storage.Storage) error {
+	for postID, counts := range im.counts {
+		post, err := s.GetPost(ctx, postID)
+		if err != nil {
+			return fmt.Errorf("verify post %s: %w", postID, err)
+		}
+		if post.CommentCount != counts.comments || post.RootCommentCount != counts.roots {
+			return fmt.Errorf("verify post %s: storage counts %d comments (%d root), imported %d (%d root)",
+				postID, post.CommentCount, post.RootCommentCount, counts.comments, counts.roots)
+		}
+	}
+	return nil
+}
+
+func (im *importer) result() transferred {
+	return transferred{Posts: len(im.counts), Comments: len(im.imported)}
+}
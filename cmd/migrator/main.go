@@ -2,53 +2,244 @@ package main
 
 import (
 	"comments-system/internal/config"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
+const usage = `Usage: migrator [flags] [command]
+
+Commands:
+  up [N]        apply all or the next N migrations (default)
+  down [N]      roll back all or the last N migrations
+  goto V        migrate up or down to version V
+  version       print the current version
+  force V       set the version without running migrations, to clear a dirty state
+  create NAME   scaffold the next numbered up/down pair
+
+Flags:
+`
+
 func main() {
-	cfg := config.MustLoad()
+	flags := flag.NewFlagSet("migrator", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to config file")
+	migrationsPath := flags.String("migrations-path", "", "Path to migrations")
+	dryRun := flags.Bool("dry-run", false, "print the SQL instead of running it")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
 
-	migrationsPath := flag.String("migrations-path", "", "Path to migrations")
-	flag.Parse()
+	// Flags may come before or after the command and its argument.
+	var args []string
+	for rest := os.Args[1:]; ; {
+		_ = flags.Parse(rest)
+		rest = flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		args = append(args, rest[0])
+		rest = rest[1:]
+	}
 
-	if *migrationsPath == "" {
-		*migrationsPath = cfg.Migrations
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
 	}
 
-	if *migrationsPath == "" {
-		slog.Error("Migrations path is required")
+	if err := run(cmd, args, *configPath, *migrationsPath, *dryRun); err != nil {
+		slog.Error("Migration failed", "command", cmd, "error", err)
 		os.Exit(1)
 	}
+}
+
+func run(cmd string, args []string, configPath, migrationsPath string, dryRun bool) error {
+	switch cmd {
+	case "create":
+		if len(args) != 1 {
+			return errors.New("create takes a migration name")
+		}
+		// Scaffolding needs no database, so the config is only read for
+		// the migrations path.
+		if migrationsPath == "" {
+			migrationsPath = config.MustLoadPath(configPath).Migrations
+		}
+		return create(migrationsPath, args[0], dryRun)
+	case "up", "down", "goto", "version", "force":
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
 
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.Database.Username,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.DBName,
-		cfg.Database.SSLMode,
-	)
+	cfg := config.MustLoadPath(configPath)
+	if migrationsPath == "" {
+		migrationsPath = cfg.Migrations
+	}
+	if migrationsPath == "" {
+		return errors.New("migrations path is required")
+	}
 
-	m, err := migrate.New(
-		"file://"+*migrationsPath,
-		dsn,
-	)
+	m, err := migrate.New("file://"+migrationsPath, databaseURL(cfg))
 	if err != nil {
-		slog.Error("Migration initialization failed", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("initialization failed: %w", err)
 	}
+	defer m.Close()
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		slog.Error("Migration failed", "error", err)
-		os.Exit(1)
+	current, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return err
+	}
+
+	if cmd == "version" {
+		if err == migrate.ErrNilVersion {
+			fmt.Println("no migrations applied")
+			return nil
+		}
+		fmt.Printf("%d", current)
+		if dirty {
+			fmt.Print(" (dirty)")
+		}
+		fmt.Println()
+		return nil
+	}
+
+	if cmd == "force" {
+		v, err := versionArg(args)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Printf("-- would force version %d\n", v)
+			return nil
+		}
+		if err := m.Force(int(v)); err != nil {
+			return err
+		}
+		slog.Info("Version forced", "version", v)
+		return nil
+	}
+
+	if dirty {
+		return fmt.Errorf("database is dirty at version %d; fix it by hand and run force", current)
+	}
+
+	n, target, err := stepArgs(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		src, err := source.Open("file://" + migrationsPath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		versions, err := sourceVersions(src)
+		if err != nil {
+			return err
+		}
+		steps, err := plan(versions, current, cmd, n, target)
+		if err != nil {
+			return err
+		}
+		return printPlan(os.Stdout, src, steps)
+	}
+
+	switch {
+	case cmd == "up" && n > 0:
+		err = m.Steps(n)
+	case cmd == "up":
+		err = m.Up()
+	case cmd == "down" && n > 0:
+		err = m.Steps(-n)
+	case cmd == "down":
+		err = m.Down()
+	case cmd == "goto":
+		err = m.Migrate(target)
+	}
+	if err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+
+	version, _, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return err
 	}
+	slog.Info("Migrations applied successfully", "command", cmd, "version", version)
+	return nil
+}
+
+// stepArgs parses the optional N of up and down and the V of goto.
+func stepArgs(cmd string, args []string) (n int, target uint, err error) {
+	if cmd == "goto" {
+		target, err = versionArg(args)
+		return 0, target, err
+	}
+
+	switch len(args) {
+	case 0:
+		return 0, 0, nil
+	case 1:
+		n, err = strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("%s takes a positive number of migrations, got %q", cmd, args[0])
+		}
+		return n, 0, nil
+	default:
+		return 0, 0, fmt.Errorf("%s takes at most one argument", cmd)
+	}
+}
 
-	slog.Info("Migrations applied successfully")
+func versionArg(args []string) (uint, error) {
+	if len(args) != 1 {
+		return 0, errors.New("a version is required")
+	}
+	v, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q", args[0])
+	}
+	return uint(v), nil
+}
+
+func create(dir, name string, dryRun bool) error {
+	paths, err := createMigration(dir, name, dryRun)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func databaseURL(cfg *config.Config) string {
+	switch cfg.Storage {
+	case "sqlite":
+		if dir := filepath.Dir(cfg.SQLite.Path); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				slog.Error("Failed to create data directory", "error", err)
+				os.Exit(1)
+			}
+		}
+		return "sqlite://" + cfg.SQLite.Path
+	default:
+		return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+			cfg.Database.Username,
+			cfg.Database.Password,
+			cfg.Database.Host,
+			cfg.Database.Port,
+			cfg.Database.DBName,
+			cfg.Database.SSLMode,
+		)
+	}
 }
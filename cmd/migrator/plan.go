@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// step is one migration a command runs, in the direction it runs it.
+type step struct {
+	version uint
+	up      bool
+}
+
+// plan lists the steps from current to what cmd asks for, the way migrate
+// would run them. current is 0 when nothing is applied; n <= 0 means all.
+func plan(versions []uint, current uint, cmd string, n int, target uint) ([]step, error) {
+	var steps []step
+	switch cmd {
+	case "up":
+		for _, v := range versions {
+			if v > current && (n <= 0 || len(steps) < n) {
+				steps = append(steps, step{version: v, up: true})
+			}
+		}
+	case "down":
+		for i := len(versions) - 1; i >= 0; i-- {
+			if v := versions[i]; v <= current && (n <= 0 || len(steps) < n) {
+				steps = append(steps, step{version: v})
+			}
+		}
+	case "goto":
+		if !contains(versions, target) {
+			return nil, fmt.Errorf("no migration %d", target)
+		}
+		for _, v := range versions {
+			if v > current && v <= target {
+				steps = append(steps, step{version: v, up: true})
+			}
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			if v := versions[i]; v <= current && v > target {
+				steps = append(steps, step{version: v})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cannot plan %q", cmd)
+	}
+	return steps, nil
+}
+
+func contains(versions []uint, v uint) bool {
+	for _, version := range versions {
+		if version == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceVersions lists the versions in src in ascending order.
+func sourceVersions(src source.Driver) ([]uint, error) {
+	v, err := src.First()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []uint{v}
+	for {
+		v, err = src.Next(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+}
+
+// printPlan writes the SQL of steps to w instead of running it.
+func printPlan(w io.Writer, src source.Driver, steps []step) error {
+	if len(steps) == 0 {
+		_, err := fmt.Fprintln(w, "-- no change")
+		return err
+	}
+
+	for _, s := range steps {
+		read, direction := src.ReadUp, "up"
+		if !s.up {
+			read, direction = src.ReadDown, "down"
+		}
+
+		body, identifier, err := read(s.version)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(w, "-- %d (%s): no migration file\n\n", s.version, direction)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sql, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "-- %d %s (%s)\n%s\n\n", s.version, identifier, direction, sql)
+	}
+	return nil
+}
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// migrationFile matches the NNN_name.up.sql / NNN_name.down.sql layout of
+// the migrations directories.
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+
+// createMigration scaffolds an empty up/down pair numbered after the last
+// migration in dir and returns the paths, writing nothing when dryRun.
+func createMigration(dir, name string, dryRun bool) ([]string, error) {
+	if !migrationName.MatchString(name) {
+		return nil, fmt.Errorf("migration name %q must be lower_snake_case", name)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var last uint
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		if v, err := strconv.ParseUint(m[1], 10, 0); err == nil && uint(v) > last {
+			last = uint(v)
+		}
+	}
+
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("%03d_%s.%s.sql", last+1, name, direction)))
+	}
+
+	if dryRun {
+		return paths, nil
+	}
+	for _, path := range paths {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	versions := []uint{1, 2, 3, 5}
+
+	tests := []struct {
+		name    string
+		current uint
+		cmd     string
+		n       int
+		target  uint
+		want    []step
+	}{
+		{"up all", 0, "up", 0, 0, []step{{1, true}, {2, true}, {3, true}, {5, true}}},
+		{"up n", 2, "up", 1, 0, []step{{3, true}}},
+		{"up at last", 5, "up", 0, 0, nil},
+		{"down n", 5, "down", 2, 0, []step{{5, false}, {3, false}}},
+		{"down all", 2, "down", 0, 0, []step{{2, false}, {1, false}}},
+		{"goto up", 1, "goto", 0, 3, []step{{2, true}, {3, true}}},
+		{"goto down", 5, "goto", 0, 2, []step{{5, false}, {3, false}}},
+		{"goto current", 3, "goto", 0, 3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := plan(versions, tt.current, tt.cmd, tt.n, tt.target)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, steps)
+		})
+	}
+
+	_, err := plan(versions, 0, "goto", 0, 4)
+	assert.Error(t, err)
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"009_old.up.sql", "009_old.down.sql", "010_new.up.sql", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	paths, err := createMigration(dir, "add_likes", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "011_add_likes.up.sql"),
+		filepath.Join(dir, "011_add_likes.down.sql"),
+	}, paths)
+	assert.NoFileExists(t, paths[0])
+
+	paths, err = createMigration(dir, "add_likes", false)
+	require.NoError(t, err)
+	assert.FileExists(t, paths[0])
+	assert.FileExists(t, paths[1])
+
+	_, err = createMigration(dir, "Add-Likes", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/postgres"
+	"comments-system/internal/storage/sqlite"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// recount-comments repairs the denormalized comment counters of posts. It is
+// safe to run against a live SQL database; in-memory storage is recounted
+// on every restore, so there it only matters for a stopped instance.
+func main() {
+	cfg := config.MustLoad()
+
+	s, err := openStorage(cfg)
+	if err != nil {
+		slog.Error("Failed to open storage", "error", err)
+		os.Exit(1)
+	}
+
+	fixed, err := s.RecountComments(context.Background())
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		slog.Error("Recount failed", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Comment counters recounted", "fixed", fixed)
+}
+
+func openStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.Storage {
+	case "postgres":
+		return postgres.NewPostgresDB(cfg.Database)
+	case "sqlite":
+		return sqlite.NewSQLiteDB(cfg.SQLite)
+	case "inmemory":
+		if !cfg.InMemory.Persistence.Enabled {
+			return nil, fmt.Errorf("in-memory storage without persistence has nothing to repair")
+		}
+		return inmemory.NewInMemoryWithPersistence(cfg.InMemory.Persistence)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
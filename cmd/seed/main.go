@@ -0,0 +1,89 @@
+package main
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/seed"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/postgres"
+	"comments-system/internal/storage/sqlite"
+	"comments-system/internal/tenant"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// seed fills the configured storage with a synthetic dataset. The same
+// flags always produce the same posts and comments, IDs included, so a
+// dataset can be loaded only once into a storage.
+func main() {
+	cfg := seed.DefaultConfig()
+
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to config file")
+	flags.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	flags.IntVar(&cfg.Posts, "posts", cfg.Posts, "number of posts")
+	flags.IntVar(&cfg.MaxComments, "max-comments", cfg.MaxComments, "most comments on one post")
+	flags.Float64Var(&cfg.CommentSkew, "comment-skew", cfg.CommentSkew, "power-law exponent of comments per post, > 1; higher means fewer busy posts")
+	flags.Float64Var(&cfg.ReplyRatio, "reply-ratio", cfg.ReplyRatio, "share of comments that are replies")
+	flags.Float64Var(&cfg.DepthDecay, "depth-decay", cfg.DepthDecay, "chance that a reply goes one level deeper")
+	flags.IntVar(&cfg.MaxDepth, "max-depth", cfg.MaxDepth, "deepest reply level")
+	flags.IntVar(&cfg.Authors, "authors", cfg.Authors, "size of the author pool")
+	flags.Float64Var(&cfg.AuthorSkew, "author-skew", cfg.AuthorSkew, "power-law exponent of author activity, > 1")
+	flags.Float64Var(&cfg.ClosedRatio, "closed-ratio", cfg.ClosedRatio, "share of posts with comments disabled")
+	flags.DurationVar(&cfg.Span, "span", cfg.Span, "time the posts are spread over")
+	flags.DurationVar(&cfg.CommentDelay, "comment-delay", cfg.CommentDelay, "mean time before a comment or reply")
+	until := flags.String("until", cfg.Until.Format(time.DateOnly), "date the dataset ends at")
+	site := flags.String("site", tenant.DefaultSite, "site the posts go to")
+	_ = flags.Parse(os.Args[1:])
+
+	var err error
+	if cfg.Until, err = time.Parse(time.DateOnly, *until); err != nil {
+		slog.Error("Invalid -until", "error", err)
+		os.Exit(2)
+	}
+
+	s, err := openStorage(config.MustLoadPath(*configPath))
+	if err != nil {
+		slog.Error("Failed to open storage", "error", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	stats, err := seed.Load(tenant.WithSite(context.Background(), *site), s, cfg)
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		slog.Error("Seeding failed", "posts", stats.Posts, "comments", stats.Comments, "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Storage seeded",
+		"site", *site,
+		"posts", stats.Posts,
+		"comments", stats.Comments,
+		"max_comments", stats.MaxComments,
+		"max_depth", stats.MaxDepth,
+		"elapsed", time.Since(start).Round(time.Millisecond),
+	)
+}
+
+func openStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.Storage {
+	case "postgres":
+		return postgres.NewPostgresDB(cfg.Database)
+	case "sqlite":
+		return sqlite.NewSQLiteDB(cfg.SQLite)
+	case "inmemory":
+		if !cfg.InMemory.Persistence.Enabled {
+			return nil, fmt.Errorf("in-memory storage without persistence would lose the data on exit")
+		}
+		return inmemory.NewInMemoryWithPersistence(cfg.InMemory.Persistence)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
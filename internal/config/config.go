@@ -4,6 +4,7 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"time"
 
 	"comments-system/pkg/logger/sl"
 
@@ -11,15 +12,24 @@ import (
 )
 
 type Config struct {
-	Server     ServerConfig `yaml:"server"`
-	Database   Postgres     `yaml:"postgres"`
-	Storage    string       `yaml:"storage"`
-	Env        string       `yaml:"env" env-default:"local"`
-	Migrations string       `yaml:"migrations" env-default:"./migrations"`
+	Server      ServerConfig `yaml:"server"`
+	Database    Postgres     `yaml:"postgres"`
+	SQLite      SQLite       `yaml:"sqlite"`
+	InMemory    InMemory     `yaml:"inmemory"`
+	Idempotency Idempotency  `yaml:"idempotency"`
+	Comments    Comments     `yaml:"comments"`
+	Cache       Cache        `yaml:"cache"`
+	Tenancy     Tenancy      `yaml:"tenancy"`
+	Storage     string       `yaml:"storage"`
+	Env         string       `yaml:"env" env-default:"local"`
+	Migrations  string       `yaml:"migrations" env-default:"./migrations"`
 }
 
 type ServerConfig struct {
 	Port string `yaml:"port"`
+	// DebugAddr is where diagnostics such as /debug/db are served. It is
+	// kept apart from the public port and bound to localhost by default.
+	DebugAddr string `yaml:"debug_addr" env-default:"127.0.0.1:6060"`
 }
 
 type Postgres struct {
@@ -29,19 +39,121 @@ type Postgres struct {
 	Password string `env:"POSTGRES_PASSWORD"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+	// SearchLanguage is the text search configuration used to index and
+	// query posts and comments. Documents indexed under another language
+	// keep their old stems until they are rewritten.
+	SearchLanguage string `yaml:"search_language" env-default:"english"`
+	// Replicas are DSNs of read-only standbys. Reads made outside a
+	// transaction go round-robin to the replicas that pass health checks;
+	// writes and transactions always use the primary.
+	Replicas             []string      `yaml:"replicas"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env-default:"5s"`
+	// ReadYourWrites sends the reads of a session to the primary for this
+	// long after it writes, covering replication lag. A zero value loads as
+	// the default, so it is turned off with a negative one such as -1s.
+	ReadYourWrites time.Duration `yaml:"read_your_writes" env-default:"5s"`
+	// Pool settings apply to the primary and to every replica. A zero value
+	// loads as the default below; -1 keeps the database/sql default.
+	MaxOpenConns    int           `yaml:"max_open_conns" env-default:"20"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env-default:"10"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env-default:"30m"`
+	// StatementTimeout is set as the Postgres statement_timeout of every
+	// connection, so the server cancels queries running longer; -1s keeps
+	// the timeout configured on the server.
+	StatementTimeout time.Duration `yaml:"statement_timeout" env-default:"10s"`
 }
 
+// Idempotency controls how long client mutation IDs of create mutations
+// are remembered for safe retries.
+type Idempotency struct {
+	TTL time.Duration `yaml:"ttl" env-default:"24h"`
+}
+
+// Comments bound new comments. A zero field is replaced by its default when
+// the config is loaded, so a limit is lifted with -1 instead.
+type Comments struct {
+	MaxDepth   int    `yaml:"max_depth" env-default:"50"`    // deepest allowed reply; -1 disables the limit
+	MaxLength  int    `yaml:"max_length" env-default:"2000"` // longest comment in bytes; -1 disables the limit
+	Moderation string `yaml:"moderation" env-default:"open"` // open or premoderation
+}
+
+// Tenancy lists the sites served by one deployment. A request belongs to
+// the site of its API key, else to the site named by its bearer token, else
+// to the site of its host, else to the default site.
+type Tenancy struct {
+	// RequireSite rejects requests that match no site instead of serving
+	// them the default site.
+	RequireSite bool `yaml:"require_site"`
+	// TokenSecret verifies HS256 bearer tokens; without it tokens do not
+	// select a site. TokenClaim is the claim holding the site ID.
+	TokenSecret string `yaml:"token_secret" env:"TENANCY_TOKEN_SECRET"`
+	TokenClaim  string `yaml:"token_claim" env-default:"site"`
+	Sites       []Site `yaml:"sites"`
+}
+
+type Site struct {
+	ID      string   `yaml:"id"`
+	Hosts   []string `yaml:"hosts"`
+	APIKeys []string `yaml:"api_keys"`
+	// ModeratorKeys grant a request of the site moderator rights when sent
+	// in the X-Moderator-Key header.
+	ModeratorKeys []string `yaml:"moderator_keys"`
+	// Comments override the global comment settings for the site; unset
+	// fields keep them.
+	Comments SiteComments `yaml:"comments"`
+}
+
+type SiteComments struct {
+	MaxLength  int    `yaml:"max_length"` // 0 keeps the global limit, -1 lifts it for the site
+	Moderation string `yaml:"moderation"`
+}
+
+// Cache puts a read-through cache in front of the storage for posts,
+// comment pages and comment counts. Writes made through this instance
+// invalidate it at once; other changes show up within TTL.
+type Cache struct {
+	Enabled bool          `yaml:"enabled"`
+	Size    int           `yaml:"size" env-default:"10000"` // entries of all kinds together
+	TTL     time.Duration `yaml:"ttl" env-default:"30s"`
+}
+
+type SQLite struct {
+	Path string `yaml:"path" env-default:"./data/comments.db"`
+}
+
+type InMemory struct {
+	Persistence Persistence `yaml:"persistence"`
+}
+
+// Persistence makes the in-memory storage durable: mutations go to a
+// write-ahead log in Dir and the whole state is periodically snapshotted.
+type Persistence struct {
+	Enabled          bool          `yaml:"enabled"`
+	Dir              string        `yaml:"dir" env-default:"./data/inmemory"`
+	Fsync            string        `yaml:"fsync" env-default:"interval"` // always, interval, never
+	FsyncInterval    time.Duration `yaml:"fsync_interval" env-default:"1s"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" env-default:"5m"`
+	CompactAfter     int           `yaml:"compact_after" env-default:"10000"` // log records before an early snapshot
+}
+
+// MustLoad loads the config named by the -config flag of the command line.
 func MustLoad() *Config {
 	configPath := flag.String("config", "", "path to config file")
 	flag.Parse()
 
-	path := ""
-	if *configPath != "" {
-		path = *configPath
-	} else if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
-		path = envPath
-	} else {
-		path = "config.yaml"
+	return MustLoadPath(*configPath)
+}
+
+// MustLoadPath loads the config at path, falling back to CONFIG_PATH and
+// then to config.yaml when path is empty. It leaves the command line alone,
+// for tools with flag sets of their own.
+func MustLoadPath(path string) *Config {
+	if path == "" {
+		if envPath := os.Getenv("CONFIG_PATH"); envPath != "" {
+			path = envPath
+		} else {
+			path = "config.yaml"
+		}
 	}
 
 	if _, err := os.Stat(path); os.IsNotExist(err) {
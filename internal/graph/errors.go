@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"comments-system/pkg/errors"
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// forbiddenError turns a moderator operation refused to the caller into a
+// GraphQL error with code FORBIDDEN. It returns nil for any other error.
+func forbiddenError(ctx context.Context, err error) error {
+	if !errors.Is(err, errors.ErrForbidden) {
+		return nil
+	}
+
+	return &gqlerror.Error{
+		Message:    err.Error(),
+		Path:       graphql.GetPath(ctx),
+		Extensions: map[string]any{"code": "FORBIDDEN"},
+	}
+}
+
+// conflictError turns a version conflict into a GraphQL error whose
+// extensions carry the stored version, so clients can refetch and retry.
+// It returns nil for any other error.
+func conflictError(ctx context.Context, err error) error {
+	var conflict *errors.ConflictError
+	if !errors.As(err, &conflict) {
+		return nil
+	}
+
+	return &gqlerror.Error{
+		Message: conflict.Error(),
+		Path:    graphql.GetPath(ctx),
+		Extensions: map[string]any{
+			"code":           "CONFLICT",
+			"currentVersion": conflict.CurrentVersion,
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package graph
+
+import "comments-system/internal/models"
+
+// feedFilter matches comments against an optional CommentFeedFilter. Post IDs
+// are indexed once so matching stays O(1) per event on the site-wide stream.
+// Hidden comments, which wait for moderation, only match a flagged-only
+// filter, and published ones only match any other.
+type feedFilter struct {
+	author      *string
+	postIDs     map[string]struct{}
+	flaggedOnly bool
+}
+
+func newFeedFilter(filter *models.CommentFeedFilter) *feedFilter {
+	f := &feedFilter{}
+	if filter == nil {
+		return f
+	}
+
+	f.author = filter.Author
+	f.flaggedOnly = filter.FlaggedOnly != nil && *filter.FlaggedOnly
+	if len(filter.PostIDs) > 0 {
+		f.postIDs = make(map[string]struct{}, len(filter.PostIDs))
+		for _, id := range filter.PostIDs {
+			f.postIDs[id] = struct{}{}
+		}
+	}
+
+	return f
+}
+
+func (f *feedFilter) Match(comment *models.Comment) bool {
+	if comment.Hidden != f.flaggedOnly {
+		return false
+	}
+
+	if f.author != nil && comment.Author != *f.author {
+		return false
+	}
+
+	if f.postIDs != nil {
+		if _, ok := f.postIDs[comment.PostID]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
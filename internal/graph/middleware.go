@@ -1,6 +1,18 @@
 package graph
 
-import "net/http"
+import (
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type idempotencyKeyCtx struct{}
 
 func ContentTypeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -8,3 +20,80 @@ func ContentTypeMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// IdempotencyKeyMiddleware passes the Idempotency-Key header to the create
+// mutations. A clientMutationId in the mutation input takes precedence.
+func IdempotencyKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			r = r.WithContext(context.WithValue(r.Context(), idempotencyKeyCtx{}, key))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SessionMiddleware passes the X-Session-ID header to the storage, which
+// keeps reads of a session consistent with its recent writes.
+func SessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.Header.Get("X-Session-ID"); id != "" {
+			r = r.WithContext(storage.WithSession(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestScope runs every GraphQL operation as one storage request, so its
+// reads after a write see the write even without a session. It wraps
+// operations rather than HTTP requests because a websocket carries many.
+func RequestScope(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	return next(storage.WithRequest(ctx))
+}
+
+// SiteMiddleware binds the request to the site sites resolves for it and
+// marks requests with a moderator key of that site as made by a moderator.
+// Requests with credentials of no site are refused with 401, requests for
+// an unknown site with 404, before they reach a resolver.
+func SiteMiddleware(sites *tenant.Sites) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			site, err := sites.Resolve(r)
+			if err != nil {
+				writeSiteError(w, err)
+				return
+			}
+			moderator, err := sites.Moderator(r, site)
+			if err != nil {
+				writeSiteError(w, err)
+				return
+			}
+
+			ctx := tenant.WithSite(r.Context(), site)
+			if moderator {
+				ctx = tenant.WithModerator(ctx)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func writeSiteError(w http.ResponseWriter, err error) {
+	status, code := http.StatusNotFound, "UNKNOWN_SITE"
+	if errors.Is(err, errors.ErrInvalidCredentials) {
+		status, code = http.StatusUnauthorized, "INVALID_CREDENTIALS"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(graphql.Response{Errors: gqlerror.List{{
+		Message:    err.Error(),
+		Extensions: map[string]any{"code": code},
+	}}})
+}
+
+func idempotencyKeyFromContext(ctx context.Context) *string {
+	key, ok := ctx.Value(idempotencyKeyCtx{}).(string)
+	if !ok {
+		return nil
+	}
+	return &key
+}
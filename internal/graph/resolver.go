@@ -5,6 +5,8 @@ import (
 	"comments-system/internal/models"
 	"comments-system/internal/pubsub"
 	"comments-system/internal/service"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
 	"comments-system/pkg/errors"
 	"context"
 	"fmt"
@@ -33,6 +35,10 @@ func (r *mutationResolver) CreatePost(ctx context.Context, input models.CreatePo
 
 	log.Debug("Creating post requested", "input", input)
 
+	if input.ClientMutationID == nil {
+		input.ClientMutationID = idempotencyKeyFromContext(ctx)
+	}
+
 	post, err := r.services.PostService.CreatePost(ctx, input)
 	if err != nil {
 		log.Error("Create post failed", "error", err, "input", input)
@@ -49,36 +55,57 @@ func (r *mutationResolver) CreateComment(ctx context.Context, input models.Creat
 
 	log.Debug("Creating comment requested", "input", input)
 
-	post, err := r.services.PostService.GetPost(ctx, input.PostID)
-	if err != nil {
-		log.Error("Failed to get post before creating comment", "error", err, "postID", input.PostID)
-		return nil, fmt.Errorf("failed to get post: %w", err)
-	}
-
-	if !post.CommentsEnabled {
-		log.Warn("Comments disabled for post", "postID", input.PostID)
-		return nil, errors.ErrCommentsDisabled
+	if input.ClientMutationID == nil {
+		input.ClientMutationID = idempotencyKeyFromContext(ctx)
 	}
 
-	comment, err := r.services.CommentService.CreateComment(ctx, input)
+	comment, created, err := r.services.CommentService.CreateComment(ctx, input)
 	if err != nil {
 		log.Error("Failed to create comment", "error", err, "input", input)
 		return nil, fmt.Errorf("failed to create comment: %w", err)
 	}
 
-	r.ps.Publish(input.PostID, &comment)
-	log.Info("Comment created completed", "id", comment.ID, "postID", input.PostID)
+	if !created {
+		log.Info("Comment create replayed", "id", comment.ID, "postID", input.PostID)
+		return &comment, nil
+	}
+
+	// A premoderated comment only reaches the moderation feed; readers see
+	// it once a moderator unhides it.
+	r.ps.Publish(tenant.SiteFromContext(ctx), input.PostID, &comment)
+	log.Info("Comment created completed", "id", comment.ID, "postID", input.PostID, "hidden", comment.Hidden)
 	return &comment, nil
 }
 
-func (r *mutationResolver) ToggleComments(ctx context.Context, postID string, enabled bool) (*models.Post, error) {
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, input models.UpdatePostInput) (*models.Post, error) {
+	const op = "resolver.mutationResolver.UpdatePost"
+	log := r.log.With(slog.String("op", op))
+
+	log.Debug("Updating post requested", "id", id, "expectedVersion", input.ExpectedVersion)
+	post, err := r.services.PostService.UpdatePost(ctx, id, input)
+	if err != nil {
+		log.Error("Update post failed", "error", err, "id", id)
+		if gqlErr := conflictError(ctx, err); gqlErr != nil {
+			return nil, gqlErr
+		}
+		return nil, fmt.Errorf("failed to update post: %w", err)
+	}
+
+	log.Info("Update post completed", "id", id, "version", post.Version)
+	return &post, nil
+}
+
+func (r *mutationResolver) ToggleComments(ctx context.Context, postID string, enabled bool, expectedVersion int) (*models.Post, error) {
 	const op = "resolver.mutationResolver.ToggleComments"
 	log := r.log.With(slog.String("op", op))
 
-	log.Debug("Toggling comments requested", "postID", postID, "enabled", enabled)
-	post, err := r.services.PostService.ToggleComments(ctx, postID, enabled)
+	log.Debug("Toggling comments requested", "postID", postID, "enabled", enabled, "expectedVersion", expectedVersion)
+	post, err := r.services.PostService.ToggleComments(ctx, postID, enabled, expectedVersion)
 	if err != nil {
 		log.Error("Toggle comments failed", "error", err, "postID", postID, "enabled", enabled)
+		if gqlErr := conflictError(ctx, err); gqlErr != nil {
+			return nil, gqlErr
+		}
 		return nil, fmt.Errorf("failed to toggle comments: %w", err)
 	}
 
@@ -86,7 +113,49 @@ func (r *mutationResolver) ToggleComments(ctx context.Context, postID string, en
 	return &post, nil
 }
 
-func (r *queryResolver) Posts(ctx context.Context, limit *int, offset *int) ([]*models.Post, error) {
+func (r *mutationResolver) SetTyping(ctx context.Context, postID string) (bool, error) {
+	const op = "resolver.mutationResolver.SetTyping"
+	log := r.log.With(slog.String("op", op))
+
+	log.Debug("Setting typing requested", "postID", postID)
+
+	// The signal is keyed by the session, so repeated signals from one
+	// session count once. X-Session-ID is chosen by the client, though, so
+	// this de-duplicates honest clients and does not stop inflation.
+	session := storage.SessionFromContext(ctx)
+	if session == "" {
+		log.Warn("Typing signal without a session refused", "postID", postID)
+		return false, fmt.Errorf("failed to set typing: %w", errors.ErrSessionRequired)
+	}
+
+	if _, err := r.services.PostService.GetPost(ctx, postID); err != nil {
+		log.Error("Failed to get post before setting typing", "error", err, "postID", postID)
+		return false, fmt.Errorf("failed to get post: %w", err)
+	}
+
+	r.ps.SetTyping(tenant.SiteFromContext(ctx), postID, session)
+	return true, nil
+}
+
+func (r *mutationResolver) LockThread(ctx context.Context, commentID string) (*models.Comment, error) {
+	const op = "resolver.mutationResolver.LockThread"
+	log := r.log.With(slog.String("op", op))
+
+	log.Debug("Locking thread requested", "commentID", commentID)
+	comment, err := r.services.CommentService.LockThread(ctx, commentID)
+	if err != nil {
+		log.Error("Lock thread failed", "error", err, "commentID", commentID)
+		if gqlErr := forbiddenError(ctx, err); gqlErr != nil {
+			return nil, gqlErr
+		}
+		return nil, fmt.Errorf("failed to lock thread: %w", err)
+	}
+
+	log.Info("Lock thread completed", "commentID", commentID)
+	return &comment, nil
+}
+
+func (r *queryResolver) Posts(ctx context.Context, limit *int, offset *int, filter *models.PostFilter) ([]*models.Post, error) {
 	const op = "resolver.queryResolver.Posts"
 	log := r.log.With(slog.String("op", op))
 
@@ -98,9 +167,13 @@ func (r *queryResolver) Posts(ctx context.Context, limit *int, offset *int) ([]*
 	if offset != nil {
 		o = *offset
 	}
+	var f models.PostFilter
+	if filter != nil {
+		f = *filter
+	}
 
-	log.Debug("Getting posts requested", "limit", l, "offset", o)
-	posts, err := r.services.PostService.GetPosts(ctx, l, o)
+	log.Debug("Getting posts requested", "limit", l, "offset", o, "filter", f)
+	posts, err := r.services.PostService.GetPosts(ctx, f, l, o)
 	if err != nil {
 		log.Error("Failed to get posts", "error", err, "limit", l, "offset", o)
 		return nil, fmt.Errorf("failed to get posts: %w", err)
@@ -131,7 +204,7 @@ func (r *queryResolver) Post(ctx context.Context, id string) (*models.Post, erro
 	return &post, nil
 }
 
-func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int, offset *int) (*models.CommentsPage, error) {
+func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int, offset *int, filter *models.CommentFilter) (*models.CommentsPage, error) {
 	const op = "resolver.queryResolver.Comments"
 	log := r.log.With(slog.String("op", op))
 
@@ -143,10 +216,14 @@ func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int,
 	if offset != nil {
 		o = *offset
 	}
+	var f models.CommentFilter
+	if filter != nil {
+		f = *filter
+	}
 
-	log.Debug("Getting comments requested", "postID", postID, "limit", l, "offset", o)
+	log.Debug("Getting comments requested", "postID", postID, "limit", l, "offset", o, "filter", f)
 
-	comments, total, err := r.services.CommentService.GetComments(ctx, postID, l, o)
+	comments, total, err := r.services.CommentService.GetComments(ctx, postID, f, l, o)
 	if err != nil {
 		log.Error("Failed to get comments", "error", err, "postID", postID, "limit", l, "offset", o)
 		return nil, fmt.Errorf("failed to get comments: %w", err)
@@ -180,13 +257,64 @@ func (r *queryResolver) CommentReplies(ctx context.Context, parentID string) ([]
 	return result, nil
 }
 
+func (r *queryResolver) CommentThread(ctx context.Context, commentID string, maxDepth *int) ([]*models.Comment, error) {
+	const op = "resolver.queryResolver.CommentThread"
+	log := r.log.With(slog.String("op", op))
+
+	d := 0
+	if maxDepth != nil {
+		d = *maxDepth
+	}
+
+	log.Debug("Getting comment thread requested", "commentID", commentID, "maxDepth", d)
+
+	subtree, err := r.services.CommentService.GetCommentSubtree(ctx, commentID, d)
+	if err != nil {
+		log.Error("Failed to get comment thread", "error", err, "commentID", commentID)
+		return nil, fmt.Errorf("failed to get comment thread: %w", err)
+	}
+
+	result := make([]*models.Comment, len(subtree))
+	for i := range subtree {
+		result[i] = &subtree[i]
+	}
+
+	log.Info("Comment thread retrieved completed", "commentID", commentID, "count", len(subtree))
+	return result, nil
+}
+
+func (r *queryResolver) Search(ctx context.Context, query string, searchType *models.SearchType, postID *string, first *int, after *string) (*models.SearchConnection, error) {
+	const op = "resolver.queryResolver.Search"
+	log := r.log.With(slog.String("op", op))
+
+	t := models.SearchTypeAll
+	if searchType != nil {
+		t = *searchType
+	}
+	f := 0
+	if first != nil {
+		f = *first
+	}
+
+	log.Debug("Search requested", "query", query, "type", t, "postID", postID)
+
+	conn, err := r.services.SearchService.Search(ctx, query, t, postID, f, after)
+	if err != nil {
+		log.Error("Search failed", "error", err, "query", query)
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	log.Info("Search completed", "query", query, "count", len(conn.Hits))
+	return &conn, nil
+}
+
 func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *models.Comment, error) {
 	const op = "resolver.subscriptionResolver.CommentAdded"
 	log := r.log.With(slog.String("op", op))
 
 	log.Debug("Subscribing to comments requested", "postID", postID)
 
-	ch, err := r.ps.Subscribe(ctx, postID)
+	ch, err := r.ps.Subscribe(ctx, tenant.SiteFromContext(ctx), postID)
 	if err != nil {
 		log.Error("Failed to subscribe to comments", "error", err, "postID", postID)
 		return nil, fmt.Errorf("failed to subscribe: %w", err)
@@ -195,3 +323,108 @@ func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string)
 	log.Info("Subscribed to comments completed", "postID", postID)
 	return ch, nil
 }
+
+func (r *subscriptionResolver) RepliesAdded(ctx context.Context, commentID string, includeDescendants *bool) (<-chan *models.Comment, error) {
+	const op = "resolver.subscriptionResolver.RepliesAdded"
+	log := r.log.With(slog.String("op", op))
+
+	descendants := false
+	if includeDescendants != nil {
+		descendants = *includeDescendants
+	}
+
+	log.Debug("Subscribing to replies requested", "commentID", commentID, "includeDescendants", descendants)
+
+	root, err := r.services.CommentService.GetComment(ctx, commentID)
+	if err != nil {
+		log.Error("Failed to get comment", "error", err, "commentID", commentID)
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	events, err := r.ps.Subscribe(ctx, tenant.SiteFromContext(ctx), root.PostID)
+	if err != nil {
+		log.Error("Failed to subscribe to comments", "error", err, "postID", root.PostID)
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	filter := newSubtreeFilter(root.ID, descendants, r.services.CommentService.GetCommentAncestors)
+	ch := make(chan *models.Comment, 10)
+
+	go func() {
+		defer close(ch)
+		for comment := range events {
+			matched, err := filter.Match(ctx, comment)
+			if err != nil {
+				log.Error("Failed to resolve comment thread", "error", err, "commentID", comment.ID)
+				continue
+			}
+			if !matched {
+				continue
+			}
+
+			select {
+			case ch <- comment:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info("Subscribed to replies completed", "commentID", commentID, "postID", root.PostID)
+	return ch, nil
+}
+
+func (r *subscriptionResolver) Presence(ctx context.Context, postID string) (<-chan *models.Presence, error) {
+	const op = "resolver.subscriptionResolver.Presence"
+	log := r.log.With(slog.String("op", op))
+
+	log.Debug("Subscribing to presence requested", "postID", postID)
+
+	ch, err := r.ps.SubscribePresence(ctx, tenant.SiteFromContext(ctx), postID)
+	if err != nil {
+		log.Error("Failed to subscribe to presence", "error", err, "postID", postID)
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	log.Info("Subscribed to presence completed", "postID", postID)
+	return ch, nil
+}
+
+func (r *subscriptionResolver) CommentFeed(ctx context.Context, filter *models.CommentFeedFilter) (<-chan *models.Comment, error) {
+	const op = "resolver.subscriptionResolver.CommentFeed"
+	log := r.log.With(slog.String("op", op))
+
+	log.Debug("Subscribing to comment feed requested", "filter", filter)
+
+	if filter != nil && filter.FlaggedOnly != nil && *filter.FlaggedOnly && !tenant.IsModerator(ctx) {
+		log.Warn("Flagged comment feed refused to non-moderator")
+		return nil, forbiddenError(ctx, fmt.Errorf("%s: %w", op, errors.ErrForbidden))
+	}
+
+	events, err := r.ps.SubscribeAll(ctx, tenant.SiteFromContext(ctx))
+	if err != nil {
+		log.Error("Failed to subscribe to comment feed", "error", err)
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	match := newFeedFilter(filter)
+	ch := make(chan *models.Comment, 10)
+
+	go func() {
+		defer close(ch)
+		for comment := range events {
+			if !match.Match(comment) {
+				continue
+			}
+
+			select {
+			case ch <- comment:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info("Subscribed to comment feed completed")
+	return ch, nil
+}
@@ -0,0 +1,107 @@
+package graph_test
+
+import (
+	"comments-system/internal/graph"
+	"comments-system/internal/models"
+	"comments-system/internal/pubsub"
+	"comments-system/internal/service"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"comments-system/pkg/logger/slogdiscard"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func receive(t *testing.T, ch <-chan *models.Comment) *models.Comment {
+	t.Helper()
+
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("no comment received")
+		return nil
+	}
+}
+
+func newServices(s storage.Storage, opts ...service.Option) *service.Service {
+	log := slogdiscard.NewDiscardLogger()
+	return &service.Service{
+		PostService:    service.NewPostService(s, log),
+		CommentService: service.NewCommentService(s, log, opts...),
+		SearchService:  service.NewSearchService(s, log),
+	}
+}
+
+func TestMutationResolver_SetTyping(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	r := graph.NewResolver(newServices(inmemory.NewInMemory()), ps, slogdiscard.NewDiscardLogger())
+	ctx := tenant.WithSite(context.Background(), "blog")
+
+	post, err := r.Mutation().CreatePost(ctx, models.CreatePostInput{Title: "Post", Content: "Content", Author: "Author", CommentsEnabled: true})
+	require.NoError(t, err)
+
+	_, err = r.Mutation().SetTyping(ctx, post.ID)
+	require.ErrorIs(t, err, errors.ErrSessionRequired)
+	assert.Zero(t, ps.Presence("blog", post.ID).Typing)
+
+	// Repeated signals of one session count once, however often they come.
+	for range 3 {
+		_, err = r.Mutation().SetTyping(storage.WithSession(ctx, "session1"), post.ID)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, ps.Presence("blog", post.ID).Typing)
+
+	_, err = r.Mutation().SetTyping(storage.WithSession(ctx, "session2"), post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ps.Presence("blog", post.ID).Typing)
+}
+
+func TestSubscriptionResolver_CommentFeed_FlaggedOnly(t *testing.T) {
+	services := newServices(inmemory.NewInMemory(),
+		service.WithSiteSettings("blog", models.SiteSettings{Moderation: models.ModerationPremoderation}))
+	ps := pubsub.NewPubSub()
+	r := graph.NewResolver(services, ps, slogdiscard.NewDiscardLogger())
+
+	ctx, cancel := context.WithCancel(tenant.WithSite(context.Background(), "blog"))
+	defer cancel()
+
+	post, err := r.Mutation().CreatePost(ctx, models.CreatePostInput{Title: "Post", Content: "Content", Author: "Author", CommentsEnabled: true})
+	require.NoError(t, err)
+
+	flaggedOnly := true
+	_, err = r.Subscription().CommentFeed(ctx, &models.CommentFeedFilter{FlaggedOnly: &flaggedOnly})
+	var gqlErr *gqlerror.Error
+	require.True(t, errors.As(err, &gqlErr), "a reader cannot watch the moderation queue")
+	assert.Equal(t, "FORBIDDEN", gqlErr.Extensions["code"])
+
+	flagged, err := r.Subscription().CommentFeed(tenant.WithModerator(ctx), &models.CommentFeedFilter{FlaggedOnly: &flaggedOnly})
+	require.NoError(t, err)
+	feed, err := r.Subscription().CommentFeed(ctx, nil)
+	require.NoError(t, err)
+	added, err := r.Subscription().CommentAdded(ctx, post.ID)
+	require.NoError(t, err)
+
+	held, err := r.Mutation().CreateComment(ctx, models.CreateCommentInput{PostID: post.ID, Author: "Reader", Content: "Waiting"})
+	require.NoError(t, err)
+	require.True(t, held.Hidden)
+
+	got := receive(t, flagged)
+	assert.Equal(t, held.ID, got.ID)
+	assert.Equal(t, "Waiting", got.Content)
+
+	// A published comment arrives after the held one would have; readers
+	// get it first.
+	published := &models.Comment{ID: "published", PostID: post.ID, Author: "Moderator", Content: "Shown"}
+	ps.Publish("blog", post.ID, published)
+
+	assert.Equal(t, published.ID, receive(t, feed).ID)
+	assert.Equal(t, published.ID, receive(t, added).ID)
+}
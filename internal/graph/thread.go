@@ -0,0 +1,64 @@
+package graph
+
+import (
+	"comments-system/internal/models"
+	"context"
+)
+
+// subtreeFilter decides whether comments published for a post belong to the
+// thread rooted at a given comment. The IDs found in the thread are cached,
+// so the ancestor path is only looked up for a parent outside of it. Nothing
+// is kept for the rest of the post, so the cache grows with the thread
+// rather than with everything published while the subscription lives.
+type subtreeFilter struct {
+	rootID             string
+	includeDescendants bool
+	ancestors          func(ctx context.Context, id string) ([]string, error)
+	inSubtree          map[string]struct{}
+}
+
+func newSubtreeFilter(
+	rootID string,
+	includeDescendants bool,
+	ancestors func(ctx context.Context, id string) ([]string, error),
+) *subtreeFilter {
+	return &subtreeFilter{
+		rootID:             rootID,
+		includeDescendants: includeDescendants,
+		ancestors:          ancestors,
+		inSubtree:          map[string]struct{}{rootID: {}},
+	}
+}
+
+func (f *subtreeFilter) Match(ctx context.Context, comment *models.Comment) (bool, error) {
+	if comment.ParentID == nil {
+		return false, nil
+	}
+
+	parentID := *comment.ParentID
+	if !f.includeDescendants {
+		return parentID == f.rootID, nil
+	}
+
+	if _, ok := f.inSubtree[parentID]; !ok {
+		path, err := f.ancestors(ctx, parentID)
+		if err != nil {
+			return false, err
+		}
+
+		matched := false
+		for _, id := range path {
+			if id == f.rootID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+		f.inSubtree[parentID] = struct{}{}
+	}
+
+	f.inSubtree[comment.ID] = struct{}{}
+	return true, nil
+}
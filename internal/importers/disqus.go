@@ -0,0 +1,113 @@
+package importers
+
+import (
+	"comments-system/internal/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// disqusExport is the XML Disqus produces under Moderation > Export. Threads
+// are the pages comments were left on; posts are the comments.
+type disqusExport struct {
+	Threads []disqusThread `xml:"thread"`
+	Posts   []disqusPost   `xml:"post"`
+}
+
+type disqusThread struct {
+	ID        string       `xml:"id,attr"`
+	Link      string       `xml:"link"`
+	Title     string       `xml:"title"`
+	Message   string       `xml:"message"`
+	CreatedAt string       `xml:"createdAt"`
+	Author    disqusAuthor `xml:"author"`
+	IsClosed  bool         `xml:"isClosed"`
+	IsDeleted bool         `xml:"isDeleted"`
+}
+
+type disqusPost struct {
+	ID        string       `xml:"id,attr"`
+	Message   string       `xml:"message"`
+	CreatedAt string       `xml:"createdAt"`
+	IsDeleted bool         `xml:"isDeleted"`
+	IsSpam    bool         `xml:"isSpam"`
+	Author    disqusAuthor `xml:"author"`
+	Thread    disqusRef    `xml:"thread"`
+	Parent    disqusRef    `xml:"parent"`
+}
+
+type disqusAuthor struct {
+	Name     string `xml:"name"`
+	Email    string `xml:"email"`
+	Username string `xml:"username"`
+}
+
+type disqusRef struct {
+	ID string `xml:"id,attr"`
+}
+
+// ParseDisqus maps a Disqus XML export. Deleted threads and deleted or spam
+// comments are skipped; replies to a skipped comment move up to its nearest
+// kept ancestor.
+func ParseDisqus(r io.Reader) (*Result, error) {
+	const op = "importers.ParseDisqus"
+
+	var export disqusExport
+	if err := xml.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	b := newBuilder("thread")
+	for _, t := range export.Threads {
+		if t.IsDeleted {
+			b.skip("thread", t.ID, "deleted")
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, strings.TrimSpace(t.CreatedAt))
+		if err != nil {
+			b.skip("thread", t.ID, "invalid createdAt")
+			continue
+		}
+
+		title := strings.TrimSpace(t.Title)
+		if title == "" {
+			title = strings.TrimSpace(t.Link)
+		}
+		content := htmlToText(t.Message)
+		if content == "" {
+			content = strings.TrimSpace(t.Link)
+		}
+
+		b.addPost(t.ID, models.Post{
+			Title:           title,
+			Content:         content,
+			Author:          b.authors.name(t.Author.Name, key("username", t.Author.Username), key("email", t.Author.Email)),
+			CommentsEnabled: !t.IsClosed,
+			CreatedAt:       createdAt,
+		})
+	}
+
+	for _, p := range export.Posts {
+		createdAt, err := time.Parse(time.RFC3339, strings.TrimSpace(p.CreatedAt))
+
+		var reason string
+		switch {
+		case p.IsSpam:
+			reason = "spam"
+		case p.IsDeleted:
+			reason = "deleted"
+		case err != nil:
+			reason = "invalid createdAt"
+		}
+
+		b.addComment(p.ID, p.Parent.ID, p.Thread.ID, models.Comment{
+			Author:    b.authors.name(p.Author.Name, key("username", p.Author.Username), key("email", p.Author.Email)),
+			Content:   htmlToText(p.Message),
+			CreatedAt: createdAt,
+		}, reason)
+	}
+
+	return b.build(), nil
+}
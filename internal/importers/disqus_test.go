@@ -0,0 +1,154 @@
+package importers_test
+
+import (
+	"comments-system/internal/importers"
+	"comments-system/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const disqusExport = `<?xml version="1.0" encoding="utf-8"?>
+<disqus xmlns="http://disqus.com" xmlns:dsq="http://disqus.com/disqus-internals">
+  <thread dsq:id="100">
+    <id>hello-world</id>
+    <link>https://blog.example.com/hello-world</link>
+    <title>Hello World</title>
+    <message></message>
+    <createdAt>2015-06-01T10:00:00Z</createdAt>
+    <author><name>Admin</name><isAnonymous>false</isAnonymous><username>admin</username></author>
+    <isClosed>false</isClosed>
+    <isDeleted>false</isDeleted>
+  </thread>
+  <thread dsq:id="101">
+    <link>https://blog.example.com/gone</link>
+    <title>Gone</title>
+    <createdAt>2015-06-02T10:00:00Z</createdAt>
+    <isClosed>true</isClosed>
+    <isDeleted>true</isDeleted>
+  </thread>
+  <post dsq:id="3">
+    <message><![CDATA[<p>Reply to a deleted comment</p>]]></message>
+    <createdAt>2015-06-01T12:00:00Z</createdAt>
+    <isDeleted>false</isDeleted>
+    <isSpam>false</isSpam>
+    <author><name>Jane</name><isAnonymous>false</isAnonymous><username>jane</username></author>
+    <thread dsq:id="100"/>
+    <parent dsq:id="2"/>
+  </post>
+  <post dsq:id="1">
+    <message><![CDATA[<p>First!</p><p>Great &amp; short.</p>]]></message>
+    <createdAt>2015-06-01T11:00:00Z</createdAt>
+    <isDeleted>false</isDeleted>
+    <isSpam>false</isSpam>
+    <author><name>John</name><isAnonymous>false</isAnonymous><username>john</username></author>
+    <thread dsq:id="100"/>
+  </post>
+  <post dsq:id="2">
+    <message><![CDATA[removed]]></message>
+    <createdAt>2015-06-01T11:30:00Z</createdAt>
+    <isDeleted>true</isDeleted>
+    <isSpam>false</isSpam>
+    <author><name>Johnny</name><isAnonymous>false</isAnonymous><username>john</username></author>
+    <thread dsq:id="100"/>
+    <parent dsq:id="1"/>
+  </post>
+  <post dsq:id="4">
+    <message><![CDATA[Buy now]]></message>
+    <createdAt>2015-06-01T13:00:00Z</createdAt>
+    <isDeleted>false</isDeleted>
+    <isSpam>true</isSpam>
+    <author><name>Spammer</name><isAnonymous>true</isAnonymous></author>
+    <thread dsq:id="100"/>
+  </post>
+  <post dsq:id="5">
+    <message><![CDATA[Same name, different person]]></message>
+    <createdAt>2015-06-01T14:00:00Z</createdAt>
+    <isDeleted>false</isDeleted>
+    <isSpam>false</isSpam>
+    <author><name>John</name><isAnonymous>false</isAnonymous><username>john2</username></author>
+    <thread dsq:id="100"/>
+    <parent dsq:id="1"/>
+  </post>
+  <post dsq:id="6">
+    <message><![CDATA[` + "%s" + `]]></message>
+    <createdAt>2015-06-01T15:00:00Z</createdAt>
+    <isDeleted>false</isDeleted>
+    <isSpam>false</isSpam>
+    <author><name>John</name><isAnonymous>false</isAnonymous><username>john</username></author>
+    <thread dsq:id="100"/>
+  </post>
+  <post dsq:id="7">
+    <message><![CDATA[On a deleted thread]]></message>
+    <createdAt>2015-06-02T11:00:00Z</createdAt>
+    <isDeleted>false</isDeleted>
+    <isSpam>false</isSpam>
+    <author><name>Jane</name><isAnonymous>false</isAnonymous><username>jane</username></author>
+    <thread dsq:id="101"/>
+  </post>
+</disqus>`
+
+func TestParseDisqus(t *testing.T) {
+	export := strings.Replace(disqusExport, "%s", strings.Repeat("a", 2001), 1)
+
+	res, err := importers.ParseDisqus(strings.NewReader(export))
+	require.NoError(t, err)
+
+	require.Len(t, res.Posts, 1)
+	post := res.Posts[0]
+	assert.Equal(t, "Hello World", post.Title)
+	assert.Equal(t, "https://blog.example.com/hello-world", post.Content)
+	assert.Equal(t, "Admin", post.Author)
+	assert.True(t, post.CommentsEnabled)
+	assert.True(t, post.CreatedAt.Equal(time.Date(2015, 6, 1, 10, 0, 0, 0, time.UTC)))
+
+	// The reply to the deleted comment moves up to the comment above it.
+	require.Len(t, res.Comments, 3)
+	requireTopological(t, res.Comments)
+	first, moved, other := res.Comments[0], res.Comments[1], res.Comments[2]
+	assert.Equal(t, "First!\nGreat & short.", first.Content)
+	assert.Equal(t, "John", first.Author)
+	assert.Nil(t, first.ParentID)
+
+	assert.Equal(t, "Reply to a deleted comment", moved.Content)
+	assert.Equal(t, &first.ID, moved.ParentID)
+
+	assert.Equal(t, "John (2)", other.Author)
+	assert.Equal(t, &first.ID, other.ParentID)
+
+	for _, c := range res.Comments {
+		assert.Equal(t, post.ID, c.PostID)
+	}
+	// IDs follow creation times, like generated ones.
+	assert.Less(t, first.ID, moved.ID)
+	assert.Less(t, moved.ID, other.ID)
+
+	assert.Equal(t, 4, res.Authors)
+	assert.ElementsMatch(t, []importers.Skipped{
+		{Kind: "thread", ID: "101", Reason: "deleted"},
+		{Kind: "comment", ID: "2", Reason: "deleted"},
+		{Kind: "comment", ID: "4", Reason: "spam"},
+		{Kind: "comment", ID: "6", Reason: "comment exceeds 2000 characters limit"},
+		{Kind: "comment", ID: "7", Reason: "thread 101 is not imported"},
+	}, res.Skipped)
+}
+
+func TestParseDisqus_Invalid(t *testing.T) {
+	_, err := importers.ParseDisqus(strings.NewReader("<disqus><thread>"))
+	require.Error(t, err)
+}
+
+func requireTopological(t *testing.T, comments []models.Comment) {
+	t.Helper()
+
+	seen := make(map[string]bool)
+	for _, c := range comments {
+		if c.ParentID != nil {
+			require.True(t, seen[*c.ParentID], "comment %s comes before its parent", c.ID)
+		}
+		seen[c.ID] = true
+	}
+}
@@ -0,0 +1,268 @@
+// Package importers maps comment exports of other systems to posts and
+// comments that can be loaded with storage.ImportStorage.
+package importers
+
+import (
+	"comments-system/internal/models"
+	"comments-system/pkg/utils"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Result is an export mapped to this system: posts, comments listed parents
+// first, and the items that were left out.
+type Result struct {
+	Posts    []models.Post
+	Comments []models.Comment
+	Skipped  []Skipped
+	// Authors is the number of distinct authors of the mapped posts and
+	// comments after deduplication.
+	Authors int
+}
+
+// Skipped is an item of the export that was not mapped, with the ID it has
+// in the export.
+type Skipped struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// builder collects the items of one export. Comments are linked by their
+// IDs in the export, so replies may come before their parents and parents
+// may be skipped; build sorts this out once everything has been read.
+type builder struct {
+	// postKind is what the export calls the items that become posts.
+	postKind string
+	authors  authors
+
+	posts    []models.Post
+	postIDs  map[string]string
+	comments map[string]*sourceComment
+	order    []*sourceComment
+	skipped  []Skipped
+
+	ids map[int64]bool
+}
+
+// sourceComment is a comment as the export has it. A skipped comment stays
+// in the tree so its replies can move up to the nearest kept ancestor.
+type sourceComment struct {
+	id, parentID, postID string
+	comment              models.Comment
+	skipped              bool
+}
+
+func newBuilder(postKind string) *builder {
+	return &builder{
+		postKind: postKind,
+		authors:  newAuthors(),
+		postIDs:  make(map[string]string),
+		comments: make(map[string]*sourceComment),
+		ids:      make(map[int64]bool),
+	}
+}
+
+func (b *builder) skip(kind, id, reason string) {
+	b.skipped = append(b.skipped, Skipped{Kind: kind, ID: id, Reason: reason})
+}
+
+// addPost keeps post under the ID sourceID it has in the export.
+func (b *builder) addPost(sourceID string, post models.Post) {
+	post.ID = b.newID(post.CreatedAt)
+	post.Version = 1
+	b.postIDs[sourceID] = post.ID
+	b.posts = append(b.posts, post)
+}
+
+// addComment keeps comment, or only its place in the tree when reason is
+// not empty. parentID is empty for a root comment.
+func (b *builder) addComment(id, parentID, postID string, comment models.Comment, reason string) {
+	if _, ok := b.comments[id]; ok {
+		b.skip("comment", id, "duplicate ID")
+		return
+	}
+
+	if reason == "" {
+		if err := utils.ValidateComment(comment.Content, utils.DefaultMaxCommentLength); err != nil {
+			reason = err.Error()
+		}
+	}
+	if reason != "" {
+		b.skip("comment", id, reason)
+	}
+
+	c := &sourceComment{id: id, parentID: parentID, postID: postID, comment: comment, skipped: reason != ""}
+	b.comments[id] = c
+	b.order = append(b.order, c)
+}
+
+func (b *builder) build() *Result {
+	res := &Result{Posts: b.posts}
+
+	children := make(map[string][]*sourceComment)
+	var roots []*sourceComment
+	for _, c := range b.order {
+		if c.skipped {
+			continue
+		}
+		postID, ok := b.postIDs[c.postID]
+		if !ok {
+			c.skipped = true
+			b.skip("comment", c.id, fmt.Sprintf("%s %s is not imported", b.postKind, c.postID))
+			continue
+		}
+		c.comment.PostID = postID
+
+		if parent := b.keptAncestor(c); parent != nil {
+			children[parent.id] = append(children[parent.id], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	// IDs follow creation times, so siblings keep their order in paths.
+	byTime := func(cs []*sourceComment) {
+		sort.SliceStable(cs, func(i, j int) bool {
+			return cs[i].comment.CreatedAt.Before(cs[j].comment.CreatedAt)
+		})
+	}
+	byTime(roots)
+	for _, cs := range children {
+		byTime(cs)
+	}
+
+	var walk func(c *sourceComment, parentID *string)
+	walk = func(c *sourceComment, parentID *string) {
+		c.comment.ID = b.newID(c.comment.CreatedAt)
+		c.comment.ParentID = parentID
+		res.Comments = append(res.Comments, c.comment)
+
+		id := c.comment.ID
+		for _, reply := range children[c.id] {
+			walk(reply, &id)
+		}
+	}
+	for _, root := range roots {
+		walk(root, nil)
+	}
+
+	names := make(map[string]bool)
+	for _, p := range res.Posts {
+		names[p.Author] = true
+	}
+	for _, c := range res.Comments {
+		names[c.Author] = true
+	}
+
+	res.Skipped = b.skipped
+	res.Authors = len(names)
+	return res
+}
+
+// keptAncestor returns the nearest ancestor of c that is imported, or nil
+// when c becomes a root comment. Replies to a parent missing from the
+// export become roots too.
+func (b *builder) keptAncestor(c *sourceComment) *sourceComment {
+	seen := map[string]bool{c.id: true}
+	for id := c.parentID; id != "" && !seen[id]; {
+		seen[id] = true
+		parent, ok := b.comments[id]
+		if !ok {
+			return nil
+		}
+		if !parent.skipped && parent.postID == c.postID {
+			return parent
+		}
+		id = parent.parentID
+	}
+	return nil
+}
+
+// newID returns an ID in the format of utils.GenerateID for an item created
+// at t, bumped forward while it is taken.
+func (b *builder) newID(t time.Time) string {
+	n := t.UnixNano()
+	for b.ids[n] {
+		n++
+	}
+	b.ids[n] = true
+	return fmt.Sprintf("%x", n)
+}
+
+// authors gives every person in an export one author name. A person is
+// recognized by any of the identity keys seen with them; different people
+// with the same name are told apart by a number.
+type authors struct {
+	byKey map[string]string
+	taken map[string]bool
+}
+
+func newAuthors() authors {
+	return authors{byKey: make(map[string]string), taken: make(map[string]bool)}
+}
+
+// name returns the author name for a person called name with the given
+// identity keys, such as a login or an email; empty keys are ignored.
+func (a authors) name(name string, keys ...string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		name = "Anonymous"
+	}
+
+	var ids []string
+	for _, key := range keys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			ids = append(ids, key)
+		}
+	}
+	if len(ids) == 0 {
+		ids = []string{"name:" + strings.ToLower(name)}
+	}
+
+	for _, id := range ids {
+		if known, ok := a.byKey[id]; ok {
+			for _, id := range ids {
+				a.byKey[id] = known
+			}
+			return known
+		}
+	}
+
+	unique := name
+	for n := 2; a.taken[unique]; n++ {
+		unique = fmt.Sprintf("%s (%d)", name, n)
+	}
+	a.taken[unique] = true
+	for _, id := range ids {
+		a.byKey[id] = unique
+	}
+	return unique
+}
+
+// key builds an identity key for authors.name, empty when value is.
+func key(kind, value string) string {
+	if value = strings.TrimSpace(value); value == "" {
+		return ""
+	}
+	return kind + ":" + value
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|blockquote|pre|h[1-6])>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n\s*\n(\s*\n)+`)
+)
+
+// htmlToText turns the HTML of an exported message into plain text.
+func htmlToText(s string) string {
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
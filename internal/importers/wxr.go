@@ -0,0 +1,175 @@
+package importers
+
+import (
+	"comments-system/internal/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// wxrExport is a WordPress eXtended RSS file from Tools > Export. Element
+// names are matched without the wp namespace, whose version differs between
+// WordPress releases.
+type wxrExport struct {
+	Authors []wxrAuthor `xml:"channel>author"`
+	Items   []wxrItem   `xml:"channel>item"`
+}
+
+type wxrAuthor struct {
+	ID          string `xml:"author_id"`
+	Login       string `xml:"author_login"`
+	Email       string `xml:"author_email"`
+	DisplayName string `xml:"author_display_name"`
+}
+
+type wxrItem struct {
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Creator       string       `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Content       string       `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostID        string       `xml:"post_id"`
+	PostDateGMT   string       `xml:"post_date_gmt"`
+	PostDate      string       `xml:"post_date"`
+	CommentStatus string       `xml:"comment_status"`
+	Status        string       `xml:"status"`
+	PostType      string       `xml:"post_type"`
+	Comments      []wxrComment `xml:"comment"`
+}
+
+type wxrComment struct {
+	ID          string `xml:"comment_id"`
+	Author      string `xml:"comment_author"`
+	AuthorEmail string `xml:"comment_author_email"`
+	DateGMT     string `xml:"comment_date_gmt"`
+	Date        string `xml:"comment_date"`
+	Content     string `xml:"comment_content"`
+	Approved    string `xml:"comment_approved"`
+	Type        string `xml:"comment_type"`
+	Parent      string `xml:"comment_parent"`
+	UserID      string `xml:"comment_user_id"`
+}
+
+// wxrDate is the layout of WordPress dates.
+const wxrDate = "2006-01-02 15:04:05"
+
+// ParseWXR maps a WordPress WXR export. Published posts and pages become
+// posts; other items are skipped when they have comments and ignored
+// otherwise. Unapproved, spam and trashed comments, pingbacks and
+// trackbacks are skipped; replies to a skipped comment move up to its
+// nearest kept ancestor.
+func ParseWXR(r io.Reader) (*Result, error) {
+	const op = "importers.ParseWXR"
+
+	var export wxrExport
+	if err := xml.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	b := newBuilder("post")
+
+	// Posts name their author by login; registered commenters are known by
+	// user ID and email as well.
+	logins := make(map[string]wxrAuthor)
+	for _, a := range export.Authors {
+		logins[strings.TrimSpace(a.Login)] = a
+	}
+	postAuthor := func(login string) string {
+		a, ok := logins[strings.TrimSpace(login)]
+		if !ok {
+			return b.authors.name(login, key("login", login))
+		}
+		name := a.DisplayName
+		if strings.TrimSpace(name) == "" {
+			name = a.Login
+		}
+		return b.authors.name(name, key("login", a.Login), key("user", a.ID), key("email", a.Email))
+	}
+
+	for _, item := range export.Items {
+		postID := strings.TrimSpace(item.PostID)
+		postType, status := strings.TrimSpace(item.PostType), strings.TrimSpace(item.Status)
+		if postType != "post" && postType != "page" {
+			if len(item.Comments) > 0 {
+				b.skip("post", postID, "post type "+postType)
+			}
+			continue
+		}
+		if status != "publish" {
+			if len(item.Comments) > 0 {
+				b.skip("post", postID, "status "+status)
+			}
+			continue
+		}
+
+		createdAt, ok := wxrTime(item.PostDateGMT, item.PostDate)
+		if !ok {
+			b.skip("post", postID, "invalid post date")
+			continue
+		}
+
+		title := strings.TrimSpace(item.Title)
+		if title == "" {
+			title = strings.TrimSpace(item.Link)
+		}
+		b.addPost(postID, models.Post{
+			Title:           title,
+			Content:         htmlToText(item.Content),
+			Author:          postAuthor(item.Creator),
+			CommentsEnabled: strings.TrimSpace(item.CommentStatus) == "open",
+			CreatedAt:       createdAt,
+		})
+	}
+
+	for _, item := range export.Items {
+		postID := strings.TrimSpace(item.PostID)
+		for _, c := range item.Comments {
+			createdAt, ok := wxrTime(c.DateGMT, c.Date)
+
+			var reason string
+			switch approved, typ := strings.TrimSpace(c.Approved), strings.TrimSpace(c.Type); {
+			case typ != "" && typ != "comment":
+				reason = typ
+			case approved == "spam" || approved == "trash":
+				reason = approved
+			case approved != "1":
+				reason = "unapproved"
+			case !ok:
+				reason = "invalid comment date"
+			}
+
+			userID := strings.TrimSpace(c.UserID)
+			if userID == "0" {
+				userID = ""
+			}
+			parentID := strings.TrimSpace(c.Parent)
+			if parentID == "0" {
+				parentID = ""
+			}
+
+			b.addComment(strings.TrimSpace(c.ID), parentID, postID, models.Comment{
+				Author:    b.authors.name(c.Author, key("user", userID), key("email", c.AuthorEmail)),
+				Content:   htmlToText(c.Content),
+				CreatedAt: createdAt,
+			}, reason)
+		}
+	}
+
+	return b.build(), nil
+}
+
+// wxrTime parses the GMT date of an item, or its local date taken as UTC
+// when WordPress left the GMT one unset, as it does for some drafts.
+func wxrTime(gmt, local string) (time.Time, bool) {
+	for _, s := range []string{gmt, local} {
+		s = strings.TrimSpace(s)
+		if s == "" || strings.HasPrefix(s, "0000-00-00") {
+			continue
+		}
+		if t, err := time.Parse(wxrDate, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
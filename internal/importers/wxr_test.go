@@ -0,0 +1,152 @@
+package importers_test
+
+import (
+	"comments-system/internal/importers"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const wxrExport = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<wp:author>
+		<wp:author_id>1</wp:author_id>
+		<wp:author_login><![CDATA[admin]]></wp:author_login>
+		<wp:author_email><![CDATA[admin@example.com]]></wp:author_email>
+		<wp:author_display_name><![CDATA[Site Admin]]></wp:author_display_name>
+	</wp:author>
+	<item>
+		<title>Hello world!</title>
+		<link>https://example.com/hello-world/</link>
+		<dc:creator><![CDATA[admin]]></dc:creator>
+		<content:encoded><![CDATA[Welcome to <strong>WordPress</strong>.]]></content:encoded>
+		<excerpt:encoded><![CDATA[]]></excerpt:encoded>
+		<wp:post_id>1</wp:post_id>
+		<wp:post_date_gmt><![CDATA[2019-01-01 08:00:00]]></wp:post_date_gmt>
+		<wp:comment_status><![CDATA[closed]]></wp:comment_status>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+		<wp:comment>
+			<wp:comment_id>10</wp:comment_id>
+			<wp:comment_author><![CDATA[Reader]]></wp:comment_author>
+			<wp:comment_author_email><![CDATA[reader@example.com]]></wp:comment_author_email>
+			<wp:comment_date_gmt><![CDATA[2019-01-01 09:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[Nice post]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_type><![CDATA[comment]]></wp:comment_type>
+			<wp:comment_parent>0</wp:comment_parent>
+			<wp:comment_user_id>0</wp:comment_user_id>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_id>11</wp:comment_id>
+			<wp:comment_author><![CDATA[admin]]></wp:comment_author>
+			<wp:comment_author_email><![CDATA[admin@example.com]]></wp:comment_author_email>
+			<wp:comment_date_gmt><![CDATA[2019-01-01 10:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[Thanks!]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_type><![CDATA[]]></wp:comment_type>
+			<wp:comment_parent>10</wp:comment_parent>
+			<wp:comment_user_id>1</wp:comment_user_id>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_id>12</wp:comment_id>
+			<wp:comment_author><![CDATA[reader]]></wp:comment_author>
+			<wp:comment_author_email><![CDATA[Reader@Example.com]]></wp:comment_author_email>
+			<wp:comment_date_gmt><![CDATA[0000-00-00 00:00:00]]></wp:comment_date_gmt>
+			<wp:comment_date><![CDATA[2019-01-01 11:00:00]]></wp:comment_date>
+			<wp:comment_content><![CDATA[Me again]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_parent>11</wp:comment_parent>
+			<wp:comment_user_id>0</wp:comment_user_id>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_id>13</wp:comment_id>
+			<wp:comment_author><![CDATA[Other Blog]]></wp:comment_author>
+			<wp:comment_date_gmt><![CDATA[2019-01-02 09:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[Linked to you]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_type><![CDATA[pingback]]></wp:comment_type>
+			<wp:comment_parent>0</wp:comment_parent>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_id>14</wp:comment_id>
+			<wp:comment_author><![CDATA[Someone]]></wp:comment_author>
+			<wp:comment_date_gmt><![CDATA[2019-01-02 10:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[Pending]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[0]]></wp:comment_approved>
+			<wp:comment_parent>0</wp:comment_parent>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_id>15</wp:comment_id>
+			<wp:comment_author><![CDATA[Someone]]></wp:comment_author>
+			<wp:comment_date_gmt><![CDATA[2019-01-02 11:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[   ]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_parent>0</wp:comment_parent>
+		</wp:comment>
+	</item>
+	<item>
+		<title>logo.png</title>
+		<wp:post_id>2</wp:post_id>
+		<wp:status><![CDATA[inherit]]></wp:status>
+		<wp:post_type><![CDATA[attachment]]></wp:post_type>
+	</item>
+	<item>
+		<title>Draft</title>
+		<wp:post_id>3</wp:post_id>
+		<wp:status><![CDATA[draft]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+		<wp:comment>
+			<wp:comment_id>30</wp:comment_id>
+			<wp:comment_author><![CDATA[Reader]]></wp:comment_author>
+			<wp:comment_date_gmt><![CDATA[2019-02-01 09:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[Early]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_parent>0</wp:comment_parent>
+		</wp:comment>
+	</item>
+</channel>
+</rss>`
+
+func TestParseWXR(t *testing.T) {
+	res, err := importers.ParseWXR(strings.NewReader(wxrExport))
+	require.NoError(t, err)
+
+	require.Len(t, res.Posts, 1)
+	post := res.Posts[0]
+	assert.Equal(t, "Hello world!", post.Title)
+	assert.Equal(t, "Welcome to WordPress.", post.Content)
+	assert.Equal(t, "Site Admin", post.Author)
+	assert.False(t, post.CommentsEnabled)
+	assert.True(t, post.CreatedAt.Equal(time.Date(2019, 1, 1, 8, 0, 0, 0, time.UTC)))
+
+	require.Len(t, res.Comments, 3)
+	requireTopological(t, res.Comments)
+	nice, thanks, again := res.Comments[0], res.Comments[1], res.Comments[2]
+	assert.Equal(t, "Reader", nice.Author)
+	assert.Nil(t, nice.ParentID)
+
+	// The admin is recognized by user ID, the reader by email.
+	assert.Equal(t, "Site Admin", thanks.Author)
+	assert.Equal(t, &nice.ID, thanks.ParentID)
+	assert.Equal(t, "Reader", again.Author)
+	assert.Equal(t, &thanks.ID, again.ParentID)
+	assert.True(t, again.CreatedAt.Equal(time.Date(2019, 1, 1, 11, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, 2, res.Authors)
+	assert.ElementsMatch(t, []importers.Skipped{
+		{Kind: "comment", ID: "13", Reason: "pingback"},
+		{Kind: "comment", ID: "14", Reason: "unapproved"},
+		{Kind: "comment", ID: "15", Reason: "comment cannot be empty"},
+		{Kind: "post", ID: "3", Reason: "status draft"},
+		{Kind: "comment", ID: "30", Reason: "post 3 is not imported"},
+	}, res.Skipped)
+}
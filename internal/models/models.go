@@ -6,20 +6,66 @@ import (
 
 type Post struct {
 	ID              string    `json:"id" db:"id"`
+	SiteID          string    `json:"siteId" db:"site_id"`
 	Title           string    `json:"title" db:"title"`
 	Content         string    `json:"content" db:"content"`
 	Author          string    `json:"author" db:"author"`
 	CommentsEnabled bool      `json:"commentsEnabled" db:"comments_enabled"`
 	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	Version         int       `json:"version" db:"version"`
+	// CommentCount and RootCommentCount are maintained by the storage along
+	// with the comments themselves; they are not part of the version.
+	CommentCount     int `json:"commentCount" db:"comment_count"`
+	RootCommentCount int `json:"rootCommentCount" db:"root_comment_count"`
 }
 
 type Comment struct {
-	ID        string    `json:"id" db:"id"`
-	PostID    string    `json:"postId" db:"post_id"`
+	ID     string `json:"id" db:"id"`
+	PostID string `json:"postId" db:"post_id"`
+	// SiteID is the site of the post, copied by the storage on insert.
+	SiteID    string    `json:"siteId" db:"site_id"`
 	ParentID  *string   `json:"parentId,omitempty" db:"parent_id"`
 	Author    string    `json:"author" db:"author"`
 	Content   string    `json:"content" db:"content"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	// Path lists the IDs from the thread root down to this comment and Depth
+	// is the number of ancestors; both are set by the storage on insert.
+	Path  string `json:"path" db:"path"`
+	Depth int    `json:"depth" db:"depth"`
+	// Locked closes the subtree under this comment to new replies.
+	Locked bool `json:"locked" db:"locked"`
+	// Hidden keeps a moderated comment in its thread with the content
+	// withheld from readers; the stored content is kept for unhiding.
+	Hidden bool `json:"hidden" db:"hidden"`
+}
+
+// ModerationMode says whether new comments reach readers at once.
+type ModerationMode string
+
+const (
+	// ModerationOpen publishes comments as they are posted.
+	ModerationOpen ModerationMode = "open"
+	// ModerationPremoderation stores new comments hidden until a moderator
+	// unhides them.
+	ModerationPremoderation ModerationMode = "premoderation"
+)
+
+func (m ModerationMode) IsValid() bool {
+	return m == ModerationOpen || m == ModerationPremoderation
+}
+
+// SiteSettings are the comment settings of one site. Zero fields keep the
+// global value; a negative MaxCommentLength means no length limit.
+type SiteSettings struct {
+	MaxCommentLength int            `json:"maxCommentLength"`
+	Moderation       ModerationMode `json:"moderation"`
+}
+
+// PurgeResult counts what removing the content of an author deleted,
+// including comments of other authors under the removed posts and threads.
+type PurgeResult struct {
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
 }
 
 type CommentsPage struct {
@@ -27,11 +73,27 @@ type CommentsPage struct {
 	Comments []Comment `json:"comments"`
 }
 
+type Presence struct {
+	PostID  string `json:"postId"`
+	Viewers int    `json:"viewers"`
+	Typing  int    `json:"typing"`
+}
+
 type CreatePostInput struct {
 	Title           string `json:"title"`
 	Content         string `json:"content"`
 	Author          string `json:"author"`
 	CommentsEnabled bool   `json:"commentsEnabled"`
+	// ClientMutationID makes retries safe: a repeated create with the same
+	// ID returns the post created the first time.
+	ClientMutationID *string `json:"clientMutationId,omitempty"`
+}
+
+type UpdatePostInput struct {
+	Title           *string `json:"title,omitempty"`
+	Content         *string `json:"content,omitempty"`
+	CommentsEnabled *bool   `json:"commentsEnabled,omitempty"`
+	ExpectedVersion int     `json:"expectedVersion"`
 }
 
 type CreateCommentInput struct {
@@ -39,4 +101,35 @@ type CreateCommentInput struct {
 	ParentID *string `json:"parentId,omitempty"`
 	Author   string  `json:"author"`
 	Content  string  `json:"content"`
+	// ClientMutationID makes retries safe: a repeated create with the same
+	// ID returns the comment created the first time.
+	ClientMutationID *string `json:"clientMutationId,omitempty"`
+}
+
+// CommentFeedFilter narrows the site-wide comment feed. FlaggedOnly selects
+// the comments waiting for moderation instead of the published ones.
+type CommentFeedFilter struct {
+	Author      *string  `json:"author,omitempty"`
+	PostIDs     []string `json:"postIds,omitempty"`
+	FlaggedOnly *bool    `json:"flaggedOnly,omitempty"`
+}
+
+// PostFilter narrows a post listing; unset fields match every post. The
+// createdAfter and createdBefore bounds are exclusive.
+type PostFilter struct {
+	Author          *string    `json:"author,omitempty"`
+	CreatedAfter    *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore   *time.Time `json:"createdBefore,omitempty"`
+	CommentsEnabled *bool      `json:"commentsEnabled,omitempty"`
+	HasComments     *bool      `json:"hasComments,omitempty"`
+}
+
+// CommentFilter narrows the comments of a post. HasParent selects replies
+// when true; when unset or false only root comments are listed, as before
+// filters existed.
+type CommentFilter struct {
+	Author        *string    `json:"author,omitempty"`
+	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+	HasParent     *bool      `json:"hasParent,omitempty"`
 }
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type SearchType string
+
+const (
+	SearchTypePosts    SearchType = "POSTS"
+	SearchTypeComments SearchType = "COMMENTS"
+	SearchTypeAll      SearchType = "ALL"
+)
+
+func (t SearchType) IsValid() bool {
+	switch t {
+	case SearchTypePosts, SearchTypeComments, SearchTypeAll:
+		return true
+	}
+	return false
+}
+
+// IncludesPosts and IncludesComments treat the zero value as ALL.
+func (t SearchType) IncludesPosts() bool {
+	return t != SearchTypeComments
+}
+
+func (t SearchType) IncludesComments() bool {
+	return t != SearchTypePosts
+}
+
+func (t SearchType) String() string {
+	return string(t)
+}
+
+func (t *SearchType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*t = SearchType(str)
+	if !t.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchType", str)
+	}
+	return nil
+}
+
+func (t SearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(t.String()))
+}
+
+// SearchQuery is what storages search for. PostID narrows posts to that post
+// and comments to the ones under it.
+type SearchQuery struct {
+	Query  string
+	Type   SearchType
+	PostID *string
+	Limit  int
+	Offset int
+}
+
+// SearchHit is one result: exactly one of Post and Comment is set. Snippet is
+// an excerpt with matched terms wrapped in <mark></mark>.
+type SearchHit struct {
+	Post    *Post    `json:"post,omitempty"`
+	Comment *Comment `json:"comment,omitempty"`
+	Score   float64  `json:"score"`
+	Snippet string   `json:"snippet"`
+	Cursor  string   `json:"cursor"`
+}
+
+type SearchConnection struct {
+	Hits        []SearchHit `json:"hits"`
+	HasNextPage bool        `json:"hasNextPage"`
+	EndCursor   *string     `json:"endCursor,omitempty"`
+}
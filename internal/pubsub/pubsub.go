@@ -4,33 +4,106 @@ import (
 	"comments-system/internal/models"
 	"context"
 	"sync"
+	"time"
 )
 
+const (
+	defaultTypingTTL        = 5 * time.Second
+	defaultPresenceInterval = time.Second
+)
+
+// PubSub fans comments and presence out per post. Topics are namespaced by
+// site, so a client of one site never hears about posts of another even if
+// it knows their IDs.
 type PubSub struct {
 	mu          sync.RWMutex
-	subscribers map[string]map[chan *models.Comment]struct{}
+	subscribers map[string]map[chan *models.Comment]struct{} // topic -> channels
+	wildcard    map[chan *models.Comment]string              // channel -> site, "" for all
+
+	typingMu sync.Mutex
+	typing   map[string]map[string]time.Time // topic -> key -> expiry
+
+	typingTTL        time.Duration
+	presenceInterval time.Duration
 }
 
-func NewPubSub() *PubSub {
-	return &PubSub{
-		subscribers: make(map[string]map[chan *models.Comment]struct{}),
+type Option func(*PubSub)
+
+// WithTypingTTL sets how long a typing signal counts before it expires.
+func WithTypingTTL(ttl time.Duration) Option {
+	return func(ps *PubSub) {
+		ps.typingTTL = ttl
 	}
 }
 
-func (ps *PubSub) Subscribe(ctx context.Context, postID string) (<-chan *models.Comment, error) {
+// WithPresenceInterval sets how often presence subscribers are refreshed.
+// Changes inside one interval are coalesced into a single update.
+func WithPresenceInterval(interval time.Duration) Option {
+	return func(ps *PubSub) {
+		ps.presenceInterval = interval
+	}
+}
+
+func NewPubSub(opts ...Option) *PubSub {
+	ps := &PubSub{
+		subscribers:      make(map[string]map[chan *models.Comment]struct{}),
+		wildcard:         make(map[chan *models.Comment]string),
+		typing:           make(map[string]map[string]time.Time),
+		typingTTL:        defaultTypingTTL,
+		presenceInterval: defaultPresenceInterval,
+	}
+
+	for _, opt := range opts {
+		opt(ps)
+	}
+
+	return ps
+}
+
+// topic names the channel of post postID of site.
+func topic(site, postID string) string {
+	return site + "/" + postID
+}
+
+func (ps *PubSub) Subscribe(ctx context.Context, site, postID string) (<-chan *models.Comment, error) {
 	ch := make(chan *models.Comment, 10)
+	t := topic(site, postID)
 
 	ps.mu.Lock()
-	if _, ok := ps.subscribers[postID]; !ok {
-		ps.subscribers[postID] = make(map[chan *models.Comment]struct{})
+	if _, ok := ps.subscribers[t]; !ok {
+		ps.subscribers[t] = make(map[chan *models.Comment]struct{})
 	}
-	ps.subscribers[postID][ch] = struct{}{}
+	ps.subscribers[t][ch] = struct{}{}
+	ps.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		ps.mu.Lock()
+		delete(ps.subscribers[t], ch)
+		if len(ps.subscribers[t]) == 0 {
+			delete(ps.subscribers, t)
+		}
+		close(ch)
+		ps.mu.Unlock()
+	}()
+
+	return ch, nil
+}
+
+// SubscribeAll receives comments published for every post of site, or of
+// every site when site is "". Wildcard subscribers are kept apart from
+// per-post ones and are not counted as viewers.
+func (ps *PubSub) SubscribeAll(ctx context.Context, site string) (<-chan *models.Comment, error) {
+	ch := make(chan *models.Comment, 100)
+
+	ps.mu.Lock()
+	ps.wildcard[ch] = site
 	ps.mu.Unlock()
 
 	go func() {
 		<-ctx.Done()
 		ps.mu.Lock()
-		delete(ps.subscribers[postID], ch)
+		delete(ps.wildcard, ch)
 		close(ch)
 		ps.mu.Unlock()
 	}()
@@ -38,11 +111,14 @@ func (ps *PubSub) Subscribe(ctx context.Context, postID string) (<-chan *models.
 	return ch, nil
 }
 
-func (ps *PubSub) Publish(postID string, comment *models.Comment) {
+// Publish sends comment to the subscribers of its post and to wildcard
+// subscribers. A hidden comment, waiting for moderation, only goes to
+// wildcard subscribers, which the moderation feed is read from.
+func (ps *PubSub) Publish(site, postID string, comment *models.Comment) {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 
-	if subs, ok := ps.subscribers[postID]; ok {
+	if subs, ok := ps.subscribers[topic(site, postID)]; ok && !comment.Hidden {
 		for ch := range subs {
 			select {
 			case ch <- comment:
@@ -51,4 +127,102 @@ func (ps *PubSub) Publish(postID string, comment *models.Comment) {
 			}
 		}
 	}
+
+	for ch, chSite := range ps.wildcard {
+		if chSite != "" && chSite != site {
+			continue
+		}
+		select {
+		case ch <- comment:
+		default:
+
+		}
+	}
+}
+
+// SetTyping marks key as typing in the post until the typing TTL elapses.
+// Repeated calls with the same key extend the signal instead of adding to it.
+// Expired signals of the post are dropped on the way, so a post nobody
+// watches does not collect them.
+func (ps *PubSub) SetTyping(site, postID, key string) {
+	t := topic(site, postID)
+
+	ps.typingMu.Lock()
+	defer ps.typingMu.Unlock()
+
+	now := time.Now()
+	ps.sweepTyping(t, now)
+	if _, ok := ps.typing[t]; !ok {
+		ps.typing[t] = make(map[string]time.Time)
+	}
+	ps.typing[t][key] = now.Add(ps.typingTTL)
+}
+
+// sweepTyping drops the typing signals of topic t that expired by now and
+// returns how many are left. The caller holds typingMu.
+func (ps *PubSub) sweepTyping(t string, now time.Time) int {
+	for key, expiresAt := range ps.typing[t] {
+		if !expiresAt.After(now) {
+			delete(ps.typing[t], key)
+		}
+	}
+	typing := len(ps.typing[t])
+	if typing == 0 {
+		delete(ps.typing, t)
+	}
+	return typing
+}
+
+// Presence returns the number of live comment subscribers and unexpired
+// typing signals for the post.
+func (ps *PubSub) Presence(site, postID string) models.Presence {
+	t := topic(site, postID)
+
+	ps.mu.RLock()
+	viewers := len(ps.subscribers[t])
+	ps.mu.RUnlock()
+
+	ps.typingMu.Lock()
+	typing := ps.sweepTyping(t, time.Now())
+	ps.typingMu.Unlock()
+
+	return models.Presence{
+		PostID:  postID,
+		Viewers: viewers,
+		Typing:  typing,
+	}
+}
+
+// SubscribePresence emits the current presence of the post right away and
+// then at most once per presence interval, only when the counts change.
+func (ps *PubSub) SubscribePresence(ctx context.Context, site, postID string) (<-chan *models.Presence, error) {
+	ch := make(chan *models.Presence, 1)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(ps.presenceInterval)
+		defer ticker.Stop()
+
+		var last *models.Presence
+		for {
+			current := ps.Presence(site, postID)
+			if last == nil || *last != current {
+				last = &current
+				select {
+				case ch <- &current:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const site = "blog"
+
 func TestPubSub_SubscribeAndPublish(t *testing.T) {
 	ps := pubsub.NewPubSub()
 	postID := "post1"
@@ -17,11 +19,11 @@ func TestPubSub_SubscribeAndPublish(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	ch, err := ps.Subscribe(ctx, postID)
+	ch, err := ps.Subscribe(ctx, site, postID)
 	assert.NoError(t, err)
 
 	comment := &models.Comment{ID: "comment1", PostID: postID, Content: "Test comment"}
-	ps.Publish(postID, comment)
+	ps.Publish(site, postID, comment)
 
 	select {
 	case receivedComment := <-ch:
@@ -38,7 +40,7 @@ func TestPubSub_Unsubscribe(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	ch, err := ps.Subscribe(ctx, postID)
+	ch, err := ps.Subscribe(ctx, site, postID)
 	assert.NoError(t, err)
 
 	cancel() // Unsubscribe
@@ -57,16 +59,16 @@ func TestPubSub_MultipleSubscribers(t *testing.T) {
 
 	ctx1, cancel1 := context.WithCancel(context.Background())
 	defer cancel1()
-	ch1, err := ps.Subscribe(ctx1, postID)
+	ch1, err := ps.Subscribe(ctx1, site, postID)
 	assert.NoError(t, err)
 
 	ctx2, cancel2 := context.WithCancel(context.Background())
 	defer cancel2()
-	ch2, err := ps.Subscribe(ctx2, postID)
+	ch2, err := ps.Subscribe(ctx2, site, postID)
 	assert.NoError(t, err)
 
 	comment := &models.Comment{ID: "comment1", PostID: postID, Content: "Test comment"}
-	ps.Publish(postID, comment)
+	ps.Publish(site, postID, comment)
 
 	select {
 	case receivedComment := <-ch1:
@@ -90,19 +92,19 @@ func TestPubSub_PublishToMultiplePosts(t *testing.T) {
 
 	ctx1, cancel1 := context.WithCancel(context.Background())
 	defer cancel1()
-	ch1, err := ps.Subscribe(ctx1, postID1)
+	ch1, err := ps.Subscribe(ctx1, site, postID1)
 	assert.NoError(t, err)
 
 	ctx2, cancel2 := context.WithCancel(context.Background())
 	defer cancel2()
-	ch2, err := ps.Subscribe(ctx2, postID2)
+	ch2, err := ps.Subscribe(ctx2, site, postID2)
 	assert.NoError(t, err)
 
 	comment1 := &models.Comment{ID: "comment1", PostID: postID1, Content: "Test comment 1"}
-	ps.Publish(postID1, comment1)
+	ps.Publish(site, postID1, comment1)
 
 	comment2 := &models.Comment{ID: "comment2", PostID: postID2, Content: "Test comment 2"}
-	ps.Publish(postID2, comment2)
+	ps.Publish(site, postID2, comment2)
 
 	select {
 	case receivedComment := <-ch1:
@@ -124,7 +126,7 @@ func TestPubSub_PublishWithoutSubscribers(t *testing.T) {
 	postID := "post1"
 
 	comment := &models.Comment{ID: "comment1", PostID: postID, Content: "Test comment"}
-	ps.Publish(postID, comment)
+	ps.Publish(site, postID, comment)
 
 }
 
@@ -135,12 +137,12 @@ func TestPubSub_BufferedChannel(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	ch, err := ps.Subscribe(ctx, postID)
+	ch, err := ps.Subscribe(ctx, site, postID)
 	assert.NoError(t, err)
 
 	for i := 0; i < 10; i++ {
 		comment := &models.Comment{ID: string(rune(i)), PostID: postID, Content: "Test comment"}
-		ps.Publish(postID, comment)
+		ps.Publish(site, postID, comment)
 	}
 
 	for i := 0; i < 10; i++ {
@@ -153,3 +155,176 @@ func TestPubSub_BufferedChannel(t *testing.T) {
 		}
 	}
 }
+
+func TestPubSub_PresenceCountsViewers(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	postID := "post1"
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	_, err := ps.Subscribe(ctx1, site, postID)
+	assert.NoError(t, err)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	_, err = ps.Subscribe(ctx2, site, postID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, ps.Presence(site, postID).Viewers)
+
+	cancel2()
+	assert.Eventually(t, func() bool {
+		return ps.Presence(site, postID).Viewers == 1
+	}, 100*time.Millisecond, 5*time.Millisecond)
+}
+
+func TestPubSub_TypingExpires(t *testing.T) {
+	ps := pubsub.NewPubSub(pubsub.WithTypingTTL(20 * time.Millisecond))
+	postID := "post1"
+
+	ps.SetTyping(site, postID, "user1")
+	ps.SetTyping(site, postID, "user1")
+	ps.SetTyping(site, postID, "user2")
+
+	assert.Equal(t, 2, ps.Presence(site, postID).Typing)
+
+	assert.Eventually(t, func() bool {
+		return ps.Presence(site, postID).Typing == 0
+	}, 200*time.Millisecond, 5*time.Millisecond)
+}
+
+func TestPubSub_TypingAfterExpiry(t *testing.T) {
+	ps := pubsub.NewPubSub(pubsub.WithTypingTTL(20 * time.Millisecond))
+	postID := "post1"
+
+	ps.SetTyping(site, postID, "user1")
+	ps.SetTyping(site, postID, "user2")
+	time.Sleep(30 * time.Millisecond)
+	ps.SetTyping(site, postID, "user3")
+
+	assert.Equal(t, 1, ps.Presence(site, postID).Typing)
+}
+
+func TestPubSub_SubscribePresence(t *testing.T) {
+	ps := pubsub.NewPubSub(pubsub.WithPresenceInterval(10 * time.Millisecond))
+	postID := "post1"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := ps.SubscribePresence(ctx, site, postID)
+	assert.NoError(t, err)
+
+	select {
+	case presence := <-ch:
+		assert.Equal(t, models.Presence{PostID: postID}, *presence)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Timeout waiting for initial presence")
+	}
+
+	viewerCtx, viewerCancel := context.WithCancel(context.Background())
+	defer viewerCancel()
+	_, err = ps.Subscribe(viewerCtx, site, postID)
+	assert.NoError(t, err)
+	ps.SetTyping(site, postID, "user1")
+
+	expected := models.Presence{PostID: postID, Viewers: 1, Typing: 1}
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case presence := <-ch:
+			if *presence == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timeout waiting for presence update")
+		}
+	}
+}
+
+func TestPubSub_SubscribeAll(t *testing.T) {
+	ps := pubsub.NewPubSub()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := ps.SubscribeAll(ctx, "")
+	assert.NoError(t, err)
+
+	comment1 := &models.Comment{ID: "comment1", PostID: "post1", Content: "Test comment 1"}
+	ps.Publish(site, "post1", comment1)
+
+	comment2 := &models.Comment{ID: "comment2", PostID: "post2", Content: "Test comment 2"}
+	ps.Publish(site, "post2", comment2)
+
+	for _, expected := range []*models.Comment{comment1, comment2} {
+		select {
+		case receivedComment := <-ch:
+			assert.Equal(t, expected, receivedComment)
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("Timeout waiting for comment %s", expected.ID)
+		}
+	}
+
+	assert.Equal(t, 0, ps.Presence(site, "post1").Viewers)
+}
+
+func TestPubSub_HiddenOnlyToWildcard(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	postID := "post1"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := ps.Subscribe(ctx, site, postID)
+	assert.NoError(t, err)
+	feed, err := ps.SubscribeAll(ctx, site)
+	assert.NoError(t, err)
+
+	hidden := &models.Comment{ID: "comment1", PostID: postID, Content: "Waiting", Hidden: true}
+	ps.Publish(site, postID, hidden)
+
+	select {
+	case receivedComment := <-feed:
+		assert.Equal(t, hidden, receivedComment)
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("Timeout waiting for comment")
+	}
+
+	select {
+	case receivedComment := <-ch:
+		t.Errorf("Post subscriber received hidden comment %s", receivedComment.ID)
+	default:
+	}
+}
+
+func TestPubSub_SitesAreIsolated(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	postID := "post1"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := ps.Subscribe(ctx, site, postID)
+	assert.NoError(t, err)
+	siteFeed, err := ps.SubscribeAll(ctx, site)
+	assert.NoError(t, err)
+	allFeed, err := ps.SubscribeAll(ctx, "")
+	assert.NoError(t, err)
+
+	ps.SetTyping("shop", postID, "user1")
+	ps.Publish("shop", postID, &models.Comment{ID: "comment1", PostID: postID})
+
+	// Publish delivers synchronously, so once the feed of all sites has the
+	// comment the other channels would have it too.
+	select {
+	case receivedComment := <-allFeed:
+		assert.Equal(t, "comment1", receivedComment.ID)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Timeout waiting for comment on the feed of all sites")
+	}
+	assert.Empty(t, ch)
+	assert.Empty(t, siteFeed)
+
+	assert.Equal(t, models.Presence{PostID: postID, Viewers: 1}, ps.Presence(site, postID))
+	assert.Equal(t, models.Presence{PostID: postID, Typing: 1}, ps.Presence("shop", postID))
+}
@@ -0,0 +1,297 @@
+// Package seed generates synthetic posts and comments for load tests,
+// benchmarks and demos. The data depends only on the Config, so a dataset
+// can be reproduced from its seed.
+package seed
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Config describes a dataset.
+type Config struct {
+	Seed  uint64
+	Posts int
+	// MaxComments caps the comments of one post. Counts follow a power law
+	// with exponent CommentSkew (> 1): most posts get a few comments and a
+	// few posts get most of them.
+	MaxComments int
+	CommentSkew float64
+	// ReplyRatio is the share of comments that answer another comment.
+	// A reply descends from a random root one level at a time with
+	// probability DepthDecay, to at most MaxDepth levels below the roots.
+	ReplyRatio float64
+	DepthDecay float64
+	MaxDepth   int
+	// Authors is the size of the author pool; activity in it follows a
+	// power law with exponent AuthorSkew (> 1).
+	Authors    int
+	AuthorSkew float64
+	// ClosedRatio is the share of posts with comments disabled.
+	ClosedRatio float64
+	// Posts are spread evenly over Span before Until. Comments come
+	// CommentDelay after what they answer on average, most of them soon.
+	Until        time.Time
+	Span         time.Duration
+	CommentDelay time.Duration
+}
+
+// DefaultConfig returns a modest dataset: 100 posts with about 5000
+// comments from 50 authors over a year.
+func DefaultConfig() Config {
+	return Config{
+		Seed:         1,
+		Posts:        100,
+		MaxComments:  500,
+		CommentSkew:  1.2,
+		ReplyRatio:   0.6,
+		DepthDecay:   0.5,
+		MaxDepth:     8,
+		Authors:      50,
+		AuthorSkew:   1.1,
+		ClosedRatio:  0.1,
+		Until:        time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Span:         365 * 24 * time.Hour,
+		CommentDelay: 12 * time.Hour,
+	}
+}
+
+func (cfg Config) validate() error {
+	switch {
+	case cfg.Posts < 0 || cfg.MaxComments < 0 || cfg.MaxDepth < 0:
+		return errors.New("posts, max comments and max depth cannot be negative")
+	case cfg.Authors < 1:
+		return errors.New("at least one author is needed")
+	case cfg.CommentSkew <= 1 || cfg.AuthorSkew <= 1:
+		return errors.New("skews must be greater than 1")
+	case cfg.ReplyRatio < 0 || cfg.ReplyRatio > 1 || cfg.DepthDecay < 0 || cfg.DepthDecay > 1 ||
+		cfg.ClosedRatio < 0 || cfg.ClosedRatio > 1:
+		return errors.New("ratios must be between 0 and 1")
+	case cfg.Span < 0 || cfg.CommentDelay < 0:
+		return errors.New("durations cannot be negative")
+	}
+	return nil
+}
+
+// Stats describes a generated dataset.
+type Stats struct {
+	Posts    int
+	Comments int
+	// MaxComments is the most comments one post got, and MaxDepth the
+	// deepest reply.
+	MaxComments int
+	MaxDepth    int
+}
+
+// Generator yields the posts of a dataset one at a time.
+type Generator struct {
+	cfg      Config
+	r        *rand.Rand
+	comments *rand.Zipf
+	authors  *rand.Zipf
+
+	next int
+	ids  map[int64]bool
+}
+
+func NewGenerator(cfg Config) (*Generator, error) {
+	const op = "seed.NewGenerator"
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x9e3779b97f4a7c15))
+	return &Generator{
+		cfg:      cfg,
+		r:        r,
+		comments: rand.NewZipf(r, cfg.CommentSkew, 1, uint64(cfg.MaxComments)),
+		authors:  rand.NewZipf(r, cfg.AuthorSkew, 1, uint64(cfg.Authors-1)),
+		ids:      make(map[int64]bool),
+	}, nil
+}
+
+// node is a generated comment with what picking a parent needs.
+type node struct {
+	comment  models.Comment
+	children []int
+}
+
+// Next returns the next post with its comments, parents before replies,
+// and false once all posts have been generated.
+func (g *Generator) Next() (models.Post, []models.Comment, bool) {
+	if g.next >= g.cfg.Posts {
+		return models.Post{}, nil, false
+	}
+
+	// Posts are evenly spaced, oldest first, with some jitter.
+	step := g.cfg.Span / time.Duration(max(g.cfg.Posts, 1))
+	createdAt := g.cfg.Until.Add(-g.cfg.Span).Add(step*time.Duration(g.next) + g.jitter(step)).Truncate(time.Microsecond)
+	g.next++
+
+	post := models.Post{
+		ID:              g.newID(createdAt),
+		Title:           g.sentence(3, 8),
+		Content:         g.paragraphs(1, 4),
+		Author:          g.author(),
+		CommentsEnabled: g.r.Float64() >= g.cfg.ClosedRatio,
+		CreatedAt:       createdAt,
+		Version:         1,
+	}
+
+	n := int(g.comments.Uint64())
+	nodes := make([]node, 0, n)
+	var roots []int
+	for i := 0; i < n; i++ {
+		var parent *node
+		if len(roots) > 0 && g.r.Float64() < g.cfg.ReplyRatio {
+			parent = g.pickParent(nodes, roots)
+		}
+
+		after := post.CreatedAt
+		comment := models.Comment{PostID: post.ID, Author: g.author(), Content: g.paragraphs(1, 2)}
+		if parent != nil {
+			after = parent.comment.CreatedAt
+			comment.ParentID = &parent.comment.ID
+			comment.Depth = parent.comment.Depth + 1
+			parent.children = append(parent.children, i)
+		} else {
+			roots = append(roots, i)
+		}
+		comment.CreatedAt = g.delay(after)
+		comment.ID = g.newID(comment.CreatedAt)
+
+		nodes = append(nodes, node{comment: comment})
+	}
+
+	comments := make([]models.Comment, len(nodes))
+	for i, n := range nodes {
+		comments[i] = n.comment
+	}
+	return post, comments, true
+}
+
+// pickParent walks down from a random root, going one level deeper with
+// probability DepthDecay while the reply would stay within MaxDepth.
+func (g *Generator) pickParent(nodes []node, roots []int) *node {
+	cur := &nodes[roots[g.r.IntN(len(roots))]]
+	for cur.comment.Depth+1 < g.cfg.MaxDepth && len(cur.children) > 0 && g.r.Float64() < g.cfg.DepthDecay {
+		cur = &nodes[cur.children[g.r.IntN(len(cur.children))]]
+	}
+	if cur.comment.Depth >= g.cfg.MaxDepth {
+		return nil
+	}
+	return cur
+}
+
+// delay returns a time after t, exponentially distributed around
+// CommentDelay and no later than Until.
+func (g *Generator) delay(t time.Time) time.Time {
+	d := time.Duration(g.r.ExpFloat64() * float64(g.cfg.CommentDelay))
+	if t = t.Add(max(d, time.Second)); t.After(g.cfg.Until) {
+		t = g.cfg.Until
+	}
+	return t.Truncate(time.Microsecond)
+}
+
+func (g *Generator) jitter(step time.Duration) time.Duration {
+	if step <= 0 {
+		return 0
+	}
+	return time.Duration(g.r.Int64N(int64(step))).Truncate(time.Microsecond)
+}
+
+func (g *Generator) author() string {
+	return fmt.Sprintf("user%03d", g.authors.Uint64()+1)
+}
+
+// newID returns an ID in the format of utils.GenerateID for t, bumped
+// forward while it is taken, so sibling comments keep their order in paths.
+func (g *Generator) newID(t time.Time) string {
+	n := t.UnixNano()
+	for g.ids[n] {
+		n++
+	}
+	g.ids[n] = true
+	return fmt.Sprintf("%x", n)
+}
+
+var words = strings.Fields(`
+	lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod
+	tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam
+	quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo
+	consequat duis aute irure in reprehenderit voluptate velit esse cillum
+	eu fugiat nulla pariatur excepteur sint occaecat cupidatat non proident
+	sunt culpa qui officia deserunt mollit anim id est laborum golang
+	storage comment thread reply post cache index query latency benchmark`)
+
+func (g *Generator) sentence(minWords, maxWords int) string {
+	n := minWords + g.r.IntN(maxWords-minWords+1)
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = words[g.r.IntN(len(words))]
+	}
+	parts[0] = strings.ToUpper(parts[0][:1]) + parts[0][1:]
+	return strings.Join(parts, " ")
+}
+
+func (g *Generator) paragraphs(minCount, maxCount int) string {
+	n := minCount + g.r.IntN(maxCount-minCount+1)
+	paras := make([]string, n)
+	for i := range paras {
+		sentences := make([]string, 1+g.r.IntN(4))
+		for j := range sentences {
+			sentences[j] = g.sentence(4, 14) + "."
+		}
+		paras[i] = strings.Join(sentences, " ")
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// Load generates the dataset of cfg into s, one transaction per post. It
+// uses storage.ImportStorage, so s must not hold posts or comments with the
+// generated IDs yet.
+func Load(ctx context.Context, s storage.Storage, cfg Config) (Stats, error) {
+	const op = "seed.Load"
+
+	g, err := NewGenerator(cfg)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+	for {
+		post, comments, ok := g.Next()
+		if !ok {
+			return stats, nil
+		}
+
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			if err := tx.ImportPost(ctx, post); err != nil {
+				return err
+			}
+			for _, comment := range comments {
+				if err := tx.ImportComment(ctx, comment); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("%s: post %d: %w", op, stats.Posts+1, err)
+		}
+
+		stats.Posts++
+		stats.Comments += len(comments)
+		stats.MaxComments = max(stats.MaxComments, len(comments))
+		for _, comment := range comments {
+			stats.MaxDepth = max(stats.MaxDepth, comment.Depth)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package seed_test
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/seed"
+	"comments-system/internal/storage/inmemory"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generate(t *testing.T, cfg seed.Config) ([]models.Post, [][]models.Comment) {
+	t.Helper()
+
+	g, err := seed.NewGenerator(cfg)
+	require.NoError(t, err)
+
+	var posts []models.Post
+	var comments [][]models.Comment
+	for {
+		post, cs, ok := g.Next()
+		if !ok {
+			return posts, comments
+		}
+		posts = append(posts, post)
+		comments = append(comments, cs)
+	}
+}
+
+func TestGenerator_Deterministic(t *testing.T) {
+	cfg := seed.DefaultConfig()
+	cfg.Posts = 20
+
+	posts, comments := generate(t, cfg)
+	again, againComments := generate(t, cfg)
+	assert.Equal(t, posts, again)
+	assert.Equal(t, comments, againComments)
+
+	cfg.Seed++
+	other, _ := generate(t, cfg)
+	assert.NotEqual(t, posts, other)
+}
+
+func TestGenerator_Shape(t *testing.T) {
+	cfg := seed.DefaultConfig()
+	cfg.Posts = 50
+	cfg.MaxComments = 200
+	cfg.MaxDepth = 3
+	cfg.DepthDecay = 0.9
+	cfg.Authors = 5
+
+	posts, comments := generate(t, cfg)
+	require.Len(t, posts, cfg.Posts)
+
+	authors := map[string]bool{"user001": true, "user002": true, "user003": true, "user004": true, "user005": true}
+	total := 0
+	for i, post := range posts {
+		assert.True(t, authors[post.Author], post.Author)
+		assert.False(t, post.CreatedAt.After(cfg.Until))
+		assert.False(t, post.CreatedAt.Before(cfg.Until.Add(-cfg.Span)))
+		if i > 0 {
+			assert.True(t, post.CreatedAt.After(posts[i-1].CreatedAt))
+		}
+
+		assert.LessOrEqual(t, len(comments[i]), cfg.MaxComments)
+		total += len(comments[i])
+
+		byID := make(map[string]models.Comment)
+		for _, c := range comments[i] {
+			assert.Equal(t, post.ID, c.PostID)
+			assert.True(t, authors[c.Author], c.Author)
+			assert.LessOrEqual(t, c.Depth, cfg.MaxDepth)
+			assert.True(t, c.CreatedAt.After(post.CreatedAt))
+			if c.ParentID != nil {
+				parent, ok := byID[*c.ParentID]
+				require.True(t, ok, "reply before its parent")
+				assert.Equal(t, parent.Depth+1, c.Depth)
+				assert.False(t, c.CreatedAt.Before(parent.CreatedAt))
+			}
+			byID[c.ID] = c
+		}
+	}
+
+	// Power-law counts: the busiest post holds far more than its share.
+	busiest := 0
+	for _, cs := range comments {
+		busiest = max(busiest, len(cs))
+	}
+	assert.Greater(t, busiest, 3*total/cfg.Posts)
+}
+
+func TestNewGenerator_Invalid(t *testing.T) {
+	cfg := seed.DefaultConfig()
+	cfg.CommentSkew = 1
+
+	_, err := seed.NewGenerator(cfg)
+	require.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	s := inmemory.NewInMemory()
+
+	cfg := seed.DefaultConfig()
+	cfg.Posts = 10
+
+	stats, err := seed.Load(ctx, s, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 10, stats.Posts)
+
+	_, comments := generate(t, cfg)
+	total := 0
+	for _, cs := range comments {
+		total += len(cs)
+	}
+	assert.Equal(t, total, stats.Comments)
+
+	posts, err := s.GetPosts(ctx, models.PostFilter{}, 100, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 10)
+
+	counted := 0
+	for _, post := range posts {
+		counted += post.CommentCount
+	}
+	assert.Equal(t, total, counted)
+
+	fixed, err := s.RecountComments(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, fixed)
+
+	// The same dataset cannot be loaded twice.
+	_, err = seed.Load(ctx, s, cfg)
+	require.Error(t, err)
+}
@@ -3,52 +3,38 @@ package service
 import (
 	"comments-system/internal/models"
 	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
 	"comments-system/pkg/errors"
 	"comments-system/pkg/logger/sl"
 	"comments-system/pkg/utils"
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 )
 
 type commentService struct {
 	storage storage.Storage
 	log     *slog.Logger
+	opts    options
 }
 
-func NewCommentService(storage storage.Storage, log *slog.Logger) CommentService {
+func NewCommentService(storage storage.Storage, log *slog.Logger, opts ...Option) CommentService {
 	return &commentService{
 		storage: storage,
 		log:     log,
+		opts:    newOptions(opts),
 	}
 }
 
-func (cs *commentService) CreateComment(ctx context.Context, input models.CreateCommentInput) (models.Comment, error) {
+func (cs *commentService) CreateComment(ctx context.Context, input models.CreateCommentInput) (models.Comment, bool, error) {
 	const op = "service.commentService.CreateComment"
 	log := cs.log.With(slog.String("op", op))
 
-	if err := utils.ValidateComment(input.Content); err != nil {
+	settings := cs.opts.settingsFor(ctx)
+	if err := utils.ValidateComment(input.Content, settings.MaxCommentLength); err != nil {
 		log.Error("Invalid comment content", sl.Err(err))
-		return models.Comment{}, fmt.Errorf("%s: %w", op, err)
-	}
-
-	post, err := cs.storage.GetPost(ctx, input.PostID)
-	if err != nil {
-		log.Error("Failed to get post", sl.Err(err), "postID", input.PostID)
-		return models.Comment{}, fmt.Errorf("%s: %w", op, err)
-	}
-
-	if !post.CommentsEnabled {
-		log.Warn("Comments disabled for post", "postID", input.PostID)
-		return models.Comment{}, errors.ErrCommentsDisabled
-	}
-
-	if input.ParentID != nil {
-		_, err := cs.storage.GetComment(ctx, *input.ParentID)
-		if err != nil {
-			log.Error("Parent comment not found", sl.Err(err), "parentID", *input.ParentID)
-			return models.Comment{}, fmt.Errorf("%s: %w", op, errors.ErrParentNotFound)
-		}
+		return models.Comment{}, false, fmt.Errorf("%s: %w", op, err)
 	}
 
 	comment := models.Comment{
@@ -56,36 +42,134 @@ func (cs *commentService) CreateComment(ctx context.Context, input models.Create
 		ParentID: input.ParentID,
 		Author:   input.Author,
 		Content:  input.Content,
+		// Premoderated comments wait hidden until a moderator shows them.
+		Hidden: settings.Moderation == models.ModerationPremoderation,
 	}
 
-	createdComment, err := cs.storage.CreateComment(ctx, comment)
+	key := idempotencyKey(ctx, "comment", input.ClientMutationID)
+
+	var createdComment models.Comment
+	replayed := false
+	err := cs.storage.WithTx(ctx, func(tx storage.Storage) error {
+		// A replay returns the original comment even if the post has since
+		// been closed for comments.
+		if key != "" {
+			id, ok, err := replayedID(ctx, tx, key)
+			if err != nil {
+				log.Error("Failed to look up idempotency key", sl.Err(err), "key", key)
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if ok {
+				createdComment, err = tx.GetComment(ctx, id)
+				if err != nil {
+					return fmt.Errorf("%s: failed to get replayed comment: %w", op, err)
+				}
+				replayed = true
+				return nil
+			}
+		}
+
+		post, err := tx.GetPost(ctx, input.PostID)
+		if err != nil {
+			log.Error("Failed to get post", sl.Err(err), "postID", input.PostID)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if !post.CommentsEnabled {
+			log.Warn("Comments disabled for post", "postID", input.PostID)
+			return errors.ErrCommentsDisabled
+		}
+
+		if input.ParentID != nil {
+			parent, err := tx.GetComment(ctx, *input.ParentID)
+			if err != nil {
+				log.Error("Parent comment not found", sl.Err(err), "parentID", *input.ParentID)
+				return fmt.Errorf("%s: %w", op, errors.ErrParentNotFound)
+			}
+
+			if limit := cs.opts.maxReplyDepth; limit > 0 && parent.Depth+1 > limit {
+				log.Warn("Reply too deep", "parentID", parent.ID, "depth", parent.Depth+1, "max", limit)
+				return fmt.Errorf("%s: %w", op, errors.ErrMaxDepthExceeded)
+			}
+
+			locked, err := tx.IsThreadLocked(ctx, parent.ID)
+			if err != nil {
+				log.Error("Failed to check thread lock", sl.Err(err), "parentID", parent.ID)
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if locked {
+				log.Warn("Thread locked", "parentID", parent.ID)
+				return fmt.Errorf("%s: %w", op, errors.ErrThreadLocked)
+			}
+		}
+
+		createdComment, err = tx.CreateComment(ctx, comment)
+		if err != nil {
+			log.Error("Failed to create comment", sl.Err(err), "input", input)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if key != "" {
+			expiresAt := time.Now().Add(cs.opts.idempotencyTTL)
+			if err := tx.SaveIdempotencyKey(ctx, key, createdComment.ID, expiresAt); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		return nil
+	})
+	if errors.Is(err, errors.ErrIdempotencyKeyExists) {
+		// A concurrent request with the same key committed first. Its comment
+		// is read in a transaction, which sees the primary and not a replica
+		// that may lag behind it.
+		err = cs.storage.WithTx(ctx, func(tx storage.Storage) error {
+			id, ok, err := replayedID(ctx, tx, key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if !ok {
+				log.Warn("Idempotency key expired before replay", "key", key)
+				return fmt.Errorf("%s: %w", op, errors.ErrIdempotencyKeyExists)
+			}
+			createdComment, err = tx.GetComment(ctx, id)
+			if err != nil {
+				return fmt.Errorf("%s: failed to get replayed comment: %w", op, err)
+			}
+			return nil
+		})
+		replayed = true
+	}
 	if err != nil {
-		log.Error("Failed to create comment", sl.Err(err), "input", input)
-		return models.Comment{}, fmt.Errorf("%s: %w", op, err)
+		return models.Comment{}, false, err
+	}
+
+	if replayed {
+		log.Info("Comment create replayed", "id", createdComment.ID, "key", key)
+		return createdComment, false, nil
 	}
 
 	log.Info("Comment created", "id", createdComment.ID, "postID", input.PostID)
-	return createdComment, nil
+	return createdComment, true, nil
 }
 
-func (cs *commentService) GetComments(ctx context.Context, postID string, limit, offset int) ([]models.Comment, int, error) {
+func (cs *commentService) GetComments(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, int, error) {
 	const op = "service.commentService.GetComments"
 	log := cs.log.With(slog.String("op", op))
 
-	comments, err := cs.storage.GetCommentsByPost(ctx, postID, limit, offset)
+	comments, err := cs.storage.GetCommentsByPost(ctx, postID, filter, limit, offset)
 	if err != nil {
-		log.Error("Failed to get comments", sl.Err(err), "postID", postID)
+		log.Error("Failed to get comments", sl.Err(err), "postID", postID, "filter", filter)
 		return nil, 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	total, err := cs.storage.CountCommentsByPost(ctx, postID)
+	total, err := cs.storage.CountCommentsByPost(ctx, postID, filter)
 	if err != nil {
 		log.Error("Failed to count comments", sl.Err(err), "postID", postID)
 		return nil, 0, fmt.Errorf("%s: %w", op, err)
 	}
 
 	log.Info("Comments retrieved", "postID", postID, "count", len(comments), "total", total)
-	return comments, total, nil
+	return withholdHidden(comments), total, nil
 }
 
 func (cs *commentService) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
@@ -99,7 +183,7 @@ func (cs *commentService) GetCommentReplies(ctx context.Context, parentID string
 	}
 
 	log.Info("Comment replies retrieved", "parentID", parentID, "count", len(replies))
-	return replies, nil
+	return withholdHidden(replies), nil
 }
 
 func (cs *commentService) GetComment(ctx context.Context, id string) (models.Comment, error) {
@@ -113,5 +197,80 @@ func (cs *commentService) GetComment(ctx context.Context, id string) (models.Com
 	}
 
 	log.Info("Comment retrieved", "id", id)
-	return comment, nil
+	return withhold(comment), nil
+}
+
+func (cs *commentService) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	const op = "service.commentService.GetCommentAncestors"
+	log := cs.log.With(slog.String("op", op))
+
+	ancestors, err := cs.storage.GetCommentAncestors(ctx, id)
+	if err != nil {
+		log.Error("Failed to get comment ancestors", sl.Err(err), "id", id)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Debug("Comment ancestors retrieved", "id", id, "depth", len(ancestors))
+	return ancestors, nil
+}
+
+func (cs *commentService) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	const op = "service.commentService.GetCommentSubtree"
+	log := cs.log.With(slog.String("op", op))
+
+	subtree, err := cs.storage.GetCommentSubtree(ctx, id, maxDepth)
+	if err != nil {
+		log.Error("Failed to get comment subtree", sl.Err(err), "id", id, "maxDepth", maxDepth)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Comment subtree retrieved", "id", id, "count", len(subtree))
+	return withholdHidden(subtree), nil
+}
+
+func (cs *commentService) LockThread(ctx context.Context, commentID string) (models.Comment, error) {
+	const op = "service.commentService.LockThread"
+	log := cs.log.With(slog.String("op", op))
+
+	if !tenant.IsModerator(ctx) {
+		log.Warn("Thread lock by non-moderator refused", "commentID", commentID)
+		return models.Comment{}, fmt.Errorf("%s: %w", op, errors.ErrForbidden)
+	}
+
+	var comment models.Comment
+	err := cs.storage.WithTx(ctx, func(tx storage.Storage) error {
+		if err := tx.LockThread(ctx, commentID); err != nil {
+			log.Error("Failed to lock thread", sl.Err(err), "commentID", commentID)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		var err error
+		comment, err = tx.GetComment(ctx, commentID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	log.Info("Thread locked", "commentID", commentID)
+	return withhold(comment), nil
+}
+
+// withhold blanks the content of a hidden comment, which keeps its place in
+// the thread for readers. Moderation tools read the content from storage.
+func withhold(comment models.Comment) models.Comment {
+	if comment.Hidden {
+		comment.Content = ""
+	}
+	return comment
+}
+
+func withholdHidden(comments []models.Comment) []models.Comment {
+	for i := range comments {
+		comments[i] = withhold(comments[i])
+	}
+	return comments
 }
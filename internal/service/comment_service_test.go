@@ -3,7 +3,9 @@ package service_test
 import (
 	"comments-system/internal/models"
 	"comments-system/internal/service"
+	"comments-system/internal/storage"
 	"comments-system/internal/storage/mocks"
+	"comments-system/internal/tenant"
 	"comments-system/pkg/errors"
 	"comments-system/pkg/logger/slogdiscard"
 	"context"
@@ -12,8 +14,19 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+// expectTx makes WithTx run its callback against the mock itself, so the
+// calls made inside the transaction can be set up as usual.
+func expectTx(storageMock *mocks.Storage) {
+	storageMock.On("WithTx", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, fn func(storage.Storage) error) error {
+			return fn(storageMock)
+		},
+	)
+}
+
 func TestCommentService_CreateComment_Success(t *testing.T) {
 	storageMock := &mocks.Storage{}
 	log := slogdiscard.NewDiscardLogger()
@@ -25,6 +38,7 @@ func TestCommentService_CreateComment_Success(t *testing.T) {
 		Content: "Valid content",
 	}
 
+	expectTx(storageMock)
 	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{
 		ID:              "post1",
 		CommentsEnabled: true,
@@ -37,13 +51,159 @@ func TestCommentService_CreateComment_Success(t *testing.T) {
 		CreatedAt: time.Now(),
 	}, nil)
 
-	comment, err := svc.CreateComment(context.Background(), input)
+	comment, created, err := svc.CreateComment(context.Background(), input)
 
 	assert.NoError(t, err)
+	assert.True(t, created)
 	assert.Equal(t, "comment1", comment.ID)
 	storageMock.AssertExpectations(t)
 }
 
+func TestCommentService_CreateComment_Replay(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	key := "retry-1"
+	input := models.CreateCommentInput{
+		PostID:           "post1",
+		Author:           "user1",
+		Content:          "Valid content",
+		ClientMutationID: &key,
+	}
+
+	expectTx(storageMock)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "comment:retry-1").Return("comment1", nil)
+	storageMock.On("GetComment", mock.Anything, "comment1").Return(models.Comment{
+		ID:     "comment1",
+		PostID: "post1",
+	}, nil)
+
+	comment, created, err := svc.CreateComment(context.Background(), input)
+
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "comment1", comment.ID)
+	storageMock.AssertNotCalled(t, "CreateComment", mock.Anything, mock.Anything)
+	storageMock.AssertExpectations(t)
+}
+
+func TestCommentService_CreateComment_SavesIdempotencyKey(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log, service.WithIdempotencyTTL(time.Hour))
+
+	key := "retry-1"
+	input := models.CreateCommentInput{
+		PostID:           "post1",
+		Author:           "user1",
+		Content:          "Valid content",
+		ClientMutationID: &key,
+	}
+
+	expectTx(storageMock)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "comment:retry-1").Return("", errors.ErrNotFound)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", CommentsEnabled: true}, nil)
+	storageMock.On("CreateComment", mock.Anything, mock.Anything).Return(models.Comment{ID: "comment1", PostID: "post1"}, nil)
+	storageMock.On("SaveIdempotencyKey", mock.Anything, "comment:retry-1", "comment1",
+		mock.MatchedBy(func(expiresAt time.Time) bool {
+			return time.Until(expiresAt) > 59*time.Minute && time.Until(expiresAt) <= time.Hour
+		})).Return(nil)
+
+	_, created, err := svc.CreateComment(context.Background(), input)
+
+	assert.NoError(t, err)
+	assert.True(t, created)
+	storageMock.AssertExpectations(t)
+}
+
+func TestCommentService_CreateComment_SiteSettings(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log,
+		service.WithMaxCommentLength(20),
+		service.WithSiteSettings("blog", models.SiteSettings{
+			MaxCommentLength: 10,
+			Moderation:       models.ModerationPremoderation,
+		}),
+	)
+
+	blog := tenant.WithSite(context.Background(), "blog")
+	shop := tenant.WithSite(context.Background(), "shop")
+	long := models.CreateCommentInput{PostID: "post1", Author: "user1", Content: "fifteen chars.."}
+	short := models.CreateCommentInput{PostID: "post1", Author: "user1", Content: "short"}
+
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", CommentsEnabled: true}, nil)
+	storageMock.On("CreateComment", mock.Anything, mock.MatchedBy(func(c models.Comment) bool {
+		return c.Hidden
+	})).Return(models.Comment{ID: "held", Hidden: true}, nil)
+	storageMock.On("CreateComment", mock.Anything, mock.MatchedBy(func(c models.Comment) bool {
+		return !c.Hidden
+	})).Return(models.Comment{ID: "published"}, nil)
+
+	_, _, err := svc.CreateComment(blog, long)
+	assert.ErrorContains(t, err, "exceeds 10 characters")
+
+	comment, _, err := svc.CreateComment(blog, short)
+	require.NoError(t, err)
+	assert.Equal(t, "held", comment.ID, "blog comments are premoderated")
+
+	comment, _, err = svc.CreateComment(shop, long)
+	require.NoError(t, err)
+	assert.Equal(t, "published", comment.ID, "shop keeps the global settings")
+
+	_, _, err = svc.CreateComment(shop, models.CreateCommentInput{
+		PostID: "post1", Author: "user1", Content: "longer than twenty characters",
+	})
+	assert.ErrorContains(t, err, "exceeds 20 characters")
+}
+
+func TestCommentService_CreateComment_SiteWithoutLengthLimit(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log,
+		service.WithMaxCommentLength(10),
+		service.WithSiteSettings("forum", models.SiteSettings{MaxCommentLength: -1}),
+	)
+
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", CommentsEnabled: true}, nil)
+	storageMock.On("CreateComment", mock.Anything, mock.Anything).Return(models.Comment{ID: "comment1"}, nil)
+
+	long := models.CreateCommentInput{PostID: "post1", Author: "user1", Content: "longer than ten characters"}
+
+	_, _, err := svc.CreateComment(tenant.WithSite(context.Background(), "forum"), long)
+	require.NoError(t, err)
+
+	_, _, err = svc.CreateComment(tenant.WithSite(context.Background(), "shop"), long)
+	assert.ErrorContains(t, err, "exceeds 10 characters")
+}
+
+func TestCommentService_CreateComment_IdempotencyKeyPerSite(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	key := "retry-1"
+	input := models.CreateCommentInput{
+		PostID:           "post1",
+		Author:           "user1",
+		Content:          "Valid content",
+		ClientMutationID: &key,
+	}
+
+	expectTx(storageMock)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "blog:comment:retry-1").Return("comment1", nil)
+	storageMock.On("GetComment", mock.Anything, "comment1").Return(models.Comment{ID: "comment1", PostID: "post1"}, nil)
+
+	_, created, err := svc.CreateComment(tenant.WithSite(context.Background(), "blog"), input)
+
+	assert.NoError(t, err)
+	assert.False(t, created)
+	storageMock.AssertExpectations(t)
+}
+
 func TestCommentService_CreateComment_CommentsDisabled(t *testing.T) {
 	storageMock := &mocks.Storage{}
 	log := slogdiscard.NewDiscardLogger()
@@ -55,16 +215,65 @@ func TestCommentService_CreateComment_CommentsDisabled(t *testing.T) {
 		Content: "Invalid content",
 	}
 
+	expectTx(storageMock)
 	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{
 		CommentsEnabled: false,
 	}, nil)
 
-	_, err := svc.CreateComment(context.Background(), input)
+	_, _, err := svc.CreateComment(context.Background(), input)
 
 	assert.ErrorIs(t, err, errors.ErrCommentsDisabled)
 	storageMock.AssertExpectations(t)
 }
 
+func TestCommentService_CreateComment_MaxDepthExceeded(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log, service.WithMaxReplyDepth(2))
+
+	parentID := "comment1"
+	input := models.CreateCommentInput{
+		PostID:   "post1",
+		ParentID: &parentID,
+		Author:   "user1",
+		Content:  "Too deep",
+	}
+
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", CommentsEnabled: true}, nil)
+	storageMock.On("GetComment", mock.Anything, "comment1").Return(models.Comment{ID: "comment1", Depth: 2}, nil)
+
+	_, _, err := svc.CreateComment(context.Background(), input)
+
+	assert.ErrorIs(t, err, errors.ErrMaxDepthExceeded)
+	storageMock.AssertNotCalled(t, "CreateComment", mock.Anything, mock.Anything)
+}
+
+func TestCommentService_CreateComment_ThreadLocked(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	parentID := "comment1"
+	input := models.CreateCommentInput{
+		PostID:   "post1",
+		ParentID: &parentID,
+		Author:   "user1",
+		Content:  "Reply",
+	}
+
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", CommentsEnabled: true}, nil)
+	storageMock.On("GetComment", mock.Anything, "comment1").Return(models.Comment{ID: "comment1", Depth: 1}, nil)
+	storageMock.On("IsThreadLocked", mock.Anything, "comment1").Return(true, nil)
+
+	_, _, err := svc.CreateComment(context.Background(), input)
+
+	assert.ErrorIs(t, err, errors.ErrThreadLocked)
+	storageMock.AssertNotCalled(t, "CreateComment", mock.Anything, mock.Anything)
+	storageMock.AssertExpectations(t)
+}
+
 func TestCommentService_GetComments_Success(t *testing.T) {
 	storageMock := &mocks.Storage{}
 	log := slogdiscard.NewDiscardLogger()
@@ -75,10 +284,10 @@ func TestCommentService_GetComments_Success(t *testing.T) {
 		{ID: "comment2", PostID: "post1"},
 	}
 
-	storageMock.On("GetCommentsByPost", mock.Anything, "post1", 10, 0).Return(comments, nil)
-	storageMock.On("CountCommentsByPost", mock.Anything, "post1").Return(2, nil)
+	storageMock.On("GetCommentsByPost", mock.Anything, "post1", models.CommentFilter{}, 10, 0).Return(comments, nil)
+	storageMock.On("CountCommentsByPost", mock.Anything, "post1", models.CommentFilter{}).Return(2, nil)
 
-	result, total, err := svc.GetComments(context.Background(), "post1", 10, 0)
+	result, total, err := svc.GetComments(context.Background(), "post1", models.CommentFilter{}, 10, 0)
 
 	assert.NoError(t, err)
 	assert.Len(t, result, 2)
@@ -86,6 +295,49 @@ func TestCommentService_GetComments_Success(t *testing.T) {
 	storageMock.AssertExpectations(t)
 }
 
+func TestCommentService_GetComments_Filtered(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	author, replies := "alice", true
+	filter := models.CommentFilter{Author: &author, HasParent: &replies}
+	comments := []models.Comment{{ID: "comment1", PostID: "post1", Author: author}}
+
+	storageMock.On("GetCommentsByPost", mock.Anything, "post1", filter, 10, 0).Return(comments, nil)
+	storageMock.On("CountCommentsByPost", mock.Anything, "post1", filter).Return(1, nil)
+
+	result, total, err := svc.GetComments(context.Background(), "post1", filter, 10, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, comments, result)
+	assert.Equal(t, 1, total)
+	storageMock.AssertExpectations(t)
+}
+
+func TestCommentService_GetComments_WithholdsHidden(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	comments := []models.Comment{
+		{ID: "comment1", PostID: "post1", Content: "Visible"},
+		{ID: "comment2", PostID: "post1", Content: "Moderated", Hidden: true},
+	}
+
+	storageMock.On("GetCommentsByPost", mock.Anything, "post1", models.CommentFilter{}, 10, 0).Return(comments, nil)
+	storageMock.On("CountCommentsByPost", mock.Anything, "post1", models.CommentFilter{}).Return(2, nil)
+
+	result, _, err := svc.GetComments(context.Background(), "post1", models.CommentFilter{}, 10, 0)
+
+	assert.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, "Visible", result[0].Content)
+	assert.Empty(t, result[1].Content)
+	assert.True(t, result[1].Hidden)
+	storageMock.AssertExpectations(t)
+}
+
 func TestCommentService_GetComment_Success(t *testing.T) {
 	storageMock := &mocks.Storage{}
 	log := slogdiscard.NewDiscardLogger()
@@ -153,3 +405,40 @@ func TestCommentService_GetCommentReplies_NoReplies(t *testing.T) {
 	assert.Empty(t, replies)
 	storageMock.AssertExpectations(t)
 }
+
+func TestCommentService_GetCommentAncestors_Success(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	expected := []string{"comment1", "comment2"}
+
+	storageMock.On("GetCommentAncestors", mock.Anything, "comment3").Return(expected, nil)
+
+	ancestors, err := svc.GetCommentAncestors(context.Background(), "comment3")
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, ancestors)
+	storageMock.AssertExpectations(t)
+}
+
+func TestCommentService_LockThread_RequiresModerator(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewCommentService(storageMock, log)
+
+	ctx := tenant.WithSite(context.Background(), "blog")
+
+	_, err := svc.LockThread(ctx, "comment1")
+	require.ErrorIs(t, err, errors.ErrForbidden)
+	storageMock.AssertNotCalled(t, "LockThread", mock.Anything, mock.Anything)
+
+	expectTx(storageMock)
+	storageMock.On("LockThread", mock.Anything, "comment1").Return(nil)
+	storageMock.On("GetComment", mock.Anything, "comment1").Return(models.Comment{ID: "comment1", Locked: true}, nil)
+
+	comment, err := svc.LockThread(tenant.WithModerator(ctx), "comment1")
+	require.NoError(t, err)
+	assert.True(t, comment.Locked)
+	storageMock.AssertExpectations(t)
+}
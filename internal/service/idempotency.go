@@ -0,0 +1,35 @@
+package service
+
+import (
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+)
+
+// idempotencyKey scopes a client mutation ID to one kind of entity and to
+// the site of ctx, so the same ID sent to createPost and createComment, or by
+// clients of two sites, does not collide. It returns "" when the client sent
+// no ID.
+func idempotencyKey(ctx context.Context, scope string, clientMutationID *string) string {
+	if clientMutationID == nil || *clientMutationID == "" {
+		return ""
+	}
+	if site := tenant.SiteFromContext(ctx); site != "" {
+		scope = site + ":" + scope
+	}
+	return scope + ":" + *clientMutationID
+}
+
+// replayedID returns the entity created by an earlier request with key.
+// ok is false when key is unused or has expired.
+func replayedID(ctx context.Context, st storage.IdempotencyStorage, key string) (id string, ok bool, err error) {
+	id, err = st.GetIdempotencyKey(ctx, key)
+	if errors.Is(err, errors.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
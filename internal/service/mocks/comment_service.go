@@ -15,7 +15,7 @@ type CommentService struct {
 }
 
 // CreateComment provides a mock function with given fields: ctx, input
-func (_m *CommentService) CreateComment(ctx context.Context, input models.CreateCommentInput) (models.Comment, error) {
+func (_m *CommentService) CreateComment(ctx context.Context, input models.CreateCommentInput) (models.Comment, bool, error) {
 	ret := _m.Called(ctx, input)
 
 	if len(ret) == 0 {
@@ -23,8 +23,9 @@ func (_m *CommentService) CreateComment(ctx context.Context, input models.Create
 	}
 
 	var r0 models.Comment
-	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, models.CreateCommentInput) (models.Comment, error)); ok {
+	var r1 bool
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.CreateCommentInput) (models.Comment, bool, error)); ok {
 		return rf(ctx, input)
 	}
 	if rf, ok := ret.Get(0).(func(context.Context, models.CreateCommentInput) models.Comment); ok {
@@ -33,13 +34,19 @@ func (_m *CommentService) CreateComment(ctx context.Context, input models.Create
 		r0 = ret.Get(0).(models.Comment)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, models.CreateCommentInput) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, models.CreateCommentInput) bool); ok {
 		r1 = rf(ctx, input)
 	} else {
-		r1 = ret.Error(1)
+		r1 = ret.Get(1).(bool)
 	}
 
-	return r0, r1
+	if rf, ok := ret.Get(2).(func(context.Context, models.CreateCommentInput) error); ok {
+		r2 = rf(ctx, input)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
 // GetComment provides a mock function with given fields: ctx, id
@@ -70,6 +77,36 @@ func (_m *CommentService) GetComment(ctx context.Context, id string) (models.Com
 	return r0, r1
 }
 
+// GetCommentAncestors provides a mock function with given fields: ctx, id
+func (_m *CommentService) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCommentAncestors")
+	}
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]string, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetCommentReplies provides a mock function with given fields: ctx, parentID
 func (_m *CommentService) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
 	ret := _m.Called(ctx, parentID)
@@ -100,9 +137,39 @@ func (_m *CommentService) GetCommentReplies(ctx context.Context, parentID string
 	return r0, r1
 }
 
-// GetComments provides a mock function with given fields: ctx, postID, limit, offset
-func (_m *CommentService) GetComments(ctx context.Context, postID string, limit int, offset int) ([]models.Comment, int, error) {
-	ret := _m.Called(ctx, postID, limit, offset)
+// GetCommentSubtree provides a mock function with given fields: ctx, id, maxDepth
+func (_m *CommentService) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	ret := _m.Called(ctx, id, maxDepth)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCommentSubtree")
+	}
+
+	var r0 []models.Comment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]models.Comment, error)); ok {
+		return rf(ctx, id, maxDepth)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []models.Comment); ok {
+		r0 = rf(ctx, id, maxDepth)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Comment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, id, maxDepth)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetComments provides a mock function with given fields: ctx, postID, filter, limit, offset
+func (_m *CommentService) GetComments(ctx context.Context, postID string, filter models.CommentFilter, limit int, offset int) ([]models.Comment, int, error) {
+	ret := _m.Called(ctx, postID, filter, limit, offset)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetComments")
@@ -111,25 +178,25 @@ func (_m *CommentService) GetComments(ctx context.Context, postID string, limit
 	var r0 []models.Comment
 	var r1 int
 	var r2 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) ([]models.Comment, int, error)); ok {
-		return rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter, int, int) ([]models.Comment, int, error)); ok {
+		return rf(ctx, postID, filter, limit, offset)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) []models.Comment); ok {
-		r0 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter, int, int) []models.Comment); ok {
+		r0 = rf(ctx, postID, filter, limit, offset)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Comment)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, int, int) int); ok {
-		r1 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.CommentFilter, int, int) int); ok {
+		r1 = rf(ctx, postID, filter, limit, offset)
 	} else {
 		r1 = ret.Get(1).(int)
 	}
 
-	if rf, ok := ret.Get(2).(func(context.Context, string, int, int) error); ok {
-		r2 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(2).(func(context.Context, string, models.CommentFilter, int, int) error); ok {
+		r2 = rf(ctx, postID, filter, limit, offset)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -137,6 +204,34 @@ func (_m *CommentService) GetComments(ctx context.Context, postID string, limit
 	return r0, r1, r2
 }
 
+// LockThread provides a mock function with given fields: ctx, commentID
+func (_m *CommentService) LockThread(ctx context.Context, commentID string) (models.Comment, error) {
+	ret := _m.Called(ctx, commentID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LockThread")
+	}
+
+	var r0 models.Comment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Comment, error)); ok {
+		return rf(ctx, commentID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Comment); ok {
+		r0 = rf(ctx, commentID)
+	} else {
+		r0 = ret.Get(0).(models.Comment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, commentID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewCommentService creates a new instance of CommentService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewCommentService(t interface {
@@ -70,9 +70,9 @@ func (_m *PostService) GetPost(ctx context.Context, id string) (models.Post, err
 	return r0, r1
 }
 
-// GetPosts provides a mock function with given fields: ctx, limit, offset
-func (_m *PostService) GetPosts(ctx context.Context, limit int, offset int) ([]models.Post, error) {
-	ret := _m.Called(ctx, limit, offset)
+// GetPosts provides a mock function with given fields: ctx, filter, limit, offset
+func (_m *PostService) GetPosts(ctx context.Context, filter models.PostFilter, limit int, offset int) ([]models.Post, error) {
+	ret := _m.Called(ctx, filter, limit, offset)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetPosts")
@@ -80,19 +80,19 @@ func (_m *PostService) GetPosts(ctx context.Context, limit int, offset int) ([]m
 
 	var r0 []models.Post
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, int, int) ([]models.Post, error)); ok {
-		return rf(ctx, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, models.PostFilter, int, int) ([]models.Post, error)); ok {
+		return rf(ctx, filter, limit, offset)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, int, int) []models.Post); ok {
-		r0 = rf(ctx, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, models.PostFilter, int, int) []models.Post); ok {
+		r0 = rf(ctx, filter, limit, offset)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Post)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
-		r1 = rf(ctx, limit, offset)
+	if rf, ok := ret.Get(1).(func(context.Context, models.PostFilter, int, int) error); ok {
+		r1 = rf(ctx, filter, limit, offset)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -100,9 +100,9 @@ func (_m *PostService) GetPosts(ctx context.Context, limit int, offset int) ([]m
 	return r0, r1
 }
 
-// ToggleComments provides a mock function with given fields: ctx, postID, enabled
-func (_m *PostService) ToggleComments(ctx context.Context, postID string, enabled bool) (models.Post, error) {
-	ret := _m.Called(ctx, postID, enabled)
+// ToggleComments provides a mock function with given fields: ctx, postID, enabled, expectedVersion
+func (_m *PostService) ToggleComments(ctx context.Context, postID string, enabled bool, expectedVersion int) (models.Post, error) {
+	ret := _m.Called(ctx, postID, enabled, expectedVersion)
 
 	if len(ret) == 0 {
 		panic("no return value specified for ToggleComments")
@@ -110,17 +110,45 @@ func (_m *PostService) ToggleComments(ctx context.Context, postID string, enable
 
 	var r0 models.Post
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool) (models.Post, error)); ok {
-		return rf(ctx, postID, enabled)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, int) (models.Post, error)); ok {
+		return rf(ctx, postID, enabled, expectedVersion)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool) models.Post); ok {
-		r0 = rf(ctx, postID, enabled)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, int) models.Post); ok {
+		r0 = rf(ctx, postID, enabled, expectedVersion)
 	} else {
 		r0 = ret.Get(0).(models.Post)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, bool) error); ok {
-		r1 = rf(ctx, postID, enabled)
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool, int) error); ok {
+		r1 = rf(ctx, postID, enabled, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdatePost provides a mock function with given fields: ctx, id, input
+func (_m *PostService) UpdatePost(ctx context.Context, id string, input models.UpdatePostInput) (models.Post, error) {
+	ret := _m.Called(ctx, id, input)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdatePost")
+	}
+
+	var r0 models.Post
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.UpdatePostInput) (models.Post, error)); ok {
+		return rf(ctx, id, input)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.UpdatePostInput) models.Post); ok {
+		r0 = rf(ctx, id, input)
+	} else {
+		r0 = ret.Get(0).(models.Post)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.UpdatePostInput) error); ok {
+		r1 = rf(ctx, id, input)
 	} else {
 		r1 = ret.Error(1)
 	}
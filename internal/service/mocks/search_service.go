@@ -0,0 +1,57 @@
+// Code generated by mockery v2.53.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	models "comments-system/internal/models"
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SearchService is an autogenerated mock type for the SearchService type
+type SearchService struct {
+	mock.Mock
+}
+
+// Search provides a mock function with given fields: ctx, query, searchType, postID, first, after
+func (_m *SearchService) Search(ctx context.Context, query string, searchType models.SearchType, postID *string, first int, after *string) (models.SearchConnection, error) {
+	ret := _m.Called(ctx, query, searchType, postID, first, after)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Search")
+	}
+
+	var r0 models.SearchConnection
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.SearchType, *string, int, *string) (models.SearchConnection, error)); ok {
+		return rf(ctx, query, searchType, postID, first, after)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.SearchType, *string, int, *string) models.SearchConnection); ok {
+		r0 = rf(ctx, query, searchType, postID, first, after)
+	} else {
+		r0 = ret.Get(0).(models.SearchConnection)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.SearchType, *string, int, *string) error); ok {
+		r1 = rf(ctx, query, searchType, postID, first, after)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSearchService creates a new instance of SearchService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSearchService(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SearchService {
+	mock := &SearchService{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/utils"
+	"context"
+	"time"
+)
+
+// DefaultIdempotencyTTL is how long a client mutation ID is remembered
+// unless WithIdempotencyTTL says otherwise.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultMaxReplyDepth is the deepest reply allowed unless
+// WithMaxReplyDepth says otherwise. Root comments have depth 0.
+const DefaultMaxReplyDepth = 50
+
+type options struct {
+	idempotencyTTL time.Duration
+	maxReplyDepth  int
+	settings       models.SiteSettings
+	sites          map[string]models.SiteSettings
+}
+
+type Option func(*options)
+
+// WithIdempotencyTTL sets how long retries with the same client mutation ID
+// return the original result instead of creating a duplicate.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.idempotencyTTL = ttl
+	}
+}
+
+// WithMaxReplyDepth limits how deep replies may nest; 0 or less disables
+// the limit.
+func WithMaxReplyDepth(depth int) Option {
+	return func(o *options) {
+		o.maxReplyDepth = depth
+	}
+}
+
+// WithMaxCommentLength limits comments to n bytes; 0 or less disables the
+// limit.
+// Sites may override it with WithSiteSettings.
+func WithMaxCommentLength(n int) Option {
+	return func(o *options) {
+		o.settings.MaxCommentLength = n
+	}
+}
+
+// WithModeration sets how new comments are published. Sites may override
+// it with WithSiteSettings.
+func WithModeration(mode models.ModerationMode) Option {
+	return func(o *options) {
+		o.settings.Moderation = mode
+	}
+}
+
+// WithSiteSettings overrides the comment settings for requests bound to
+// site. Zero fields of settings keep the global value; a negative
+// MaxCommentLength lifts the length limit for the site.
+func WithSiteSettings(site string, settings models.SiteSettings) Option {
+	return func(o *options) {
+		if o.sites == nil {
+			o.sites = make(map[string]models.SiteSettings)
+		}
+		o.sites[site] = settings
+	}
+}
+
+// settingsFor returns the comment settings of the site of ctx.
+func (o options) settingsFor(ctx context.Context) models.SiteSettings {
+	settings := o.settings
+	site, ok := o.sites[tenant.SiteFromContext(ctx)]
+	if !ok {
+		return settings
+	}
+	if site.MaxCommentLength != 0 {
+		settings.MaxCommentLength = site.MaxCommentLength
+	}
+	if site.Moderation != "" {
+		settings.Moderation = site.Moderation
+	}
+	return settings
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		idempotencyTTL: DefaultIdempotencyTTL,
+		maxReplyDepth:  DefaultMaxReplyDepth,
+		settings: models.SiteSettings{
+			MaxCommentLength: utils.DefaultMaxCommentLength,
+			Moderation:       models.ModerationOpen,
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
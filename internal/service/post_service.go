@@ -3,21 +3,25 @@ package service
 import (
 	"comments-system/internal/models"
 	"comments-system/internal/storage"
+	"comments-system/pkg/errors"
 	"comments-system/pkg/logger/sl"
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 )
 
 type postService struct {
 	storage storage.Storage
 	log     *slog.Logger
+	opts    options
 }
 
-func NewPostService(storage storage.Storage, log *slog.Logger) PostService {
+func NewPostService(storage storage.Storage, log *slog.Logger, opts ...Option) PostService {
 	return &postService{
 		storage: storage,
 		log:     log,
+		opts:    newOptions(opts),
 	}
 }
 
@@ -32,23 +36,84 @@ func (ps *postService) CreatePost(ctx context.Context, input models.CreatePostIn
 		CommentsEnabled: input.CommentsEnabled,
 	}
 
-	createdPost, err := ps.storage.CreatePost(ctx, post)
+	key := idempotencyKey(ctx, "post", input.ClientMutationID)
+
+	var createdPost models.Post
+	replayed := false
+	err := ps.storage.WithTx(ctx, func(tx storage.Storage) error {
+		if key != "" {
+			id, ok, err := replayedID(ctx, tx, key)
+			if err != nil {
+				log.Error("Failed to look up idempotency key", sl.Err(err), "key", key)
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if ok {
+				createdPost, err = tx.GetPost(ctx, id)
+				if err != nil {
+					return fmt.Errorf("%s: failed to get replayed post: %w", op, err)
+				}
+				replayed = true
+				return nil
+			}
+		}
+
+		var err error
+		createdPost, err = tx.CreatePost(ctx, post)
+		if err != nil {
+			log.Error("Failed to create post", sl.Err(err), "input", input)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if key != "" {
+			expiresAt := time.Now().Add(ps.opts.idempotencyTTL)
+			if err := tx.SaveIdempotencyKey(ctx, key, createdPost.ID, expiresAt); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		return nil
+	})
+	if errors.Is(err, errors.ErrIdempotencyKeyExists) {
+		// A concurrent request with the same key committed first. Its post is
+		// read in a transaction, which sees the primary and not a replica
+		// that may lag behind it.
+		err = ps.storage.WithTx(ctx, func(tx storage.Storage) error {
+			id, ok, err := replayedID(ctx, tx, key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			if !ok {
+				log.Warn("Idempotency key expired before replay", "key", key)
+				return fmt.Errorf("%s: %w", op, errors.ErrIdempotencyKeyExists)
+			}
+			createdPost, err = tx.GetPost(ctx, id)
+			if err != nil {
+				return fmt.Errorf("%s: failed to get replayed post: %w", op, err)
+			}
+			return nil
+		})
+		replayed = true
+	}
 	if err != nil {
-		log.Error("Failed to create post", sl.Err(err), "input", input)
-		return models.Post{}, fmt.Errorf("%s: %w", op, err)
+		return models.Post{}, err
+	}
+
+	if replayed {
+		log.Info("Post create replayed", "id", createdPost.ID, "key", key)
+		return createdPost, nil
 	}
 
 	log.Info("Post created", "id", createdPost.ID)
 	return createdPost, nil
 }
 
-func (ps *postService) GetPosts(ctx context.Context, limit, offset int) ([]models.Post, error) {
+func (ps *postService) GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error) {
 	const op = "service.postService.GetPosts"
 	log := ps.log.With(slog.String("op", op))
 
-	posts, err := ps.storage.GetPosts(ctx, limit, offset)
+	posts, err := ps.storage.GetPosts(ctx, filter, limit, offset)
 	if err != nil {
-		log.Error("Failed to get posts", sl.Err(err), "limit", limit, "offset", offset)
+		log.Error("Failed to get posts", sl.Err(err), "filter", filter, "limit", limit, "offset", offset)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -70,27 +135,92 @@ func (ps *postService) GetPost(ctx context.Context, id string) (models.Post, err
 	return post, nil
 }
 
-func (ps *postService) ToggleComments(ctx context.Context, postID string, enabled bool) (models.Post, error) {
+func (ps *postService) UpdatePost(ctx context.Context, id string, input models.UpdatePostInput) (models.Post, error) {
+	const op = "service.postService.UpdatePost"
+	log := ps.log.With(slog.String("op", op))
+
+	var post models.Post
+	err := ps.storage.WithTx(ctx, func(tx storage.Storage) error {
+		var err error
+		post, err = tx.GetPost(ctx, id)
+		if err != nil {
+			log.Error("Failed to get post", sl.Err(err), "id", id)
+			return fmt.Errorf("%s: failed to get post: %w", op, err)
+		}
+
+		if post.Version != input.ExpectedVersion {
+			log.Warn("Stale post version", "id", id, "expected", input.ExpectedVersion, "current", post.Version)
+			return fmt.Errorf("%s: %w", op, &errors.ConflictError{CurrentVersion: post.Version})
+		}
+
+		if input.Title != nil {
+			post.Title = *input.Title
+		}
+		if input.Content != nil {
+			post.Content = *input.Content
+		}
+		if input.CommentsEnabled != nil {
+			post.CommentsEnabled = *input.CommentsEnabled
+		}
+
+		if err := tx.UpdatePost(ctx, post); err != nil {
+			log.Error("Failed to update post", sl.Err(err), "id", id)
+			return fmt.Errorf("%s: failed to update post: %w", op, err)
+		}
+
+		post.Version++
+		return nil
+	})
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	log.Info("Post updated", "id", id, "version", post.Version)
+	return post, nil
+}
+
+func (ps *postService) ToggleComments(ctx context.Context, postID string, enabled bool, expectedVersion int) (models.Post, error) {
 	const op = "service.postService.ToggleComments"
 	log := ps.log.With(slog.String("op", op))
 
-	post, err := ps.storage.GetPost(ctx, postID)
+	var post models.Post
+	changed := false
+	err := ps.storage.WithTx(ctx, func(tx storage.Storage) error {
+		var err error
+		post, err = tx.GetPost(ctx, postID)
+		if err != nil {
+			log.Error("Failed to get post", sl.Err(err), "id", postID)
+			return fmt.Errorf("%s: failed to get post: %w", op, err)
+		}
+
+		if post.Version != expectedVersion {
+			log.Warn("Stale post version", "id", postID, "expected", expectedVersion, "current", post.Version)
+			return fmt.Errorf("%s: %w", op, &errors.ConflictError{CurrentVersion: post.Version})
+		}
+
+		if post.CommentsEnabled == enabled {
+			return nil
+		}
+
+		post.CommentsEnabled = enabled
+		if err := tx.UpdatePost(ctx, post); err != nil {
+			log.Error("Failed to update post", sl.Err(err), "id", postID)
+			return fmt.Errorf("%s: failed to update post: %w", op, err)
+		}
+
+		post.Version++
+		changed = true
+		return nil
+	})
 	if err != nil {
-		log.Error("Failed to get post", sl.Err(err), "id", postID)
-		return models.Post{}, fmt.Errorf("%s: failed to get post: %w", op, err)
+		return models.Post{}, err
 	}
 
-	if post.CommentsEnabled == enabled {
+	if !changed {
 		log.Info("Comments already in requested state", "enabled", enabled)
 		return post, nil
 	}
 
-	post.CommentsEnabled = enabled
-	if err := ps.storage.UpdatePost(ctx, post); err != nil {
-		log.Error("Failed to update post", sl.Err(err), "id", postID)
-		return models.Post{}, fmt.Errorf("%s: failed to update post: %w", op, err)
-	}
-
 	log.Info("Comments toggled", "id", postID, "enabled", enabled)
 	return post, nil
 }
@@ -24,6 +24,7 @@ func TestPostService_CreatePost_Success(t *testing.T) {
 		Author:  "author1",
 	}
 
+	expectTx(storageMock)
 	storageMock.On("CreatePost", mock.Anything, mock.Anything).Return(models.Post{
 		ID:      "post1",
 		Title:   "Test Post",
@@ -38,6 +39,76 @@ func TestPostService_CreatePost_Success(t *testing.T) {
 	storageMock.AssertExpectations(t)
 }
 
+func TestPostService_CreatePost_Replay(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewPostService(storageMock, log)
+
+	key := "retry-1"
+	input := models.CreatePostInput{
+		Title:            "Test Post",
+		Content:          "Content",
+		Author:           "author1",
+		ClientMutationID: &key,
+	}
+
+	expectTx(storageMock)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "post:retry-1").Return("post1", nil)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", Title: "Test Post"}, nil)
+
+	post, err := svc.CreatePost(context.Background(), input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "post1", post.ID)
+	storageMock.AssertNotCalled(t, "CreatePost", mock.Anything, mock.Anything)
+	storageMock.AssertExpectations(t)
+}
+
+func TestPostService_CreatePost_ConcurrentReplay(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewPostService(storageMock, log)
+
+	key := "retry-1"
+	input := models.CreatePostInput{Title: "Test Post", ClientMutationID: &key}
+
+	expectTx(storageMock)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "post:retry-1").Return("", errors.ErrNotFound).Once()
+	storageMock.On("CreatePost", mock.Anything, mock.Anything).Return(models.Post{ID: "post2"}, nil)
+	storageMock.On("SaveIdempotencyKey", mock.Anything, "post:retry-1", "post2", mock.Anything).
+		Return(errors.ErrIdempotencyKeyExists)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "post:retry-1").Return("post1", nil).Once()
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1"}, nil)
+
+	post, err := svc.CreatePost(context.Background(), input)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "post1", post.ID)
+	storageMock.AssertNumberOfCalls(t, "WithTx", 2)
+	storageMock.AssertExpectations(t)
+}
+
+func TestPostService_CreatePost_ConcurrentReplayExpired(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewPostService(storageMock, log)
+
+	key := "retry-1"
+	input := models.CreatePostInput{Title: "Test Post", ClientMutationID: &key}
+
+	expectTx(storageMock)
+	storageMock.On("GetIdempotencyKey", mock.Anything, "post:retry-1").Return("", errors.ErrNotFound).Twice()
+	storageMock.On("CreatePost", mock.Anything, mock.Anything).Return(models.Post{ID: "post2"}, nil)
+	storageMock.On("SaveIdempotencyKey", mock.Anything, "post:retry-1", "post2", mock.Anything).
+		Return(errors.ErrIdempotencyKeyExists)
+
+	_, err := svc.CreatePost(context.Background(), input)
+
+	assert.ErrorIs(t, err, errors.ErrIdempotencyKeyExists)
+	storageMock.AssertNotCalled(t, "GetPost", mock.Anything, mock.Anything)
+	storageMock.AssertExpectations(t)
+}
+
 func TestPostService_ToggleComments_Success(t *testing.T) {
 	storageMock := &mocks.Storage{}
 	log := slogdiscard.NewDiscardLogger()
@@ -46,17 +117,20 @@ func TestPostService_ToggleComments_Success(t *testing.T) {
 	originalPost := models.Post{
 		ID:              "post1",
 		CommentsEnabled: false,
+		Version:         1,
 	}
 
+	expectTx(storageMock)
 	storageMock.On("GetPost", mock.Anything, "post1").Return(originalPost, nil)
 	storageMock.On("UpdatePost", mock.Anything, mock.MatchedBy(func(p models.Post) bool {
 		return p.CommentsEnabled == true
 	})).Return(nil)
 
-	updated, err := svc.ToggleComments(context.Background(), "post1", true)
+	updated, err := svc.ToggleComments(context.Background(), "post1", true, 1)
 
 	assert.NoError(t, err)
 	assert.True(t, updated.CommentsEnabled)
+	assert.Equal(t, 2, updated.Version)
 	storageMock.AssertExpectations(t)
 }
 
@@ -68,17 +142,79 @@ func TestPostService_ToggleComments_NoChange(t *testing.T) {
 	post := models.Post{
 		ID:              "post1",
 		CommentsEnabled: true,
+		Version:         1,
 	}
 
+	expectTx(storageMock)
 	storageMock.On("GetPost", mock.Anything, "post1").Return(post, nil)
 
-	result, err := svc.ToggleComments(context.Background(), "post1", true)
+	result, err := svc.ToggleComments(context.Background(), "post1", true, 1)
 
 	assert.NoError(t, err)
 	assert.True(t, result.CommentsEnabled)
 	storageMock.AssertNotCalled(t, "UpdatePost")
 }
 
+func TestPostService_ToggleComments_Conflict(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewPostService(storageMock, log)
+
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", Version: 3}, nil)
+
+	_, err := svc.ToggleComments(context.Background(), "post1", true, 2)
+
+	assert.ErrorIs(t, err, errors.ErrConflict)
+	var conflict *errors.ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, 3, conflict.CurrentVersion)
+	storageMock.AssertNotCalled(t, "UpdatePost")
+}
+
+func TestPostService_UpdatePost_Success(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewPostService(storageMock, log)
+
+	title := "New title"
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{
+		ID:      "post1",
+		Title:   "Old title",
+		Content: "Content",
+		Version: 1,
+	}, nil)
+	storageMock.On("UpdatePost", mock.Anything, mock.MatchedBy(func(p models.Post) bool {
+		return p.Title == title && p.Content == "Content" && p.Version == 1
+	})).Return(nil)
+
+	updated, err := svc.UpdatePost(context.Background(), "post1", models.UpdatePostInput{
+		Title:           &title,
+		ExpectedVersion: 1,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, title, updated.Title)
+	assert.Equal(t, 2, updated.Version)
+	storageMock.AssertExpectations(t)
+}
+
+func TestPostService_UpdatePost_StorageConflict(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewPostService(storageMock, log)
+
+	expectTx(storageMock)
+	storageMock.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", Version: 1}, nil)
+	storageMock.On("UpdatePost", mock.Anything, mock.Anything).Return(&errors.ConflictError{CurrentVersion: 2})
+
+	_, err := svc.UpdatePost(context.Background(), "post1", models.UpdatePostInput{ExpectedVersion: 1})
+
+	assert.ErrorIs(t, err, errors.ErrConflict)
+	storageMock.AssertExpectations(t)
+}
+
 func TestPostService_GetPost_Success(t *testing.T) {
 	storageMock := &mocks.Storage{}
 	log := slogdiscard.NewDiscardLogger()
@@ -108,9 +244,9 @@ func TestPostService_GetPosts_Success(t *testing.T) {
 		{ID: "post2", Title: "Test Post 2"},
 	}
 
-	storageMock.On("GetPosts", mock.Anything, limit, offset).Return(expectedPosts, nil)
+	storageMock.On("GetPosts", mock.Anything, models.PostFilter{}, limit, offset).Return(expectedPosts, nil)
 
-	posts, err := svc.GetPosts(context.Background(), limit, offset)
+	posts, err := svc.GetPosts(context.Background(), models.PostFilter{}, limit, offset)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedPosts, posts)
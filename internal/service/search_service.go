@@ -0,0 +1,109 @@
+package service
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/pkg/errors"
+	"comments-system/pkg/logger/sl"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchPageSize = 10
+	maxSearchPageSize     = 100
+
+	cursorPrefix = "offset:"
+)
+
+type searchService struct {
+	storage storage.Storage
+	log     *slog.Logger
+}
+
+func NewSearchService(storage storage.Storage, log *slog.Logger) SearchService {
+	return &searchService{
+		storage: storage,
+		log:     log,
+	}
+}
+
+func (ss *searchService) Search(ctx context.Context, query string, searchType models.SearchType, postID *string, first int, after *string) (models.SearchConnection, error) {
+	const op = "service.searchService.Search"
+	log := ss.log.With(slog.String("op", op))
+
+	if strings.TrimSpace(query) == "" {
+		return models.SearchConnection{Hits: []models.SearchHit{}}, nil
+	}
+
+	if first <= 0 {
+		first = defaultSearchPageSize
+	}
+	first = min(first, maxSearchPageSize)
+
+	offset := 0
+	if after != nil {
+		var err error
+		offset, err = decodeCursor(*after)
+		if err != nil {
+			log.Warn("Invalid search cursor", "after", *after)
+			return models.SearchConnection{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// One extra hit tells whether another page exists.
+	hits, err := ss.storage.Search(ctx, models.SearchQuery{
+		Query:  query,
+		Type:   searchType,
+		PostID: postID,
+		Limit:  first + 1,
+		Offset: offset,
+	})
+	if err != nil {
+		log.Error("Failed to search", sl.Err(err), "query", query)
+		return models.SearchConnection{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	conn := models.SearchConnection{HasNextPage: len(hits) > first}
+	if conn.HasNextPage {
+		hits = hits[:first]
+	}
+	for i := range hits {
+		hits[i].Cursor = encodeCursor(offset + i + 1)
+	}
+	conn.Hits = hits
+	if len(hits) > 0 {
+		conn.EndCursor = &hits[len(hits)-1].Cursor
+	}
+
+	log.Info("Search completed", "query", query, "type", searchType, "count", len(hits))
+	return conn, nil
+}
+
+// Cursors are opaque to clients; they encode the offset of the next hit.
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.ErrInvalidCursor
+	}
+
+	value, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, errors.ErrInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, errors.ErrInvalidCursor
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,74 @@
+package service_test
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/service"
+	"comments-system/internal/storage/mocks"
+	"comments-system/pkg/errors"
+	"comments-system/pkg/logger/slogdiscard"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSearchService_Search_Pagination(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewSearchService(storageMock, log)
+
+	hits := []models.SearchHit{
+		{Post: &models.Post{ID: "post1"}, Score: 0.9},
+		{Comment: &models.Comment{ID: "comment1"}, Score: 0.5},
+		{Comment: &models.Comment{ID: "comment2"}, Score: 0.1},
+	}
+	storageMock.On("Search", mock.Anything, models.SearchQuery{
+		Query: "golang", Type: models.SearchTypeAll, Limit: 3, Offset: 0,
+	}).Return(hits, nil)
+
+	first, err := svc.Search(context.Background(), "golang", models.SearchTypeAll, nil, 2, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, first.Hits, 2)
+	assert.True(t, first.HasNextPage)
+	assert.NotNil(t, first.EndCursor)
+	assert.Equal(t, first.Hits[1].Cursor, *first.EndCursor)
+
+	storageMock.On("Search", mock.Anything, models.SearchQuery{
+		Query: "golang", Type: models.SearchTypeAll, Limit: 3, Offset: 2,
+	}).Return(hits[2:], nil)
+
+	second, err := svc.Search(context.Background(), "golang", models.SearchTypeAll, nil, 2, first.EndCursor)
+
+	assert.NoError(t, err)
+	assert.Len(t, second.Hits, 1)
+	assert.False(t, second.HasNextPage)
+	assert.Equal(t, "comment2", second.Hits[0].Comment.ID)
+	storageMock.AssertExpectations(t)
+}
+
+func TestSearchService_Search_InvalidCursor(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewSearchService(storageMock, log)
+
+	after := "not-a-cursor"
+	_, err := svc.Search(context.Background(), "golang", models.SearchTypeAll, nil, 10, &after)
+
+	assert.ErrorIs(t, err, errors.ErrInvalidCursor)
+	storageMock.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+}
+
+func TestSearchService_Search_EmptyQuery(t *testing.T) {
+	storageMock := &mocks.Storage{}
+	log := slogdiscard.NewDiscardLogger()
+	svc := service.NewSearchService(storageMock, log)
+
+	conn, err := svc.Search(context.Background(), "   ", models.SearchTypeAll, nil, 10, nil)
+
+	assert.NoError(t, err)
+	assert.Empty(t, conn.Hits)
+	assert.False(t, conn.HasNextPage)
+	storageMock.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+}
@@ -8,20 +8,34 @@ import (
 //go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=PostService --output=./mocks --case=underscore
 type PostService interface {
 	CreatePost(ctx context.Context, input models.CreatePostInput) (models.Post, error)
-	GetPosts(ctx context.Context, limit, offset int) ([]models.Post, error)
+	GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error)
 	GetPost(ctx context.Context, id string) (models.Post, error)
-	ToggleComments(ctx context.Context, postID string, enabled bool) (models.Post, error)
+	UpdatePost(ctx context.Context, id string, input models.UpdatePostInput) (models.Post, error)
+	ToggleComments(ctx context.Context, postID string, enabled bool, expectedVersion int) (models.Post, error)
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=CommentService --output=./mocks --case=underscore
 type CommentService interface {
-	CreateComment(ctx context.Context, input models.CreateCommentInput) (models.Comment, error)
-	GetComments(ctx context.Context, postID string, limit, offset int) ([]models.Comment, int, error)
+	// CreateComment reports created=false when the input's client mutation
+	// ID replayed an earlier request and the original comment was returned.
+	CreateComment(ctx context.Context, input models.CreateCommentInput) (comment models.Comment, created bool, err error)
+	GetComments(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, int, error)
 	GetComment(ctx context.Context, id string) (models.Comment, error)
 	GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error)
+	GetCommentAncestors(ctx context.Context, id string) ([]string, error)
+	GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error)
+	LockThread(ctx context.Context, commentID string) (models.Comment, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=SearchService --output=./mocks --case=underscore
+type SearchService interface {
+	// Search pages through hits with an opaque cursor: after is the cursor
+	// of the last hit already seen.
+	Search(ctx context.Context, query string, searchType models.SearchType, postID *string, first int, after *string) (models.SearchConnection, error)
 }
 
 type Service struct {
 	PostService
 	CommentService
+	SearchService
 }
@@ -0,0 +1,367 @@
+// Package cache wraps a storage.Storage with a read-through cache for the
+// hottest reads: single posts, pages of comments and comment counts.
+package cache
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Stats counts cache lookups since the storage was created.
+type Stats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// Storage caches GetPost, GetCommentsByPost and CountCommentsByPost of the
+// wrapped storage and passes every other call through. Writes made through
+// it drop what is cached for the post they touch once they succeed or,
+// inside WithTx, once the transaction ends.
+//
+// Entries are keyed by the site of the call as well, since a post read from
+// one site is missing for another.
+//
+// A read that misses just before a write commits can still store the old
+// value after the write invalidated it; such entries live at most the TTL.
+type Storage struct {
+	storage.Storage
+
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries *lru
+	byPost  map[string]map[string]struct{} // post ID -> keys of its entries
+	hits    uint64
+	misses  uint64
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func NewCache(next storage.Storage, cfg config.Cache) *Storage {
+	s := &Storage{
+		Storage: next,
+		ttl:     cfg.TTL,
+		now:     time.Now,
+		byPost:  make(map[string]map[string]struct{}),
+	}
+	s.entries = newLRU(cfg.Size, s.forget)
+	return s
+}
+
+func (s *Storage) GetPost(ctx context.Context, id string) (models.Post, error) {
+	key := fmt.Sprintf("post:%s:%s", tenant.SiteFromContext(ctx), id)
+	if v, ok := s.get(key); ok {
+		return v.(models.Post), nil
+	}
+
+	post, err := s.Storage.GetPost(ctx, id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	s.put(key, id, post)
+	return post, nil
+}
+
+func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, error) {
+	key := fmt.Sprintf("page:%s:%s:%s:%d:%d", tenant.SiteFromContext(ctx), postID, filterKey(filter), limit, offset)
+	if v, ok := s.get(key); ok {
+		return slices.Clone(v.([]models.Comment)), nil
+	}
+
+	comments, err := s.Storage.GetCommentsByPost(ctx, postID, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	s.put(key, postID, slices.Clone(comments))
+	return comments, nil
+}
+
+func (s *Storage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
+	key := fmt.Sprintf("count:%s:%s:%s", tenant.SiteFromContext(ctx), postID, filterKey(filter))
+	if v, ok := s.get(key); ok {
+		return v.(int), nil
+	}
+
+	count, err := s.Storage.CountCommentsByPost(ctx, postID, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	s.put(key, postID, count)
+	return count, nil
+}
+
+// UpdatePost invalidates the post even when the update fails: a conflict
+// means the cached version is stale.
+func (s *Storage) UpdatePost(ctx context.Context, post models.Post) error {
+	err := s.Storage.UpdatePost(ctx, post)
+	s.Invalidate(post.ID)
+	return err
+}
+
+func (s *Storage) CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error) {
+	created, err := s.Storage.CreateComment(ctx, comment)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	s.Invalidate(created.PostID)
+	return created, nil
+}
+
+func (s *Storage) ImportComment(ctx context.Context, comment models.Comment) error {
+	if err := s.Storage.ImportComment(ctx, comment); err != nil {
+		return err
+	}
+
+	s.Invalidate(comment.PostID)
+	return nil
+}
+
+func (s *Storage) LockThread(ctx context.Context, id string) error {
+	const op = "storage.cache.LockThread"
+
+	if err := s.Storage.LockThread(ctx, id); err != nil {
+		return err
+	}
+
+	comment, err := s.Storage.GetComment(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: failed to find post: %w", op, err)
+	}
+
+	s.Invalidate(comment.PostID)
+	return nil
+}
+
+func (s *Storage) RecountComments(ctx context.Context) (int, error) {
+	fixed, err := s.Storage.RecountComments(ctx)
+	s.Purge()
+	return fixed, err
+}
+
+func (s *Storage) HideComment(ctx context.Context, id string, hidden bool) error {
+	const op = "storage.cache.HideComment"
+
+	if err := s.Storage.HideComment(ctx, id, hidden); err != nil {
+		return err
+	}
+
+	comment, err := s.Storage.GetComment(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: failed to find post: %w", op, err)
+	}
+
+	s.Invalidate(comment.PostID)
+	return nil
+}
+
+// DeleteComment looks the post up first, as the comment is gone afterwards.
+func (s *Storage) DeleteComment(ctx context.Context, id string) (int, error) {
+	comment, err := s.Storage.GetComment(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := s.Storage.DeleteComment(ctx, id)
+	s.Invalidate(comment.PostID)
+	return deleted, err
+}
+
+func (s *Storage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	purged, err := s.Storage.PurgeAuthor(ctx, author)
+	s.Purge()
+	return purged, err
+}
+
+// WithTx runs fn against the uncached transaction, so reads inside it see
+// its own writes and keep their locking, and invalidates what the
+// transaction wrote once it ends.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	t := &txStorage{touched: make(map[string]struct{})}
+
+	err := s.Storage.WithTx(ctx, func(tx storage.Storage) error {
+		t.Storage = tx
+		return fn(t)
+	})
+
+	if t.purge {
+		s.Purge()
+	} else {
+		for postID := range t.touched {
+			s.Invalidate(postID)
+		}
+	}
+
+	return err
+}
+
+// Listen invalidates the post of every comment received until events is
+// closed. The pub/sub is in-process and drops events when a subscriber
+// falls behind, so this only narrows the window; other instances are not
+// heard from at all, and their writes stay stale for up to the TTL.
+func (s *Storage) Listen(events <-chan *models.Comment) {
+	for comment := range events {
+		if comment != nil {
+			s.Invalidate(comment.PostID)
+		}
+	}
+}
+
+// Invalidate drops everything cached for the post.
+func (s *Storage) Invalidate(postID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.byPost[postID] {
+		s.entries.remove(key)
+	}
+}
+
+// Purge empties the cache.
+func (s *Storage) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = newLRU(s.entries.size, s.forget)
+	s.byPost = make(map[string]map[string]struct{})
+}
+
+func (s *Storage) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Stats{Hits: s.hits, Misses: s.misses, Entries: s.entries.len()}
+}
+
+func (s *Storage) get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.entries.get(key, s.now())
+	if ok {
+		s.hits++
+	} else {
+		s.misses++
+	}
+	return v, ok
+}
+
+func (s *Storage) put(key, postID string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries.add(&entry{key: key, postID: postID, value: value, expiresAt: s.now().Add(s.ttl)})
+
+	keys, ok := s.byPost[postID]
+	if !ok {
+		keys = make(map[string]struct{})
+		s.byPost[postID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// forget unlinks an entry leaving the LRU; the caller holds mu.
+func (s *Storage) forget(e *entry) {
+	keys := s.byPost[e.postID]
+	delete(keys, e.key)
+	if len(keys) == 0 {
+		delete(s.byPost, e.postID)
+	}
+}
+
+// filterKey encodes a filter for use in cache keys. Unset fields are
+// omitted, so equal filters always encode the same way.
+func filterKey(filter models.CommentFilter) string {
+	data, _ := json.Marshal(filter)
+	return string(data)
+}
+
+// txStorage passes everything to the transaction and notes which posts its
+// writes touch.
+type txStorage struct {
+	storage.Storage
+
+	touched map[string]struct{}
+	purge   bool
+}
+
+func (tx *txStorage) UpdatePost(ctx context.Context, post models.Post) error {
+	tx.touched[post.ID] = struct{}{}
+	return tx.Storage.UpdatePost(ctx, post)
+}
+
+func (tx *txStorage) CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error) {
+	tx.touched[comment.PostID] = struct{}{}
+	return tx.Storage.CreateComment(ctx, comment)
+}
+
+func (tx *txStorage) ImportComment(ctx context.Context, comment models.Comment) error {
+	tx.touched[comment.PostID] = struct{}{}
+	return tx.Storage.ImportComment(ctx, comment)
+}
+
+func (tx *txStorage) LockThread(ctx context.Context, id string) error {
+	const op = "storage.cache.txStorage.LockThread"
+
+	if err := tx.Storage.LockThread(ctx, id); err != nil {
+		return err
+	}
+
+	comment, err := tx.Storage.GetComment(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: failed to find post: %w", op, err)
+	}
+	tx.touched[comment.PostID] = struct{}{}
+	return nil
+}
+
+func (tx *txStorage) RecountComments(ctx context.Context) (int, error) {
+	tx.purge = true
+	return tx.Storage.RecountComments(ctx)
+}
+
+func (tx *txStorage) HideComment(ctx context.Context, id string, hidden bool) error {
+	const op = "storage.cache.txStorage.HideComment"
+
+	if err := tx.Storage.HideComment(ctx, id, hidden); err != nil {
+		return err
+	}
+
+	comment, err := tx.Storage.GetComment(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: failed to find post: %w", op, err)
+	}
+	tx.touched[comment.PostID] = struct{}{}
+	return nil
+}
+
+func (tx *txStorage) DeleteComment(ctx context.Context, id string) (int, error) {
+	comment, err := tx.Storage.GetComment(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	tx.touched[comment.PostID] = struct{}{}
+	return tx.Storage.DeleteComment(ctx, id)
+}
+
+func (tx *txStorage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	tx.purge = true
+	return tx.Storage.PurgeAuthor(ctx, author)
+}
+
+func (tx *txStorage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return fn(tx)
+}
@@ -0,0 +1,191 @@
+package cache_test
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/cache"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/mocks"
+	"comments-system/internal/storage/storagetest"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() config.Cache {
+	return config.Cache{Enabled: true, Size: 100, TTL: time.Minute}
+}
+
+func TestCachedStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t testing.TB) storage.Storage {
+		return cache.NewCache(inmemory.NewInMemory(), testConfig())
+	})
+}
+
+func BenchmarkCachedStorage(b *testing.B) {
+	storagetest.Bench(b, func(t testing.TB) storage.Storage {
+		return cache.NewCache(inmemory.NewInMemory(), config.Cache{Enabled: true, Size: 10000, TTL: time.Minute})
+	})
+}
+
+func TestCache_GetPostHit(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.Storage{}
+	s := cache.NewCache(next, testConfig())
+
+	next.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1", Version: 1}, nil).Once()
+
+	for i := 0; i < 3; i++ {
+		post, err := s.GetPost(ctx, "post1")
+		require.NoError(t, err)
+		assert.Equal(t, "post1", post.ID)
+	}
+
+	assert.Equal(t, cache.Stats{Hits: 2, Misses: 1, Entries: 1}, s.Stats())
+	next.AssertExpectations(t)
+}
+
+func TestCache_CreateCommentInvalidatesPost(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.Storage{}
+	s := cache.NewCache(next, testConfig())
+
+	next.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1"}, nil).Twice()
+	next.On("GetPost", mock.Anything, "post2").Return(models.Post{ID: "post2"}, nil).Once()
+	next.On("CountCommentsByPost", mock.Anything, "post1", models.CommentFilter{}).Return(0, nil).Once()
+	next.On("CountCommentsByPost", mock.Anything, "post1", models.CommentFilter{}).Return(1, nil).Once()
+	next.On("CreateComment", mock.Anything, mock.Anything).Return(models.Comment{ID: "c1", PostID: "post1"}, nil).Once()
+
+	_, err := s.GetPost(ctx, "post1")
+	require.NoError(t, err)
+	_, err = s.GetPost(ctx, "post2")
+	require.NoError(t, err)
+	count, err := s.CountCommentsByPost(ctx, "post1", models.CommentFilter{})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	_, err = s.CreateComment(ctx, models.Comment{PostID: "post1", Author: "A", Content: "C"})
+	require.NoError(t, err)
+
+	_, err = s.GetPost(ctx, "post1")
+	require.NoError(t, err)
+	_, err = s.GetPost(ctx, "post2")
+	require.NoError(t, err)
+	count, err = s.CountCommentsByPost(ctx, "post1", models.CommentFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	next.AssertExpectations(t)
+}
+
+func TestCache_PagesKeyedByFilter(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.Storage{}
+	s := cache.NewCache(next, testConfig())
+
+	author := "alice"
+	filtered := models.CommentFilter{Author: &author}
+	next.On("GetCommentsByPost", mock.Anything, "post1", models.CommentFilter{}, 10, 0).
+		Return([]models.Comment{{ID: "c1"}, {ID: "c2"}}, nil).Once()
+	next.On("GetCommentsByPost", mock.Anything, "post1", filtered, 10, 0).
+		Return([]models.Comment{{ID: "c1"}}, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		page, err := s.GetCommentsByPost(ctx, "post1", models.CommentFilter{}, 10, 0)
+		require.NoError(t, err)
+		assert.Len(t, page, 2)
+
+		other := "alice"
+		page, err = s.GetCommentsByPost(ctx, "post1", models.CommentFilter{Author: &other}, 10, 0)
+		require.NoError(t, err)
+		assert.Len(t, page, 1)
+	}
+
+	next.AssertExpectations(t)
+}
+
+func TestCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.Storage{}
+	s := cache.NewCache(next, config.Cache{Size: 10, TTL: 20 * time.Millisecond})
+
+	next.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1"}, nil).Twice()
+
+	_, err := s.GetPost(ctx, "post1")
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = s.GetPost(ctx, "post1")
+	require.NoError(t, err)
+
+	next.AssertExpectations(t)
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.Storage{}
+	s := cache.NewCache(next, config.Cache{Size: 2, TTL: time.Minute})
+
+	for _, id := range []string{"a", "b", "c"} {
+		next.On("GetPost", mock.Anything, id).Return(models.Post{ID: id}, nil)
+	}
+
+	for _, id := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, err := s.GetPost(ctx, id)
+		require.NoError(t, err)
+	}
+
+	// "b" was the least recently used when "c" came in, so it was fetched twice.
+	next.AssertNumberOfCalls(t, "GetPost", 4)
+	assert.Equal(t, 2, s.Stats().Entries)
+}
+
+func TestCache_TxWritesInvalidateOnEnd(t *testing.T) {
+	ctx := context.Background()
+	s := cache.NewCache(inmemory.NewInMemory(), testConfig())
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "T", Content: "C", Author: "A"})
+	require.NoError(t, err)
+	_, err = s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+
+	err = s.WithTx(ctx, func(tx storage.Storage) error {
+		_, err := tx.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A", Content: "C"})
+		return err
+	})
+	require.NoError(t, err)
+
+	got, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.CommentCount)
+}
+
+func TestCache_ListenInvalidates(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.Storage{}
+	s := cache.NewCache(next, testConfig())
+
+	next.On("GetPost", mock.Anything, "post1").Return(models.Post{ID: "post1"}, nil).Twice()
+
+	_, err := s.GetPost(ctx, "post1")
+	require.NoError(t, err)
+
+	events := make(chan *models.Comment)
+	done := make(chan struct{})
+	go func() {
+		s.Listen(events)
+		close(done)
+	}()
+	events <- &models.Comment{ID: "c1", PostID: "post1"}
+	close(events)
+	<-done
+
+	_, err = s.GetPost(ctx, "post1")
+	require.NoError(t, err)
+
+	next.AssertExpectations(t)
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+// entry is a cached value. Every entry belongs to one post, so all that is
+// known about a post can be dropped together.
+type entry struct {
+	key       string
+	postID    string
+	value     any
+	expiresAt time.Time
+}
+
+// lru is a fixed-size least recently used list of entries with expiry. It
+// is not safe for concurrent use.
+type lru struct {
+	size    int
+	ll      *list.List
+	items   map[string]*list.Element
+	onEvict func(e *entry)
+}
+
+func newLRU(size int, onEvict func(e *entry)) *lru {
+	return &lru{
+		size:    size,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+func (c *lru) get(key string, now time.Time) (any, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !now.Before(e.expiresAt) {
+		c.removeElement(el)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *lru) add(e *entry) {
+	if el, ok := c.items[e.key]; ok {
+		c.removeElement(el)
+	}
+
+	c.items[e.key] = c.ll.PushFront(e)
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lru) remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lru) len() int {
+	return c.ll.Len()
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	if c.onEvict != nil {
+		c.onEvict(e)
+	}
+}
@@ -0,0 +1,53 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"context"
+)
+
+// count adds delta to the counters of the post for comment c.
+func (ps *postState) count(c *models.Comment, delta int) {
+	ps.post.CommentCount += delta
+	if c.ParentID == nil {
+		ps.post.RootCommentCount += delta
+	}
+}
+
+func (s *Storage) RecountComments(ctx context.Context) (int, error) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	return s.recountComments(tenant.SiteFromContext(ctx), s.logRecord)
+}
+
+// recountComments rewrites the posts of site whose counters disagree with
+// the comment indexes; log is nil while restoring, when nothing needs to be
+// logged.
+func (s *Storage) recountComments(site string, log func(...walRecord) error) (int, error) {
+	fixed := 0
+	for i := range s.shards {
+		for _, ps := range s.shards[i].posts {
+			if !inSite(site, ps.post.SiteID) {
+				continue
+			}
+			total, roots := len(ps.roots)+len(ps.replies), len(ps.roots)
+			if ps.post.CommentCount == total && ps.post.RootCommentCount == roots {
+				continue
+			}
+			post := ps.post
+			post.CommentCount, post.RootCommentCount = total, roots
+
+			if log != nil {
+				if err := log(walRecord{Op: opUpdatePost, Post: &post}); err != nil {
+					return fixed, err
+				}
+			}
+
+			ps.post = post
+			fixed++
+		}
+	}
+
+	return fixed, nil
+}
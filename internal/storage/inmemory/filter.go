@@ -0,0 +1,39 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"time"
+)
+
+// filtersFields reports whether filter checks more than the creation time,
+// which the post order answers by itself.
+func filtersFields(filter models.PostFilter) bool {
+	return filter.Author != nil || filter.CommentsEnabled != nil || filter.HasComments != nil
+}
+
+func matchPost(post models.Post, filter models.PostFilter) bool {
+	if filter.Author != nil && post.Author != *filter.Author {
+		return false
+	}
+	if !inRange(post.CreatedAt, filter.CreatedAfter, filter.CreatedBefore) {
+		return false
+	}
+	if filter.CommentsEnabled != nil && post.CommentsEnabled != *filter.CommentsEnabled {
+		return false
+	}
+	if filter.HasComments != nil && (post.CommentCount > 0) != *filter.HasComments {
+		return false
+	}
+	return true
+}
+
+// inRange checks t against optional exclusive bounds.
+func inRange(t time.Time, after, before *time.Time) bool {
+	if after != nil && !t.After(*after) {
+		return false
+	}
+	if before != nil && !t.Before(*before) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package inmemory
+
+import (
+	"comments-system/pkg/errors"
+	"context"
+	"time"
+)
+
+// sweepInterval bounds how often SaveIdempotencyKey scans for expired keys.
+const sweepInterval = time.Minute
+
+type idempotencyEntry struct {
+	Key       string    `json:"key"`
+	EntityID  string    `json:"entityId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// The shard of a key keeps transactions that save it isolated; keysMu
+// guards the map itself.
+func (s *Storage) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	return s.getIdempotencyKey(key)
+}
+
+func (s *Storage) getIdempotencyKey(key string) (string, error) {
+	entry, ok := s.keys[key]
+	if !ok || !entry.ExpiresAt.After(time.Now()) {
+		return "", errors.ErrNotFound
+	}
+	return entry.EntityID, nil
+}
+
+func (s *Storage) SaveIdempotencyKey(ctx context.Context, key, entityID string, expiresAt time.Time) error {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	return s.saveIdempotencyKey(key, entityID, expiresAt, s.logRecord)
+}
+
+func (s *Storage) saveIdempotencyKey(key, entityID string, expiresAt time.Time, log func(...walRecord) error) error {
+	now := time.Now()
+	s.sweepKeys(now)
+
+	if entry, ok := s.keys[key]; ok && entry.ExpiresAt.After(now) {
+		return errors.ErrIdempotencyKeyExists
+	}
+
+	entry := idempotencyEntry{Key: key, EntityID: entityID, ExpiresAt: expiresAt}
+	if err := log(walRecord{Op: opSaveIdempotencyKey, Key: &entry}); err != nil {
+		return err
+	}
+
+	s.applyKey(entry)
+	return nil
+}
+
+// sweepKeys drops expired keys at most once per sweepInterval. Removals are
+// not logged: replay may bring expired keys back, and the next sweep drops
+// them again.
+func (s *Storage) sweepKeys(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(sweepInterval)
+
+	for key, entry := range s.keys {
+		if !entry.ExpiresAt.After(now) {
+			delete(s.keys, key)
+		}
+	}
+}
+
+func (s *Storage) applyKey(entry idempotencyEntry) {
+	s.keys[entry.Key] = entry
+}
@@ -0,0 +1,84 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"time"
+)
+
+func (s *Storage) ImportPost(ctx context.Context, post models.Post) error {
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+
+	sh := s.shard(post.ID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.importPost(post, s.logRecord)
+}
+
+func (s *Storage) importPost(post models.Post, log func(...walRecord) error) error {
+	if s.postState(post.ID) != nil {
+		return errors.ErrAlreadyExists
+	}
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = time.Now()
+	}
+	if post.Version < 1 {
+		post.Version = 1
+	}
+	post.CommentCount, post.RootCommentCount = 0, 0
+
+	if err := log(walRecord{Op: opCreatePost, Post: &post}); err != nil {
+		return err
+	}
+
+	s.applyPost(post)
+	return nil
+}
+
+func (s *Storage) ImportComment(ctx context.Context, comment models.Comment) error {
+	sh := s.shard(comment.PostID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.importComment(tenant.SiteFromContext(ctx), comment, s.logRecord)
+}
+
+// importComment refuses an ID taken on any site, as the SQL backends do.
+func (s *Storage) importComment(site string, comment models.Comment, log func(...walRecord) error) error {
+	if err := storage.ValidateCommentID(comment.ID); err != nil {
+		return err
+	}
+	if s.locate("", comment.ID) != "" {
+		return errors.ErrAlreadyExists
+	}
+	ps := s.sitePost(site, comment.PostID)
+	if ps == nil {
+		return errors.ErrNotFound
+	}
+
+	var parent *models.Comment
+	if comment.ParentID != nil {
+		p, ok := ps.comments[*comment.ParentID]
+		if !ok {
+			return errors.ErrParentNotFound
+		}
+		parent = p
+	}
+
+	comment.SiteID = ps.post.SiteID
+	comment.Path, comment.Depth = storage.CommentPath(parent, comment.ID)
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = time.Now()
+	}
+
+	if err := log(walRecord{Op: opCreateComment, Comment: &comment}); err != nil {
+		return err
+	}
+
+	s.applyComment(comment)
+	return nil
+}
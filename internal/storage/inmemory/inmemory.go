@@ -2,6 +2,8 @@ package inmemory
 
 import (
 	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
 	"comments-system/pkg/errors"
 	"comments-system/pkg/utils"
 	"context"
@@ -10,193 +12,677 @@ import (
 	"time"
 )
 
+// shardCount is the number of shards posts are spread over.
+const shardCount = 64
+
+// Storage keeps every post in one of shardCount shards together with its
+// comments, so operations on different posts lock different shards. Methods
+// that span posts (GetPosts, RecountComments and PurgeAuthor) lock all
+// shards, in order; Search ranks in the search indexes and locks only the
+// shards of its hits; transactions lock the shards they touch, see WithTx.
+// An idempotency key belongs to the shard its key hashes to.
+//
+// A few indexes span shards: the post orders, the comment locator and the
+// search indexes. Each has its own mutex, taken after any shard lock and
+// released before the next lock is taken.
+//
+// Lower-case methods take the site the call is bound to, "" for every site,
+// and treat posts and comments of other sites as missing.
 type Storage struct {
-	postsMu      sync.RWMutex
-	posts        map[string]models.Post
-	commentsMu   sync.RWMutex
-	comments     map[string]models.Comment
-	postComments map[string][]string
-	commentTree  map[string][]string
+	shards [shardCount]shard
+
+	orderMu sync.RWMutex
+	orders  map[string][]*postState // site -> its posts, oldest first; "" holds all posts
+
+	locatorMu sync.RWMutex
+	locator   map[string]location // comment ID -> where the comment is
+
+	postIndex    *searchIndex
+	commentIndex *searchIndex
+
+	keysMu    sync.Mutex
+	keys      map[string]idempotencyEntry
+	nextSweep time.Time
+
+	wal *wal
+}
+
+type shard struct {
+	mu    sync.RWMutex
+	posts map[string]*postState
+}
+
+// postState is a post with its comments and the indexes over them. Roots and
+// replies hold the comments of the post, and children the replies of each
+// comment, oldest first. Comments are shared by pointer between the map and
+// the indexes and copied out to callers.
+type postState struct {
+	post     models.Post
+	comments map[string]*models.Comment
+	roots    []*models.Comment
+	replies  []*models.Comment
+	children map[string][]*models.Comment
+}
+
+type location struct {
+	postID string
+	siteID string
 }
 
 func NewInMemory() *Storage {
-	return &Storage{
-		posts:        make(map[string]models.Post),
-		comments:     make(map[string]models.Comment),
-		postComments: make(map[string][]string),
-		commentTree:  make(map[string][]string),
+	s := &Storage{
+		orders:       make(map[string][]*postState),
+		locator:      make(map[string]location),
+		postIndex:    newSearchIndex("post"),
+		commentIndex: newSearchIndex("comment"),
+		keys:         make(map[string]idempotencyEntry),
+	}
+	for i := range s.shards {
+		s.shards[i].posts = make(map[string]*postState)
+	}
+	return s
+}
+
+// shard returns the shard post id belongs to, whether the post exists or not.
+func (s *Storage) shard(postID string) *shard {
+	return &s.shards[shardIndex(postID)]
+}
+
+func shardIndex(id string) int {
+	// FNV-1a, inlined to stay allocation-free.
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return int(h % shardCount)
+}
+
+// postState returns post id, or nil. The caller holds its shard lock.
+func (s *Storage) postState(id string) *postState {
+	return s.shard(id).posts[id]
+}
+
+// sitePost returns post id if it belongs to site, or nil. The caller holds
+// its shard lock.
+func (s *Storage) sitePost(site, id string) *postState {
+	ps := s.postState(id)
+	if ps == nil || !inSite(site, ps.post.SiteID) {
+		return nil
+	}
+	return ps
+}
+
+// inSite reports whether an entity of entitySite is seen by calls bound to
+// site.
+func inSite(site, entitySite string) bool {
+	return site == "" || site == entitySite
+}
+
+// locate returns the post comment id belongs to, or "" for a comment that
+// is unknown or not of site. Public methods lock the shard of that post and
+// pass the post ID on, so the comment is only looked up under the right
+// lock.
+func (s *Storage) locate(site, id string) string {
+	s.locatorMu.RLock()
+	defer s.locatorMu.RUnlock()
+
+	loc, ok := s.locator[id]
+	if !ok || !inSite(site, loc.siteID) {
+		return ""
+	}
+	return loc.postID
+}
+
+// comment returns comment id of post postID with its post, or
+// errors.ErrNotFound. The caller holds the shard lock of postID.
+func (s *Storage) comment(postID, id string) (*postState, *models.Comment, error) {
+	ps := s.postState(postID)
+	if ps == nil {
+		return nil, nil, errors.ErrNotFound
+	}
+	c, ok := ps.comments[id]
+	if !ok {
+		return nil, nil, errors.ErrNotFound
+	}
+	return ps, c, nil
+}
+
+func (s *Storage) lockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+	}
+}
+
+func (s *Storage) unlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+func (s *Storage) rlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+	}
+}
+
+func (s *Storage) runlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.RUnlock()
 	}
 }
 
 func (s *Storage) CreatePost(ctx context.Context, post models.Post) (models.Post, error) {
-	s.postsMu.Lock()
-	defer s.postsMu.Unlock()
+	if post.ID == "" {
+		post.ID = utils.GenerateID()
+	}
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+
+	sh := s.shard(post.ID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
+	return s.createPost(post, s.logRecord)
+}
+
+func (s *Storage) createPost(post models.Post, log func(...walRecord) error) (models.Post, error) {
 	if post.ID == "" {
 		post.ID = utils.GenerateID()
 	}
+	if s.postState(post.ID) != nil {
+		return models.Post{}, errors.ErrAlreadyExists
+	}
 	post.CreatedAt = time.Now()
-	s.posts[post.ID] = post
+	post.Version = 1
+	post.CommentCount, post.RootCommentCount = 0, 0
+
+	if err := log(walRecord{Op: opCreatePost, Post: &post}); err != nil {
+		return models.Post{}, err
+	}
+
+	s.applyPost(post)
 	return post, nil
 }
 
-func (s *Storage) GetPosts(ctx context.Context, limit, offset int) ([]models.Post, error) {
-	s.postsMu.RLock()
-	defer s.postsMu.RUnlock()
+func (s *Storage) GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error) {
+	s.rlockAll()
+	defer s.runlockAll()
 
-	posts := make([]models.Post, 0, len(s.posts))
-	for _, p := range s.posts {
-		posts = append(posts, p)
-	}
-
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].CreatedAt.After(posts[j].CreatedAt)
-	})
+	return s.getPosts(tenant.SiteFromContext(ctx), filter, limit, offset), nil
+}
 
-	start := offset
-	if start > len(posts) {
-		start = len(posts)
-	}
-	end := start + limit
-	if end > len(posts) {
-		end = len(posts)
+// getPosts walks the post order of site newest first within the creation
+// time bounds of filter and stops as soon as the page is full.
+func (s *Storage) getPosts(site string, filter models.PostFilter, limit, offset int) []models.Post {
+	s.orderMu.RLock()
+	defer s.orderMu.RUnlock()
+
+	order := s.orders[site]
+	lo, hi := byPost.span(order, filter.CreatedAfter, filter.CreatedBefore)
+	if !filtersFields(filter) {
+		lo = max(lo, hi-offset-limit)
+		hi = max(lo, hi-offset)
+		posts := make([]models.Post, 0, hi-lo)
+		for i := hi - 1; i >= lo; i-- {
+			posts = append(posts, order[i].post)
+		}
+		return posts
 	}
 
-	return posts[start:end], nil
+	var posts []models.Post
+	for i := hi - 1; i >= lo && len(posts) < limit; i-- {
+		if !matchPost(order[i].post, filter) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		posts = append(posts, order[i].post)
+	}
+	return posts
 }
 
 func (s *Storage) GetPost(ctx context.Context, id string) (models.Post, error) {
-	s.postsMu.RLock()
-	defer s.postsMu.RUnlock()
+	sh := s.shard(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	post, ok := s.posts[id]
-	if !ok {
+	return s.getPost(tenant.SiteFromContext(ctx), id)
+}
+
+func (s *Storage) getPost(site, id string) (models.Post, error) {
+	ps := s.sitePost(site, id)
+	if ps == nil {
 		return models.Post{}, errors.ErrNotFound
 	}
-	return post, nil
+	return ps.post, nil
 }
 
 func (s *Storage) UpdatePost(ctx context.Context, post models.Post) error {
-	s.postsMu.Lock()
-	defer s.postsMu.Unlock()
+	sh := s.shard(post.ID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.updatePost(tenant.SiteFromContext(ctx), post, s.logRecord)
+}
 
-	if _, ok := s.posts[post.ID]; !ok {
+// updatePost keeps the creation time, which the post is ordered by, and the
+// site; the SQL backends do not update them either.
+func (s *Storage) updatePost(site string, post models.Post, log func(...walRecord) error) error {
+	ps := s.sitePost(site, post.ID)
+	if ps == nil {
 		return errors.ErrNotFound
 	}
-	s.posts[post.ID] = post
+	current := ps.post
+	if current.Version != post.Version {
+		return &errors.ConflictError{CurrentVersion: current.Version}
+	}
+	post.Version++
+	post.SiteID = current.SiteID
+	post.CreatedAt = current.CreatedAt
+	post.CommentCount, post.RootCommentCount = current.CommentCount, current.RootCommentCount
+
+	if err := log(walRecord{Op: opUpdatePost, Post: &post}); err != nil {
+		return err
+	}
+
+	s.applyPost(post)
 	return nil
 }
 
 func (s *Storage) CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error) {
-	s.commentsMu.Lock()
-	defer s.commentsMu.Unlock()
+	sh := s.shard(comment.PostID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	if _, err := s.GetPost(ctx, comment.PostID); err != nil {
-		return models.Comment{}, err
+	return s.createComment(tenant.SiteFromContext(ctx), comment, s.logRecord)
+}
+
+func (s *Storage) createComment(site string, comment models.Comment, log func(...walRecord) error) (models.Comment, error) {
+	ps := s.sitePost(site, comment.PostID)
+	if ps == nil {
+		return models.Comment{}, errors.ErrNotFound
 	}
 
+	var parent *models.Comment
 	if comment.ParentID != nil {
-		parent, ok := s.comments[*comment.ParentID]
-		if !ok || parent.PostID != comment.PostID {
+		p, ok := ps.comments[*comment.ParentID]
+		if !ok {
 			return models.Comment{}, errors.ErrParentNotFound
 		}
+		parent = p
 	}
 
 	if comment.ID == "" {
 		comment.ID = utils.GenerateID()
 	}
+	comment.SiteID = ps.post.SiteID
+	comment.Path, comment.Depth = storage.CommentPath(parent, comment.ID)
 	comment.CreatedAt = time.Now()
 
-	s.comments[comment.ID] = comment
-
-	s.postComments[comment.PostID] = append(s.postComments[comment.PostID], comment.ID)
-
-	if comment.ParentID != nil {
-		s.commentTree[*comment.ParentID] = append(s.commentTree[*comment.ParentID], comment.ID)
+	if err := log(walRecord{Op: opCreateComment, Comment: &comment}); err != nil {
+		return models.Comment{}, err
 	}
 
+	s.applyComment(comment)
 	return comment, nil
 }
 
 func (s *Storage) GetComment(ctx context.Context, id string) (models.Comment, error) {
-	s.commentsMu.RLock()
-	defer s.commentsMu.RUnlock()
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	comment, ok := s.comments[id]
-	if !ok {
-		return models.Comment{}, errors.ErrNotFound
+	return s.getComment(postID, id)
+}
+
+func (s *Storage) getComment(postID, id string) (models.Comment, error) {
+	_, c, err := s.comment(postID, id)
+	if err != nil {
+		return models.Comment{}, err
 	}
-	return comment, nil
+	return *c, nil
 }
 
-func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, limit, offset int) ([]models.Comment, error) {
-	s.commentsMu.RLock()
-	defer s.commentsMu.RUnlock()
+func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, error) {
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	commentIDs, ok := s.postComments[postID]
-	if !ok {
-		return nil, nil
-	}
+	return s.getCommentsByPost(tenant.SiteFromContext(ctx), postID, filter, limit, offset), nil
+}
 
-	var rootComments []models.Comment
-	for _, id := range commentIDs {
-		if comment, ok := s.comments[id]; ok && comment.ParentID == nil {
-			rootComments = append(rootComments, comment)
-		}
+// listed returns the index filter selects from, roots or replies, and the
+// bounds of its creation time range there.
+func (ps *postState) listed(filter models.CommentFilter) (list []*models.Comment, lo, hi int) {
+	list = ps.roots
+	if filter.HasParent != nil && *filter.HasParent {
+		list = ps.replies
 	}
+	lo, hi = byComment.span(list, filter.CreatedAfter, filter.CreatedBefore)
+	return list, lo, hi
+}
 
-	sort.Slice(rootComments, func(i, j int) bool {
-		return rootComments[i].CreatedAt.After(rootComments[j].CreatedAt)
-	})
+// getCommentsByPost reads the page straight off the index unless it filters
+// by author, when it walks the index newest first until the page is full.
+func (s *Storage) getCommentsByPost(site, postID string, filter models.CommentFilter, limit, offset int) []models.Comment {
+	ps := s.sitePost(site, postID)
+	if ps == nil {
+		return nil
+	}
+	list, lo, hi := ps.listed(filter)
 
-	start := offset
-	if start > len(rootComments) {
-		start = len(rootComments)
+	if filter.Author == nil {
+		lo = max(lo, hi-offset-limit)
+		hi = max(lo, hi-offset)
+		if lo == hi {
+			return nil
+		}
+		comments := make([]models.Comment, 0, hi-lo)
+		for i := hi - 1; i >= lo; i-- {
+			comments = append(comments, *list[i])
+		}
+		return comments
 	}
-	end := start + limit
-	if end > len(rootComments) {
-		end = len(rootComments)
+
+	var comments []models.Comment
+	for i := hi - 1; i >= lo && len(comments) < limit; i-- {
+		if list[i].Author != *filter.Author {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		comments = append(comments, *list[i])
 	}
+	return comments
+}
 
-	return rootComments[start:end], nil
+func (s *Storage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	return s.countCommentsByPost(tenant.SiteFromContext(ctx), postID, filter), nil
 }
 
-func (s *Storage) CountCommentsByPost(ctx context.Context, postID string) (int, error) {
-	s.commentsMu.RLock()
-	defer s.commentsMu.RUnlock()
+func (s *Storage) countCommentsByPost(site, postID string, filter models.CommentFilter) int {
+	ps := s.sitePost(site, postID)
+	if ps == nil {
+		return 0
+	}
+	list, lo, hi := ps.listed(filter)
 
+	if filter.Author == nil {
+		return hi - lo
+	}
 	count := 0
-	for _, id := range s.postComments[postID] {
-		if comment, ok := s.comments[id]; ok && comment.ParentID == nil {
+	for _, c := range list[lo:hi] {
+		if c.Author == *filter.Author {
 			count++
 		}
 	}
-	return count, nil
+	return count
 }
 
 func (s *Storage) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
-	s.commentsMu.RLock()
-	defer s.commentsMu.RUnlock()
+	postID := s.locate(tenant.SiteFromContext(ctx), parentID)
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	replyIDs, ok := s.commentTree[parentID]
-	if !ok {
-		return nil, nil
+	return s.getCommentReplies(postID, parentID), nil
+}
+
+func (s *Storage) getCommentReplies(postID, parentID string) []models.Comment {
+	ps := s.postState(postID)
+	if ps == nil || len(ps.children[parentID]) == 0 {
+		return nil
 	}
 
-	replies := make([]models.Comment, 0, len(replyIDs))
-	for _, id := range replyIDs {
-		if comment, ok := s.comments[id]; ok {
-			replies = append(replies, comment)
+	replies := make([]models.Comment, len(ps.children[parentID]))
+	for i, c := range ps.children[parentID] {
+		replies[i] = *c
+	}
+	return replies
+}
+
+func (s *Storage) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	return s.getCommentAncestors(postID, id)
+}
+
+func (s *Storage) getCommentAncestors(postID, id string) ([]string, error) {
+	_, c, err := s.comment(postID, id)
+	if err != nil {
+		return nil, err
+	}
+	return storage.PathAncestors(c.Path), nil
+}
+
+func (s *Storage) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	return s.getCommentSubtree(postID, id, maxDepth)
+}
+
+func (s *Storage) getCommentSubtree(postID, id string, maxDepth int) ([]models.Comment, error) {
+	ps, root, err := s.comment(postID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtree []models.Comment
+	stack := append([]*models.Comment(nil), ps.children[id]...)
+	for len(stack) > 0 {
+		child := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if maxDepth > 0 && child.Depth > root.Depth+maxDepth {
+			continue
 		}
+		subtree = append(subtree, *child)
+		stack = append(stack, ps.children[child.ID]...)
 	}
 
-	sort.Slice(replies, func(i, j int) bool {
-		return replies[i].CreatedAt.Before(replies[j].CreatedAt)
+	sort.Slice(subtree, func(i, j int) bool {
+		return subtree[i].Path < subtree[j].Path
 	})
 
-	return replies, nil
+	return subtree, nil
 }
 
-func (s *Storage) Close() error {
+func (s *Storage) LockThread(ctx context.Context, id string) error {
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.lockThread(postID, id, s.logRecord)
+}
+
+func (s *Storage) lockThread(postID, id string, log func(...walRecord) error) error {
+	_, c, err := s.comment(postID, id)
+	if err != nil {
+		return err
+	}
+	comment := *c
+	comment.Locked = true
+
+	if err := log(walRecord{Op: opUpdateComment, Comment: &comment}); err != nil {
+		return err
+	}
+
+	s.applyComment(comment)
 	return nil
 }
+
+func (s *Storage) IsThreadLocked(ctx context.Context, id string) (bool, error) {
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	return s.isThreadLocked(postID, id)
+}
+
+func (s *Storage) isThreadLocked(postID, id string) (bool, error) {
+	ps, c, err := s.comment(postID, id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ancestorID := range append(storage.PathAncestors(c.Path), id) {
+		if a, ok := ps.comments[ancestorID]; ok && a.Locked {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Storage) Close() error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.closeWAL()
+}
+
+// The lower-case methods above do the work without locking so that public
+// methods and transactions can share them; the caller holds the shard locks
+// of the posts involved. Comment methods take the post ID the comment was
+// located in, see locate.
+
+// applyPost and applyComment change state without validation. They are shared
+// by live mutations and log replay; the caller holds the shard lock of the
+// post. A post without a site, logged before sites existed, goes to the
+// default site. A comment takes the site of its post, and a comment of an
+// unknown post is dropped.
+func (s *Storage) applyPost(post models.Post) {
+	if post.SiteID == "" {
+		post.SiteID = tenant.DefaultSite
+	}
+	sh := s.shard(post.ID)
+	ps, exists := sh.posts[post.ID]
+	reindex := !exists || ps.post.Title != post.Title || ps.post.Content != post.Content
+
+	switch {
+	case !exists:
+		ps = &postState{
+			post:     post,
+			comments: make(map[string]*models.Comment),
+			children: make(map[string][]*models.Comment),
+		}
+		sh.posts[post.ID] = ps
+
+		s.orderMu.Lock()
+		s.order(ps)
+		s.orderMu.Unlock()
+	case !ps.post.CreatedAt.Equal(post.CreatedAt) || ps.post.SiteID != post.SiteID:
+		s.orderMu.Lock()
+		s.unorder(ps)
+		ps.post = post
+		s.order(ps)
+		s.orderMu.Unlock()
+	default:
+		ps.post = post
+	}
+
+	if reindex {
+		s.indexPost(post)
+	} else {
+		s.postIndex.tag(post.ID, postMeta(post))
+	}
+}
+
+// order adds ps to the post order of its site and of all posts, and unorder
+// takes it out of them. The caller holds orderMu.
+func (s *Storage) order(ps *postState) {
+	s.orders[""] = byPost.insert(s.orders[""], ps)
+	s.orders[ps.post.SiteID] = byPost.insert(s.orders[ps.post.SiteID], ps)
+}
+
+func (s *Storage) unorder(ps *postState) {
+	s.orders[""] = byPost.remove(s.orders[""], ps.post.CreatedAt, ps.post.ID)
+	s.orders[ps.post.SiteID] = byPost.remove(s.orders[ps.post.SiteID], ps.post.CreatedAt, ps.post.ID)
+}
+
+func (s *Storage) applyComment(comment models.Comment) {
+	ps := s.postState(comment.PostID)
+	if ps == nil {
+		return
+	}
+	comment.SiteID = ps.post.SiteID
+
+	if c, exists := ps.comments[comment.ID]; exists {
+		reindex := c.Content != comment.Content
+		if c.CreatedAt.Equal(comment.CreatedAt) && sameParent(c.ParentID, comment.ParentID) {
+			*c = comment
+		} else {
+			ps.unlink(c)
+			ps.count(c, -1)
+			*c = comment
+			ps.link(c)
+			ps.count(c, 1)
+		}
+		if reindex {
+			s.indexComment(comment)
+		} else {
+			s.commentIndex.tag(comment.ID, commentMeta(comment))
+		}
+		return
+	}
+
+	c := &comment
+	ps.comments[c.ID] = c
+	ps.link(c)
+	ps.count(c, 1)
+
+	s.locatorMu.Lock()
+	s.locator[c.ID] = location{postID: c.PostID, siteID: c.SiteID}
+	s.locatorMu.Unlock()
+
+	s.indexComment(comment)
+}
+
+// link adds c to the indexes of the post and unlink takes it out of them.
+func (ps *postState) link(c *models.Comment) {
+	if c.ParentID == nil {
+		ps.roots = byComment.insert(ps.roots, c)
+		return
+	}
+	ps.replies = byComment.insert(ps.replies, c)
+	ps.children[*c.ParentID] = byComment.insert(ps.children[*c.ParentID], c)
+}
+
+func (ps *postState) unlink(c *models.Comment) {
+	if c.ParentID == nil {
+		ps.roots = byComment.remove(ps.roots, c.CreatedAt, c.ID)
+		return
+	}
+	ps.replies = byComment.remove(ps.replies, c.CreatedAt, c.ID)
+
+	parentID := *c.ParentID
+	siblings := byComment.remove(ps.children[parentID], c.CreatedAt, c.ID)
+	if len(siblings) == 0 {
+		delete(ps.children, parentID)
+	} else {
+		ps.children[parentID] = siblings
+	}
+}
+
+func sameParent(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -2,15 +2,32 @@ package inmemory_test
 
 import (
 	"comments-system/internal/models"
+	"comments-system/internal/storage"
 	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/storagetest"
 	"comments-system/pkg/errors"
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+func TestInMemoryStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t testing.TB) storage.Storage {
+		return inmemory.NewInMemory()
+	})
+}
+
+func BenchmarkInMemoryStorage(b *testing.B) {
+	storagetest.Bench(b, func(t testing.TB) storage.Storage {
+		return inmemory.NewInMemory()
+	})
+}
+
 func TestInMemoryStorage(t *testing.T) {
 	ctx := context.Background()
 	storage := inmemory.NewInMemory()
@@ -73,11 +90,11 @@ func TestInMemoryStorage(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		posts, err := storage.GetPosts(ctx, 2, 0)
+		posts, err := storage.GetPosts(ctx, models.PostFilter{}, 2, 0)
 		require.NoError(t, err)
 		require.Len(t, posts, 2)
 
-		posts, err = storage.GetPosts(ctx, 2, 2)
+		posts, err = storage.GetPosts(ctx, models.PostFilter{}, 2, 2)
 		require.NoError(t, err)
 		require.Len(t, posts, 1)
 	})
@@ -177,11 +194,11 @@ func TestInMemoryStorage(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		comments, err := storage.GetCommentsByPost(ctx, createdPost.ID, 2, 0)
+		comments, err := storage.GetCommentsByPost(ctx, createdPost.ID, models.CommentFilter{}, 2, 0)
 		require.NoError(t, err)
 		require.Len(t, comments, 2)
 
-		comments, err = storage.GetCommentsByPost(ctx, createdPost.ID, 2, 2)
+		comments, err = storage.GetCommentsByPost(ctx, createdPost.ID, models.CommentFilter{}, 2, 2)
 		require.NoError(t, err)
 		require.Len(t, comments, 1)
 	})
@@ -205,7 +222,7 @@ func TestInMemoryStorage(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		count, err := storage.CountCommentsByPost(ctx, createdPost.ID)
+		count, err := storage.CountCommentsByPost(ctx, createdPost.ID, models.CommentFilter{})
 		require.NoError(t, err)
 		require.Equal(t, 3, count)
 	})
@@ -242,4 +259,122 @@ func TestInMemoryStorage(t *testing.T) {
 		require.NoError(t, err)
 		require.Len(t, replies, 2)
 	})
+
+	t.Run("Get Comment Ancestors", func(t *testing.T) {
+		post := models.Post{
+			Title:   "Post for ancestors",
+			Content: "Content",
+			Author:  "Author",
+		}
+		createdPost, err := storage.CreatePost(ctx, post)
+		require.NoError(t, err)
+
+		root, err := storage.CreateComment(ctx, models.Comment{
+			PostID:  createdPost.ID,
+			Author:  "Root",
+			Content: "Root comment",
+		})
+		require.NoError(t, err)
+
+		child, err := storage.CreateComment(ctx, models.Comment{
+			PostID:   createdPost.ID,
+			ParentID: &root.ID,
+			Author:   "Child",
+			Content:  "Child comment",
+		})
+		require.NoError(t, err)
+
+		grandchild, err := storage.CreateComment(ctx, models.Comment{
+			PostID:   createdPost.ID,
+			ParentID: &child.ID,
+			Author:   "Grandchild",
+			Content:  "Grandchild comment",
+		})
+		require.NoError(t, err)
+
+		ancestors, err := storage.GetCommentAncestors(ctx, grandchild.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{root.ID, child.ID}, ancestors)
+
+		ancestors, err = storage.GetCommentAncestors(ctx, root.ID)
+		require.NoError(t, err)
+		require.Empty(t, ancestors)
+
+		_, err = storage.GetCommentAncestors(ctx, "nonexistent")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+}
+
+// The posts "first" and "second" fall in different shards, "first" in the
+// lower one.
+func TestInMemoryStorage_TxLocking(t *testing.T) {
+	ctx := context.Background()
+	s := inmemory.NewInMemory()
+
+	for _, id := range []string{"first", "second"} {
+		_, err := s.CreatePost(ctx, models.Post{ID: id, Title: id, Author: "Author", CommentsEnabled: true})
+		require.NoError(t, err)
+	}
+
+	t.Run("A transaction leaves other posts available", func(t *testing.T) {
+		done := make(chan error)
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			if _, err := tx.CreateComment(ctx, models.Comment{PostID: "first", Author: "A", Content: "In tx"}); err != nil {
+				return err
+			}
+
+			go func() {
+				_, err := s.GetPost(ctx, "second")
+				if err == nil {
+					_, err = s.CreateComment(ctx, models.Comment{PostID: "second", Author: "B", Content: "Outside"})
+				}
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("another post stayed locked")
+			}
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Transactions taking shards in opposite order both commit", func(t *testing.T) {
+		var ready sync.WaitGroup
+		ready.Add(2)
+		var runs atomic.Int32
+
+		crossing := func(from, to string) error {
+			waited := false
+			return s.WithTx(ctx, func(tx storage.Storage) error {
+				runs.Add(1)
+				if _, err := tx.CreateComment(ctx, models.Comment{PostID: from, Author: from, Content: "One"}); err != nil {
+					return err
+				}
+				if !waited {
+					// Both hold their first post before either goes on.
+					waited = true
+					ready.Done()
+					ready.Wait()
+				}
+				_, err := tx.CreateComment(ctx, models.Comment{PostID: to, Author: from, Content: "Two"})
+				return err
+			})
+		}
+
+		errs := make(chan error, 2)
+		go func() { errs <- crossing("first", "second") }()
+		go func() { errs <- crossing("second", "first") }()
+		require.NoError(t, <-errs)
+		require.NoError(t, <-errs)
+
+		require.Equal(t, int32(3), runs.Load(), "the transaction that went down in shard order runs again")
+		for _, id := range []string{"first", "second"} {
+			count, err := s.CountCommentsByPost(ctx, id, models.CommentFilter{})
+			require.NoError(t, err)
+			require.Equal(t, 3, count, id)
+		}
+	})
 }
@@ -0,0 +1,199 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"sort"
+)
+
+func (s *Storage) HideComment(ctx context.Context, id string, hidden bool) error {
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.hideComment(postID, id, hidden, s.logRecord)
+}
+
+func (s *Storage) hideComment(postID, id string, hidden bool, log func(...walRecord) error) error {
+	_, c, err := s.comment(postID, id)
+	if err != nil {
+		return err
+	}
+	comment := *c
+	comment.Hidden = hidden
+
+	if err := log(walRecord{Op: opUpdateComment, Comment: &comment}); err != nil {
+		return err
+	}
+
+	s.applyComment(comment)
+	return nil
+}
+
+func (s *Storage) DeleteComment(ctx context.Context, id string) (int, error) {
+	postID := s.locate(tenant.SiteFromContext(ctx), id)
+	sh := s.shard(postID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.deleteComment(postID, id, s.logRecord)
+}
+
+func (s *Storage) deleteComment(postID, id string, log func(...walRecord) error) (int, error) {
+	_, c, err := s.comment(postID, id)
+	if err != nil {
+		return 0, err
+	}
+	return s.deleteThread(*c, log)
+}
+
+// deleteThread removes comment and its descendants, replies before their
+// parents, so every prefix of the log describes a consistent tree.
+func (s *Storage) deleteThread(comment models.Comment, log func(...walRecord) error) (int, error) {
+	subtree, err := s.getCommentSubtree(comment.PostID, comment.ID, 0)
+	if err != nil {
+		return 0, err
+	}
+	thread := append([]models.Comment{comment}, subtree...)
+
+	for i := len(thread) - 1; i >= 0; i-- {
+		c := thread[i]
+		if err := log(walRecord{Op: opDeleteComment, Comment: &c}); err != nil {
+			return 0, err
+		}
+		s.removeComment(c.PostID, c.ID)
+	}
+	return len(thread), nil
+}
+
+// deletePost removes post id with all its comments and returns how many
+// comments went with it.
+func (s *Storage) deletePost(id string, log func(...walRecord) error) (int, error) {
+	ps := s.postState(id)
+	if ps == nil {
+		return 0, errors.ErrNotFound
+	}
+
+	comments := make([]models.Comment, 0, len(ps.comments))
+	for _, c := range ps.comments {
+		comments = append(comments, *c)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].Depth > comments[j].Depth
+	})
+
+	for _, c := range comments {
+		if err := log(walRecord{Op: opDeleteComment, Comment: &c}); err != nil {
+			return 0, err
+		}
+		s.removeComment(c.PostID, c.ID)
+	}
+
+	post := ps.post
+	if err := log(walRecord{Op: opDeletePost, Post: &post}); err != nil {
+		return 0, err
+	}
+	s.removePost(id)
+
+	return len(comments), nil
+}
+
+func (s *Storage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	return s.purgeAuthor(tenant.SiteFromContext(ctx), author, s.logRecord)
+}
+
+func (s *Storage) purgeAuthor(site, author string, log func(...walRecord) error) (models.PurgeResult, error) {
+	var purged models.PurgeResult
+
+	var posts []string
+	for i := range s.shards {
+		for id, ps := range s.shards[i].posts {
+			if ps.post.Author == author && inSite(site, ps.post.SiteID) {
+				posts = append(posts, id)
+			}
+		}
+	}
+	for _, id := range posts {
+		deleted, err := s.deletePost(id, log)
+		if err != nil {
+			return purged, err
+		}
+		purged.Posts++
+		purged.Comments += deleted
+	}
+
+	var authored []models.Comment
+	for i := range s.shards {
+		for _, ps := range s.shards[i].posts {
+			for _, c := range ps.comments {
+				if c.Author == author && inSite(site, c.SiteID) {
+					authored = append(authored, *c)
+				}
+			}
+		}
+	}
+	// A thread root comes before the replies it takes down with it.
+	sort.Slice(authored, func(i, j int) bool {
+		return authored[i].Path < authored[j].Path
+	})
+
+	for _, comment := range authored {
+		if _, _, err := s.comment(comment.PostID, comment.ID); err != nil {
+			continue
+		}
+		deleted, err := s.deleteThread(comment, log)
+		if err != nil {
+			return purged, err
+		}
+		purged.Comments += deleted
+	}
+
+	return purged, nil
+}
+
+// removePost and removeComment are the deleting counterparts of applyPost
+// and applyComment. The comments of a post are deleted before it and the
+// replies of a comment before it, so removePost only drops what is left in
+// the shared indexes.
+func (s *Storage) removePost(id string) {
+	sh := s.shard(id)
+	ps, ok := sh.posts[id]
+	if !ok {
+		return
+	}
+
+	delete(sh.posts, id)
+	for commentID := range ps.comments {
+		s.locatorMu.Lock()
+		delete(s.locator, commentID)
+		s.locatorMu.Unlock()
+		s.commentIndex.remove(commentID)
+	}
+	s.orderMu.Lock()
+	s.unorder(ps)
+	s.orderMu.Unlock()
+	s.postIndex.remove(id)
+}
+
+func (s *Storage) removeComment(postID, id string) {
+	ps, c, err := s.comment(postID, id)
+	if err != nil {
+		return
+	}
+
+	delete(ps.comments, id)
+	ps.unlink(c)
+	ps.count(c, -1)
+
+	s.locatorMu.Lock()
+	delete(s.locator, id)
+	s.locatorMu.Unlock()
+
+	s.commentIndex.remove(id)
+}
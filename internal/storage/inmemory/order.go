@@ -0,0 +1,82 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"sort"
+	"time"
+)
+
+// Posts and comments are indexed in slices ordered by creation time, then
+// ID, oldest first: the order every listing uses, read backwards for newest
+// first. New entities are the newest, so keeping a slice sorted is usually
+// an append; imported ones are put in place with a binary search.
+
+// orderKey returns what an indexed entity is ordered by.
+type orderKey[T any] func(T) (time.Time, string)
+
+var (
+	byComment orderKey[*models.Comment] = func(c *models.Comment) (time.Time, string) {
+		return c.CreatedAt, c.ID
+	}
+	byPost orderKey[*postState] = func(p *postState) (time.Time, string) {
+		return p.post.CreatedAt, p.post.ID
+	}
+)
+
+// search returns the index at which an entity created at t with id belongs.
+func (key orderKey[T]) search(items []T, t time.Time, id string) int {
+	return sort.Search(len(items), func(i int) bool {
+		it, iid := key(items[i])
+		if !it.Equal(t) {
+			return it.After(t)
+		}
+		return iid >= id
+	})
+}
+
+func (key orderKey[T]) insert(items []T, item T) []T {
+	t, id := key(item)
+	i := key.search(items, t, id)
+	if i == len(items) {
+		return append(items, item)
+	}
+	items = append(items, item)
+	copy(items[i+1:], items[i:])
+	items[i] = item
+	return items
+}
+
+// remove deletes the entity ordered as t and id. The tail is shifted down
+// in place, so the slice keeps its capacity.
+func (key orderKey[T]) remove(items []T, t time.Time, id string) []T {
+	i := key.search(items, t, id)
+	if i == len(items) {
+		return items
+	}
+	if it, iid := key(items[i]); !it.Equal(t) || iid != id {
+		return items
+	}
+	var zero T
+	copy(items[i:], items[i+1:])
+	items[len(items)-1] = zero
+	return items[:len(items)-1]
+}
+
+// span returns the bounds [lo, hi) of the entities created strictly between
+// the optional after and before.
+func (key orderKey[T]) span(items []T, after, before *time.Time) (lo, hi int) {
+	lo, hi = 0, len(items)
+	if after != nil {
+		lo = sort.Search(len(items), func(i int) bool {
+			t, _ := key(items[i])
+			return t.After(*after)
+		})
+	}
+	if before != nil {
+		hi = sort.Search(len(items), func(i int) bool {
+			t, _ := key(items[i])
+			return !t.Before(*before)
+		})
+	}
+	return lo, max(lo, hi)
+}
@@ -0,0 +1,477 @@
+package inmemory
+
+import (
+	"bufio"
+	"bytes"
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	opCreatePost    = "create_post"
+	opUpdatePost    = "update_post"
+	opCreateComment = "create_comment"
+	opUpdateComment = "update_comment"
+	opDeletePost    = "delete_post"
+	opDeleteComment = "delete_comment"
+
+	opSaveIdempotencyKey = "save_idempotency_key"
+)
+
+// walRecord is one line of the write-ahead log. Seq grows monotonically and
+// survives snapshots, so replay can skip records already in the snapshot.
+// More marks every record of a transaction but its last, so replay applies
+// a transaction only once all of it is in the log.
+type walRecord struct {
+	Seq     uint64            `json:"seq"`
+	Op      string            `json:"op"`
+	More    bool              `json:"more,omitempty"`
+	Post    *models.Post      `json:"post,omitempty"`
+	Comment *models.Comment   `json:"comment,omitempty"`
+	Key     *idempotencyEntry `json:"key,omitempty"`
+}
+
+// snapshot is the full state. The comment indexes are rebuilt on load and
+// not part of it.
+type snapshot struct {
+	Seq      uint64                      `json:"seq"`
+	Posts    map[string]models.Post      `json:"posts"`
+	Comments map[string]models.Comment   `json:"comments"`
+	Keys     map[string]idempotencyEntry `json:"idempotencyKeys"`
+}
+
+type wal struct {
+	mu      sync.Mutex
+	cfg     config.Persistence
+	file    *os.File
+	seq     uint64
+	pending int
+	dirty   bool
+
+	compact chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewInMemoryWithPersistence restores the storage from the snapshot and
+// write-ahead log in cfg.Dir and keeps logging every mutation there.
+func NewInMemoryWithPersistence(cfg config.Persistence) (*Storage, error) {
+	const op = "storage.inmemory.NewInMemoryWithPersistence"
+
+	switch cfg.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("%s: unknown fsync policy %q", op, cfg.Fsync)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%s: failed to create data directory: %w", op, err)
+	}
+
+	s := NewInMemory()
+
+	seq, err := s.loadSnapshot(filepath.Join(cfg.Dir, snapshotFileName))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	seq, pending, err := s.replay(filepath.Join(cfg.Dir, walFileName), seq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.backfillPaths()
+	// Counters are derived data: recomputing them covers logs written
+	// before they existed.
+	s.recountComments("", nil)
+
+	file, err := os.OpenFile(filepath.Join(cfg.Dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open log: %w", op, err)
+	}
+
+	s.wal = &wal{
+		cfg:     cfg,
+		file:    file,
+		seq:     seq,
+		pending: pending,
+		compact: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	s.wal.wg.Add(1)
+	go s.maintain()
+
+	return s, nil
+}
+
+// Snapshot writes the full state atomically and truncates the log. Writers
+// are blocked while it runs. It is a no-op without persistence.
+func (s *Storage) Snapshot() error {
+	const op = "storage.inmemory.Snapshot"
+
+	if s.wal == nil {
+		return nil
+	}
+
+	s.rlockAll()
+	defer s.runlockAll()
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+
+	snap := snapshot{
+		Seq:      s.wal.seq,
+		Posts:    make(map[string]models.Post),
+		Comments: make(map[string]models.Comment),
+		Keys:     s.keys,
+	}
+	for i := range s.shards {
+		for id, ps := range s.shards[i].posts {
+			snap.Posts[id] = ps.post
+			for commentID, c := range ps.comments {
+				snap.Comments[commentID] = *c
+			}
+		}
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.wal.cfg.Dir, snapshotFileName), data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.wal.file.Truncate(0); err != nil {
+		return fmt.Errorf("%s: failed to truncate log: %w", op, err)
+	}
+	if err := s.wal.file.Sync(); err != nil {
+		return fmt.Errorf("%s: failed to sync log: %w", op, err)
+	}
+	s.wal.pending = 0
+	s.wal.dirty = false
+
+	return nil
+}
+
+func (s *Storage) logRecord(recs ...walRecord) error {
+	if s.wal == nil || len(recs) == 0 {
+		return nil
+	}
+	return s.wal.append(recs...)
+}
+
+// append writes the records of one transaction with a single write. A
+// crash can still cut the write short; see replay for how the remains of
+// the transaction are dropped.
+func (w *wal) append(recs ...walRecord) error {
+	const op = "storage.inmemory.wal.append"
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var buf bytes.Buffer
+	seq := w.seq
+	for i, rec := range recs {
+		seq++
+		rec.Seq = seq
+		rec.More = i < len(recs)-1
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if w.cfg.Fsync == FsyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		w.dirty = true
+	}
+
+	w.seq = seq
+	w.pending += len(recs)
+	if w.cfg.CompactAfter > 0 && w.pending >= w.cfg.CompactAfter {
+		select {
+		case w.compact <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.file.Sync()
+}
+
+// maintain runs interval fsyncs and snapshots until the storage is closed.
+// Errors cannot be returned from here; the next Close reports a failing log.
+func (s *Storage) maintain() {
+	defer s.wal.wg.Done()
+
+	var syncTick <-chan time.Time
+	if s.wal.cfg.Fsync == FsyncInterval && s.wal.cfg.FsyncInterval > 0 {
+		ticker := time.NewTicker(s.wal.cfg.FsyncInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
+
+	var snapshotTick <-chan time.Time
+	if s.wal.cfg.SnapshotInterval > 0 {
+		ticker := time.NewTicker(s.wal.cfg.SnapshotInterval)
+		defer ticker.Stop()
+		snapshotTick = ticker.C
+	}
+
+	for {
+		select {
+		case <-syncTick:
+			_ = s.wal.sync()
+		case <-snapshotTick:
+			_ = s.Snapshot()
+		case <-s.wal.compact:
+			_ = s.Snapshot()
+		case <-s.wal.done:
+			return
+		}
+	}
+}
+
+func (s *Storage) closeWAL() error {
+	const op = "storage.inmemory.Close"
+
+	close(s.wal.done)
+	s.wal.wg.Wait()
+
+	if err := s.Snapshot(); err != nil {
+		s.wal.file.Close()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.wal.file.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) loadSnapshot(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	// The counters follow the comments as they are applied.
+	for _, post := range snap.Posts {
+		post.CommentCount, post.RootCommentCount = 0, 0
+		s.applyPost(post)
+	}
+	for _, comment := range snap.Comments {
+		s.applyComment(comment)
+	}
+	if snap.Keys != nil {
+		s.keys = snap.Keys
+	}
+
+	return snap.Seq, nil
+}
+
+// replay applies the transactions in the log newer than the snapshot. A
+// transaction left incomplete at the end of the log by a crash mid-write,
+// whether its last line is torn or missing, is cut off; a corrupt line
+// anywhere else is an error.
+func (s *Storage) replay(path string, seq uint64) (uint64, int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return seq, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset, txStart int64
+	var tx []walRecord
+	pending := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(tx) > 0 {
+				if err := file.Truncate(txStart); err != nil {
+					return 0, 0, fmt.Errorf("failed to truncate incomplete log transaction: %w", err)
+				}
+			} else if len(bytes.TrimSpace(line)) > 0 {
+				if err := file.Truncate(offset); err != nil {
+					return 0, 0, fmt.Errorf("failed to truncate torn log record: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read log: %w", err)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return 0, 0, fmt.Errorf("corrupt log record at offset %d: %w", offset, err)
+		}
+		if len(tx) == 0 {
+			txStart = offset
+		}
+		offset += int64(len(line))
+
+		tx = append(tx, rec)
+		if rec.More {
+			continue
+		}
+
+		for _, rec := range tx {
+			if rec.Seq <= seq {
+				continue
+			}
+			if err := s.replayRecord(rec); err != nil {
+				return 0, 0, err
+			}
+			seq = rec.Seq
+			pending++
+		}
+		tx = tx[:0]
+	}
+
+	return seq, pending, nil
+}
+
+func (s *Storage) replayRecord(rec walRecord) error {
+	switch rec.Op {
+	case opCreatePost, opUpdatePost:
+		if rec.Post == nil {
+			return fmt.Errorf("log record %d: missing post", rec.Seq)
+		}
+		s.applyPost(*rec.Post)
+	case opCreateComment, opUpdateComment:
+		if rec.Comment == nil {
+			return fmt.Errorf("log record %d: missing comment", rec.Seq)
+		}
+		s.applyComment(*rec.Comment)
+	case opDeletePost:
+		if rec.Post == nil {
+			return fmt.Errorf("log record %d: missing post", rec.Seq)
+		}
+		s.removePost(rec.Post.ID)
+	case opDeleteComment:
+		if rec.Comment == nil {
+			return fmt.Errorf("log record %d: missing comment", rec.Seq)
+		}
+		s.removeComment(rec.Comment.PostID, rec.Comment.ID)
+	case opSaveIdempotencyKey:
+		if rec.Key == nil {
+			return fmt.Errorf("log record %d: missing idempotency key", rec.Seq)
+		}
+		s.applyKey(*rec.Key)
+	default:
+		return fmt.Errorf("log record %d: unknown op %q", rec.Seq, rec.Op)
+	}
+	return nil
+}
+
+// backfillPaths sets Path and Depth on comments restored from data written
+// before they were tracked. A parent is always filled before its replies.
+func (s *Storage) backfillPaths() {
+	for i := range s.shards {
+		for _, ps := range s.shards[i].posts {
+			for _, c := range ps.comments {
+				ps.fillPath(c)
+			}
+		}
+	}
+}
+
+func (ps *postState) fillPath(c *models.Comment) {
+	if c.Path != "" {
+		return
+	}
+
+	var parent *models.Comment
+	if c.ParentID != nil {
+		if p, ok := ps.comments[*c.ParentID]; ok {
+			ps.fillPath(p)
+			parent = p
+		}
+	}
+
+	c.Path, c.Depth = storage.CommentPath(parent, c.ID)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to open data directory: %w", err)
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,373 @@
+package inmemory_test
+
+import (
+	"bytes"
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/inmemory"
+	"comments-system/internal/storage/storagetest"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func persistenceConfig(dir string) config.Persistence {
+	return config.Persistence{
+		Enabled: true,
+		Dir:     dir,
+		Fsync:   inmemory.FsyncAlways,
+	}
+}
+
+func TestPersistentStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t testing.TB) storage.Storage {
+		s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(t.TempDir()))
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func BenchmarkPersistentStorage(b *testing.B) {
+	storagetest.Bench(b, func(t testing.TB) storage.Storage {
+		s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(t.TempDir()))
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestPersistentStorage_RecoverFromLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author", CommentsEnabled: true})
+	require.NoError(t, err)
+	post.Title = "Updated"
+	require.NoError(t, s.UpdatePost(ctx, post))
+	root, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A", Content: "Root"})
+	require.NoError(t, err)
+	reply, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &root.ID, Author: "B", Content: "Reply"})
+	require.NoError(t, err)
+	require.NoError(t, s.SaveIdempotencyKey(ctx, "comment:retry", reply.ID, time.Now().Add(time.Hour)))
+
+	// The first instance is never closed, as after a crash: no snapshot exists.
+	_, err = os.Stat(filepath.Join(dir, "snapshot.json"))
+	require.True(t, os.IsNotExist(err))
+
+	recovered, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	gotPost, err := recovered.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Updated", gotPost.Title)
+
+	replies, err := recovered.GetCommentReplies(ctx, root.ID)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	require.Equal(t, reply.ID, replies[0].ID)
+
+	count, err := recovered.CountCommentsByPost(ctx, post.ID, models.CommentFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	id, err := recovered.GetIdempotencyKey(ctx, "comment:retry")
+	require.NoError(t, err)
+	require.Equal(t, reply.ID, id)
+
+	hits, err := recovered.Search(ctx, models.SearchQuery{Query: "updated", Type: models.SearchTypePosts, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	require.Equal(t, post.ID, hits[0].Post.ID)
+}
+
+func TestPersistentStorage_RecoverDeletes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+
+	spam, err := s.CreatePost(ctx, models.Post{Title: "Spam", Content: "Spam", Author: "spammer"})
+	require.NoError(t, err)
+	_, err = s.CreateComment(ctx, models.Comment{PostID: spam.ID, Author: "A", Content: "Reply to spam"})
+	require.NoError(t, err)
+	post, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "A"})
+	require.NoError(t, err)
+	root, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A", Content: "Root"})
+	require.NoError(t, err)
+	reply, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &root.ID, Author: "B", Content: "Reply"})
+	require.NoError(t, err)
+	kept, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "B", Content: "Kept"})
+	require.NoError(t, err)
+
+	_, err = s.PurgeAuthor(ctx, "spammer")
+	require.NoError(t, err)
+	_, err = s.DeleteComment(ctx, root.ID)
+	require.NoError(t, err)
+	require.NoError(t, s.HideComment(ctx, kept.ID, true))
+
+	recovered, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	_, err = recovered.GetPost(ctx, spam.ID)
+	require.Error(t, err)
+	_, err = recovered.GetComment(ctx, reply.ID)
+	require.Error(t, err)
+
+	gotPost, err := recovered.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, gotPost.CommentCount)
+
+	gotKept, err := recovered.GetComment(ctx, kept.ID)
+	require.NoError(t, err)
+	require.True(t, gotKept.Hidden)
+}
+
+func TestPersistentStorage_RecoverFromSnapshotAndLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+
+	first, err := s.CreatePost(ctx, models.Post{Title: "First", Content: "Content", Author: "Author"})
+	require.NoError(t, err)
+	require.NoError(t, s.Snapshot())
+
+	second, err := s.CreatePost(ctx, models.Post{Title: "Second", Content: "Content", Author: "Author"})
+	require.NoError(t, err)
+
+	recovered, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+
+	posts, err := recovered.GetPosts(ctx, models.PostFilter{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	require.Equal(t, second.ID, posts[0].ID)
+	require.Equal(t, first.ID, posts[1].ID)
+
+	// A clean shutdown folds the log into the snapshot.
+	require.NoError(t, recovered.Close())
+	info, err := os.Stat(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+
+	reopened, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	posts, err = reopened.GetPosts(ctx, models.PostFilter{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+}
+
+func TestPersistentStorage_TornLogTail(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+
+	post, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author"})
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"op":"create_po`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	recovered, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer recovered.Close()
+
+	_, err = recovered.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+
+	_, err = recovered.CreatePost(ctx, models.Post{Title: "After", Content: "Content", Author: "Author"})
+	require.NoError(t, err)
+}
+
+func TestPersistentStorage_TornTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	// cuts shortens the log inside the last transaction, whose records are
+	// the comment and its idempotency key.
+	cuts := map[string]func(log []byte) int{
+		"Torn last record":    func(log []byte) int { return len(log) - 10 },
+		"Missing last record": func(log []byte) int { return bytes.LastIndexByte(log[:len(log)-1], '\n') + 1 },
+	}
+
+	for name, cut := range cuts {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+			require.NoError(t, err)
+
+			post, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author", CommentsEnabled: true})
+			require.NoError(t, err)
+
+			var comment models.Comment
+			err = s.WithTx(ctx, func(tx storage.Storage) error {
+				var err error
+				comment, err = tx.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A", Content: "Lost"})
+				if err != nil {
+					return err
+				}
+				return tx.SaveIdempotencyKey(ctx, "comment:lost", comment.ID, time.Now().Add(time.Hour))
+			})
+			require.NoError(t, err)
+
+			// The storage is left open, as a crash would leave it.
+			path := filepath.Join(dir, "wal.log")
+			log, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.Truncate(path, int64(cut(log))))
+
+			recovered, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+			require.NoError(t, err)
+
+			_, err = recovered.GetComment(ctx, comment.ID)
+			require.ErrorIs(t, err, errors.ErrNotFound)
+			recoveredPost, err := recovered.GetPost(ctx, post.ID)
+			require.NoError(t, err)
+			require.Zero(t, recoveredPost.CommentCount)
+			_, err = recovered.GetIdempotencyKey(ctx, "comment:lost")
+			require.ErrorIs(t, err, errors.ErrNotFound)
+
+			// The remains are gone from the log, so later records replay.
+			after, err := recovered.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "B", Content: "Kept"})
+			require.NoError(t, err)
+			require.NoError(t, recovered.Close())
+
+			reopened, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+			require.NoError(t, err)
+			defer reopened.Close()
+			_, err = reopened.GetComment(ctx, after.ID)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPersistentStorage_BackfillCommentPath(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A log written before comments carried their path and depth.
+	log := `{"seq":1,"op":"create_post","post":{"id":"p","title":"T","content":"C","author":"A","commentsEnabled":true,"version":1}}
+{"seq":2,"op":"create_comment","comment":{"id":"r","postId":"p","author":"A","content":"Root"}}
+{"seq":3,"op":"create_comment","comment":{"id":"c","postId":"p","parentId":"r","author":"A","content":"Child"}}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wal.log"), []byte(log), 0o644))
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer s.Close()
+
+	child, err := s.GetComment(ctx, "c")
+	require.NoError(t, err)
+	require.Equal(t, "r.c", child.Path)
+	require.Equal(t, 1, child.Depth)
+
+	subtree, err := s.GetCommentSubtree(ctx, "r", 0)
+	require.NoError(t, err)
+	require.Len(t, subtree, 1)
+	require.Equal(t, "c", subtree[0].ID)
+}
+
+func TestPersistentStorage_RecoverSites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A log written before posts belonged to sites, then a post of a site.
+	log := `{"seq":1,"op":"create_post","post":{"id":"p","title":"T","content":"C","author":"A","commentsEnabled":true,"version":1}}
+{"seq":2,"op":"create_comment","comment":{"id":"r","postId":"p","author":"A","content":"Root","path":"r"}}
+{"seq":3,"op":"create_post","post":{"id":"b","siteId":"blog","title":"T","content":"C","author":"A","commentsEnabled":true,"version":1}}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wal.log"), []byte(log), 0o644))
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer s.Close()
+
+	defaultSite := tenant.WithSite(ctx, tenant.DefaultSite)
+	posts, err := s.GetPosts(defaultSite, models.PostFilter{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	require.Equal(t, "p", posts[0].ID)
+	comment, err := s.GetComment(defaultSite, "r")
+	require.NoError(t, err)
+	require.Equal(t, tenant.DefaultSite, comment.SiteID)
+
+	posts, err = s.GetPosts(tenant.WithSite(ctx, "blog"), models.PostFilter{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	require.Equal(t, "b", posts[0].ID)
+}
+
+func TestPersistentStorage_RecountOnRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A snapshot taken before posts carried comment counters.
+	snap := `{"seq":3,
+"posts":{"p":{"id":"p","title":"T","content":"C","author":"A","commentsEnabled":true,"version":1}},
+"comments":{"r":{"id":"r","postId":"p","author":"A","content":"Root","path":"r"},
+"c":{"id":"c","postId":"p","parentId":"r","author":"A","content":"Child","path":"r.c","depth":1}},
+"postComments":{"p":["r","c"]},
+"commentTree":{"r":["c"]}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.json"), []byte(snap), 0o644))
+
+	s, err := inmemory.NewInMemoryWithPersistence(persistenceConfig(dir))
+	require.NoError(t, err)
+	defer s.Close()
+
+	post, err := s.GetPost(ctx, "p")
+	require.NoError(t, err)
+	require.Equal(t, 2, post.CommentCount)
+	require.Equal(t, 1, post.RootCommentCount)
+}
+
+func TestPersistentStorage_Compaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := persistenceConfig(dir)
+	cfg.CompactAfter = 3
+
+	s, err := inmemory.NewInMemoryWithPersistence(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author"})
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "snapshot.json"))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPersistentStorage_UnknownFsyncPolicy(t *testing.T) {
+	cfg := persistenceConfig(t.TempDir())
+	cfg.Fsync = "sometimes"
+
+	_, err := inmemory.NewInMemoryWithPersistence(cfg)
+	require.Error(t, err)
+}
@@ -0,0 +1,415 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	markStart    = "<mark>"
+	markEnd      = "</mark>"
+	snippetWords = 24
+
+	// titleWeight makes a term in a post title count as much as this many
+	// occurrences in the body.
+	titleWeight = 2
+)
+
+type field struct {
+	text   string
+	weight int
+}
+
+// docMeta is what a search filters documents by before scoring them, so it
+// needs no shard lock to do so.
+type docMeta struct {
+	site   string
+	postID string // the post itself for a post
+	hidden bool
+}
+
+type indexedDoc struct {
+	terms  []string // distinct terms
+	length int
+	meta   docMeta
+}
+
+// searchIndex is an inverted index from terms to documents of one kind.
+// Terms are lowercased runs of letters and digits; there is no stemming. It
+// is shared by all shards and guards itself.
+type searchIndex struct {
+	kind string // "post" or "comment"
+
+	mu       sync.RWMutex
+	postings map[string]map[string]int // term -> document ID -> weighted frequency
+	docs     map[string]indexedDoc
+}
+
+func newSearchIndex(kind string) *searchIndex {
+	return &searchIndex{
+		kind:     kind,
+		postings: make(map[string]map[string]int),
+		docs:     make(map[string]indexedDoc),
+	}
+}
+
+// set replaces the indexed content of document id. The text is tokenized
+// before the index is locked.
+func (idx *searchIndex) set(id string, meta docMeta, fields ...field) {
+	freq := make(map[string]int)
+	length := 0
+	for _, f := range fields {
+		for _, term := range tokenize(f.text) {
+			freq[term] += f.weight
+			length++
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.unset(id)
+	terms := make([]string, 0, len(freq))
+	for term, n := range freq {
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = make(map[string]int)
+			idx.postings[term] = docs
+		}
+		docs[id] = n
+		terms = append(terms, term)
+	}
+	idx.docs[id] = indexedDoc{terms: terms, length: length, meta: meta}
+}
+
+// tag replaces the metadata of document id, if it is indexed, leaving its
+// content alone.
+func (idx *searchIndex) tag(id string, meta docMeta) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if doc, ok := idx.docs[id]; ok {
+		doc.meta = meta
+		idx.docs[id] = doc
+	}
+}
+
+func (idx *searchIndex) remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.unset(id)
+}
+
+func (idx *searchIndex) unset(id string) {
+	for _, term := range idx.docs[id].terms {
+		docs := idx.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// search returns the k best documents that contain every term and that
+// accept lets through, in no particular order. Documents are scored with
+// TF-IDF, normalized by document length.
+func (idx *searchIndex) search(terms []string, k int, accept func(docMeta) bool) []ranked {
+	if len(terms) == 0 || k <= 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	lists := make([]map[string]int, 0, len(terms))
+	for _, term := range terms {
+		docs, ok := idx.postings[term]
+		if !ok {
+			return nil
+		}
+		lists = append(lists, docs)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	total := float64(len(idx.docs))
+	idf := make([]float64, len(lists))
+	for i, docs := range lists {
+		idf[i] = math.Log(1 + total/float64(len(docs)))
+	}
+
+	best := topK{k: k}
+candidates:
+	for id, tf := range lists[0] {
+		doc := idx.docs[id]
+		if !accept(doc.meta) {
+			continue
+		}
+
+		score := float64(tf) * idf[0]
+		for i, docs := range lists[1:] {
+			tf, ok := docs[id]
+			if !ok {
+				continue candidates
+			}
+			score += float64(tf) * idf[i+1]
+		}
+		best.offer(ranked{
+			kind:   idx.kind,
+			id:     id,
+			postID: doc.meta.postID,
+			score:  score / math.Sqrt(float64(doc.length)),
+		})
+	}
+
+	return best.items
+}
+
+// topK keeps the k best matches offered to it in a heap whose root is the
+// worst of them, the one a better match replaces.
+type topK struct {
+	k     int
+	items []ranked
+}
+
+func (t *topK) offer(m ranked) {
+	if len(t.items) < t.k {
+		t.items = append(t.items, m)
+		t.up(len(t.items) - 1)
+		return
+	}
+	if !m.before(t.items[0]) {
+		return
+	}
+	t.items[0] = m
+	t.down(0)
+}
+
+func (t *topK) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !t.items[parent].before(t.items[i]) {
+			return
+		}
+		t.items[parent], t.items[i] = t.items[i], t.items[parent]
+		i = parent
+	}
+}
+
+func (t *topK) down(i int) {
+	for {
+		worst := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(t.items) && t.items[worst].before(t.items[child]) {
+				worst = child
+			}
+		}
+		if worst == i {
+			return
+		}
+		t.items[worst], t.items[i] = t.items[i], t.items[worst]
+		i = worst
+	}
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// snippet returns about snippetWords words of text around the first match,
+// with every word that contains a query term wrapped in <mark></mark>.
+func snippet(text string, terms []string) string {
+	want := make(map[string]struct{}, len(terms))
+	for _, term := range terms {
+		want[term] = struct{}{}
+	}
+
+	words := strings.Fields(text)
+	matches := func(word string) bool {
+		for _, token := range tokenize(word) {
+			if _, ok := want[token]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	first := 0
+	for i, word := range words {
+		if matches(word) {
+			first = i
+			break
+		}
+	}
+
+	start := max(0, first-snippetWords/4)
+	end := min(len(words), start+snippetWords)
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	for i := start; i < end; i++ {
+		if i > start {
+			b.WriteByte(' ')
+		}
+		if matches(words[i]) {
+			b.WriteString(markStart + words[i] + markEnd)
+		} else {
+			b.WriteString(words[i])
+		}
+	}
+	if end < len(words) {
+		b.WriteString(" …")
+	}
+
+	return b.String()
+}
+
+// Search ranks documents in the search indexes without shard locks and
+// locks the shard of each hit only while copying it out.
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error) {
+	site := tenant.SiteFromContext(ctx)
+	return s.search(site, query, func(m ranked) (models.SearchHit, bool, error) {
+		sh := s.shard(m.postID)
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+
+		hit, ok := s.hit(site, m)
+		return hit, ok, nil
+	})
+}
+
+// ranked is a search match before the entity behind it is looked up.
+type ranked struct {
+	kind   string // "post" or "comment", the order of equal scores
+	id     string
+	postID string
+	score  float64
+}
+
+// before reports whether m ranks above other. Equal scores are ordered the
+// way the SQL backends do.
+func (m ranked) before(other ranked) bool {
+	if m.score != other.score {
+		return m.score > other.score
+	}
+	if m.kind != other.kind {
+		return m.kind < other.kind
+	}
+	return m.id < other.id
+}
+
+// search returns the page of query among the documents visible to site.
+// resolve looks up the entity behind a match under the lock of its shard
+// and reports false if it changed since it was ranked.
+func (s *Storage) search(site string, query models.SearchQuery,
+	resolve func(ranked) (models.SearchHit, bool, error)) ([]models.SearchHit, error) {
+	terms := tokenize(query.Query)
+	accept := func(meta docMeta) bool {
+		return inSite(site, meta.site) && !meta.hidden &&
+			(query.PostID == nil || meta.postID == *query.PostID)
+	}
+
+	k := query.Offset + query.Limit
+	for {
+		matches := s.rank(terms, query.Type, k, accept)
+
+		var hits []models.SearchHit
+		skip, dropped := query.Offset, 0
+		for _, m := range matches {
+			if len(hits) >= query.Limit {
+				break
+			}
+			hit, ok, err := resolve(m)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				dropped++
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			hits = append(hits, hit)
+		}
+
+		// A match that changed after it was ranked leaves a gap in the page;
+		// rank again with room for it, unless there were no more matches.
+		if dropped > 0 && len(matches) == k {
+			k += dropped
+			continue
+		}
+
+		for i := range hits {
+			if hits[i].Post != nil {
+				hits[i].Snippet = snippet(hits[i].Post.Title+" "+hits[i].Post.Content, terms)
+			} else {
+				hits[i].Snippet = snippet(hits[i].Comment.Content, terms)
+			}
+		}
+		return hits, nil
+	}
+}
+
+// rank returns the k best matches of terms of type typ that accept lets
+// through, best first. The best k of either index hold the best k overall.
+func (s *Storage) rank(terms []string, typ models.SearchType, k int, accept func(docMeta) bool) []ranked {
+	var matches []ranked
+	if typ.IncludesPosts() {
+		matches = append(matches, s.postIndex.search(terms, k, accept)...)
+	}
+	if typ.IncludesComments() {
+		matches = append(matches, s.commentIndex.search(terms, k, accept)...)
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].before(matches[j]) })
+	return matches[:min(k, len(matches))]
+}
+
+// hit looks up the entity of m, reporting false if it is gone, hidden or
+// not of site. The caller holds the shard lock of m.postID.
+func (s *Storage) hit(site string, m ranked) (models.SearchHit, bool) {
+	ps := s.sitePost(site, m.postID)
+	if ps == nil {
+		return models.SearchHit{}, false
+	}
+	if m.kind == "post" {
+		post := ps.post
+		return models.SearchHit{Post: &post, Score: m.score}, true
+	}
+
+	c, ok := ps.comments[m.id]
+	if !ok || c.Hidden {
+		return models.SearchHit{}, false
+	}
+	comment := *c
+	return models.SearchHit{Comment: &comment, Score: m.score}, true
+}
+
+func (s *Storage) indexPost(post models.Post) {
+	s.postIndex.set(post.ID, postMeta(post), field{post.Title, titleWeight}, field{post.Content, 1})
+}
+
+func (s *Storage) indexComment(comment models.Comment) {
+	s.commentIndex.set(comment.ID, commentMeta(comment), field{comment.Content, 1})
+}
+
+func postMeta(post models.Post) docMeta {
+	return docMeta{site: post.SiteID, postID: post.ID}
+}
+
+func commentMeta(comment models.Comment) docMeta {
+	return docMeta{site: comment.SiteID, postID: comment.PostID, hidden: comment.Hidden}
+}
@@ -0,0 +1,356 @@
+package inmemory
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/utils"
+	"context"
+	stderrors "errors"
+	"time"
+)
+
+// errRetry fails every call of a transaction attempt that has to start
+// over, see txStorage.lock.
+var errRetry = stderrors.New("storage.inmemory: transaction must be retried")
+
+// WithTx takes the shards fn touches as it first reaches them and holds them
+// until the transaction ends, so the transaction is isolated from other
+// writers of its posts while the remaining posts stay available. Shards are
+// taken in index order; when fn reaches a shard below one it holds and that
+// shard is busy, the attempt is rolled back and fn runs again, holding every
+// shard the attempt needed from the start. fn may therefore run more than
+// once.
+//
+// Changes are applied in place and undone if fn fails; log records are
+// written only on commit.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	var want [shardCount]bool
+	for {
+		tx := &txStorage{s: s, top: -1}
+		for i := range want {
+			if want[i] {
+				tx.lock(i) // in index order, so it waits and cannot fail
+			}
+		}
+
+		err := fn(tx)
+		if tx.retry {
+			tx.rollback()
+			tx.unlock()
+			want = tx.held
+			want[tx.missed] = true
+			continue
+		}
+
+		if err == nil {
+			err = s.logRecord(tx.records...)
+		}
+		if err != nil {
+			tx.rollback()
+		}
+		tx.unlock()
+		return err
+	}
+}
+
+type txStorage struct {
+	s       *Storage
+	records []walRecord
+	undo    []func()
+
+	held   [shardCount]bool
+	top    int // highest held shard, -1 for none
+	retry  bool
+	missed int // the shard that made the attempt retry
+}
+
+var _ storage.Storage = (*txStorage)(nil)
+
+// log stands in for the write-ahead log inside a transaction. It is called
+// right before a change is applied, so it can capture what to restore.
+func (tx *txStorage) log(recs ...walRecord) error {
+	for _, rec := range recs {
+		tx.track(rec)
+	}
+	tx.records = append(tx.records, recs...)
+	return nil
+}
+
+// track works the same for deletes: a record names the entity as it was, so
+// restoring what existed before undoes any of them.
+func (tx *txStorage) track(rec walRecord) {
+	s := tx.s
+
+	switch {
+	case rec.Post != nil:
+		id := rec.Post.ID
+		ps := s.postState(id)
+		if ps == nil {
+			tx.undo = append(tx.undo, func() { s.removePost(id) })
+			return
+		}
+		prev := ps.post
+		tx.undo = append(tx.undo, func() { s.applyPost(prev) })
+	case rec.Comment != nil:
+		postID, id := rec.Comment.PostID, rec.Comment.ID
+		_, c, err := s.comment(postID, id)
+		if err != nil {
+			tx.undo = append(tx.undo, func() { s.removeComment(postID, id) })
+			return
+		}
+		prev := *c
+		tx.undo = append(tx.undo, func() { s.applyComment(prev) })
+	case rec.Key != nil:
+		prev, existed := s.keys[rec.Key.Key]
+		key := rec.Key.Key
+		tx.undo = append(tx.undo, func() {
+			s.keysMu.Lock()
+			defer s.keysMu.Unlock()
+			if existed {
+				s.keys[key] = prev
+			} else {
+				delete(s.keys, key)
+			}
+		})
+	}
+}
+
+// lock takes shard i for the rest of the transaction. A shard above every
+// held one is waited for. One below is only tried: waiting for it could
+// deadlock with a transaction that holds it and waits for one of ours.
+func (tx *txStorage) lock(i int) error {
+	switch {
+	case tx.retry:
+		return errRetry
+	case tx.held[i]:
+		return nil
+	case i > tx.top:
+		tx.s.shards[i].mu.Lock()
+		tx.top = i
+	case !tx.s.shards[i].mu.TryLock():
+		tx.retry, tx.missed = true, i
+		return errRetry
+	}
+	tx.held[i] = true
+	return nil
+}
+
+func (tx *txStorage) lockPost(id string) error {
+	return tx.lock(shardIndex(id))
+}
+
+// lockComment takes the shard of the post comment id is located in and
+// returns that post, see locate.
+func (tx *txStorage) lockComment(ctx context.Context, id string) (string, error) {
+	postID := tx.s.locate(tenant.SiteFromContext(ctx), id)
+	return postID, tx.lockPost(postID)
+}
+
+func (tx *txStorage) lockAll() error {
+	for i := range tx.s.shards {
+		if err := tx.lock(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *txStorage) unlock() {
+	for i, held := range tx.held {
+		if held {
+			tx.s.shards[i].mu.Unlock()
+		}
+	}
+}
+
+func (tx *txStorage) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+}
+
+func (tx *txStorage) CreatePost(ctx context.Context, post models.Post) (models.Post, error) {
+	if post.ID == "" {
+		post.ID = utils.GenerateID()
+	}
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+	if err := tx.lockPost(post.ID); err != nil {
+		return models.Post{}, err
+	}
+	return tx.s.createPost(post, tx.log)
+}
+
+func (tx *txStorage) GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error) {
+	if err := tx.lockAll(); err != nil {
+		return nil, err
+	}
+	return tx.s.getPosts(tenant.SiteFromContext(ctx), filter, limit, offset), nil
+}
+
+func (tx *txStorage) GetPost(ctx context.Context, id string) (models.Post, error) {
+	if err := tx.lockPost(id); err != nil {
+		return models.Post{}, err
+	}
+	return tx.s.getPost(tenant.SiteFromContext(ctx), id)
+}
+
+func (tx *txStorage) UpdatePost(ctx context.Context, post models.Post) error {
+	if err := tx.lockPost(post.ID); err != nil {
+		return err
+	}
+	return tx.s.updatePost(tenant.SiteFromContext(ctx), post, tx.log)
+}
+
+func (tx *txStorage) RecountComments(ctx context.Context) (int, error) {
+	if err := tx.lockAll(); err != nil {
+		return 0, err
+	}
+	return tx.s.recountComments(tenant.SiteFromContext(ctx), tx.log)
+}
+
+func (tx *txStorage) CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error) {
+	if err := tx.lockPost(comment.PostID); err != nil {
+		return models.Comment{}, err
+	}
+	return tx.s.createComment(tenant.SiteFromContext(ctx), comment, tx.log)
+}
+
+func (tx *txStorage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, error) {
+	if err := tx.lockPost(postID); err != nil {
+		return nil, err
+	}
+	return tx.s.getCommentsByPost(tenant.SiteFromContext(ctx), postID, filter, limit, offset), nil
+}
+
+func (tx *txStorage) GetComment(ctx context.Context, id string) (models.Comment, error) {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return models.Comment{}, err
+	}
+	return tx.s.getComment(postID, id)
+}
+
+func (tx *txStorage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
+	if err := tx.lockPost(postID); err != nil {
+		return 0, err
+	}
+	return tx.s.countCommentsByPost(tenant.SiteFromContext(ctx), postID, filter), nil
+}
+
+func (tx *txStorage) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
+	postID, err := tx.lockComment(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return tx.s.getCommentReplies(postID, parentID), nil
+}
+
+func (tx *txStorage) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return tx.s.getCommentAncestors(postID, id)
+}
+
+func (tx *txStorage) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return tx.s.getCommentSubtree(postID, id, maxDepth)
+}
+
+func (tx *txStorage) LockThread(ctx context.Context, id string) error {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return err
+	}
+	return tx.s.lockThread(postID, id, tx.log)
+}
+
+func (tx *txStorage) IsThreadLocked(ctx context.Context, id string) (bool, error) {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return tx.s.isThreadLocked(postID, id)
+}
+
+func (tx *txStorage) HideComment(ctx context.Context, id string, hidden bool) error {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return err
+	}
+	return tx.s.hideComment(postID, id, hidden, tx.log)
+}
+
+func (tx *txStorage) DeleteComment(ctx context.Context, id string) (int, error) {
+	postID, err := tx.lockComment(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return tx.s.deleteComment(postID, id, tx.log)
+}
+
+func (tx *txStorage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	if err := tx.lockAll(); err != nil {
+		return models.PurgeResult{}, err
+	}
+	return tx.s.purgeAuthor(tenant.SiteFromContext(ctx), author, tx.log)
+}
+
+func (tx *txStorage) ImportPost(ctx context.Context, post models.Post) error {
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+	if err := tx.lockPost(post.ID); err != nil {
+		return err
+	}
+	return tx.s.importPost(post, tx.log)
+}
+
+func (tx *txStorage) ImportComment(ctx context.Context, comment models.Comment) error {
+	if err := tx.lockPost(comment.PostID); err != nil {
+		return err
+	}
+	return tx.s.importComment(tenant.SiteFromContext(ctx), comment, tx.log)
+}
+
+func (tx *txStorage) Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error) {
+	site := tenant.SiteFromContext(ctx)
+	return tx.s.search(site, query, func(m ranked) (models.SearchHit, bool, error) {
+		if err := tx.lockPost(m.postID); err != nil {
+			return models.SearchHit{}, false, err
+		}
+		hit, ok := tx.s.hit(site, m)
+		return hit, ok, nil
+	})
+}
+
+func (tx *txStorage) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	if err := tx.lock(shardIndex(key)); err != nil {
+		return "", err
+	}
+	tx.s.keysMu.Lock()
+	defer tx.s.keysMu.Unlock()
+
+	return tx.s.getIdempotencyKey(key)
+}
+
+func (tx *txStorage) SaveIdempotencyKey(ctx context.Context, key, entityID string, expiresAt time.Time) error {
+	if err := tx.lock(shardIndex(key)); err != nil {
+		return err
+	}
+	tx.s.keysMu.Lock()
+	defer tx.s.keysMu.Unlock()
+
+	return tx.s.saveIdempotencyKey(key, entityID, expiresAt, tx.log)
+}
+
+func (tx *txStorage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return fn(tx)
+}
+
+func (tx *txStorage) Close() error {
+	return nil
+}
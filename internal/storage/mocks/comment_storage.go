@@ -14,9 +14,9 @@ type CommentStorage struct {
 	mock.Mock
 }
 
-// CountCommentsByPost provides a mock function with given fields: ctx, postID
-func (_m *CommentStorage) CountCommentsByPost(ctx context.Context, postID string) (int, error) {
-	ret := _m.Called(ctx, postID)
+// CountCommentsByPost provides a mock function with given fields: ctx, postID, filter
+func (_m *CommentStorage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
+	ret := _m.Called(ctx, postID, filter)
 
 	if len(ret) == 0 {
 		panic("no return value specified for CountCommentsByPost")
@@ -24,17 +24,17 @@ func (_m *CommentStorage) CountCommentsByPost(ctx context.Context, postID string
 
 	var r0 int
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (int, error)); ok {
-		return rf(ctx, postID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter) (int, error)); ok {
+		return rf(ctx, postID, filter)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
-		r0 = rf(ctx, postID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter) int); ok {
+		r0 = rf(ctx, postID, filter)
 	} else {
 		r0 = ret.Get(0).(int)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, postID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.CommentFilter) error); ok {
+		r1 = rf(ctx, postID, filter)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -98,6 +98,36 @@ func (_m *CommentStorage) GetComment(ctx context.Context, id string) (models.Com
 	return r0, r1
 }
 
+// GetCommentAncestors provides a mock function with given fields: ctx, id
+func (_m *CommentStorage) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCommentAncestors")
+	}
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]string, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetCommentReplies provides a mock function with given fields: ctx, parentID
 func (_m *CommentStorage) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
 	ret := _m.Called(ctx, parentID)
@@ -128,9 +158,39 @@ func (_m *CommentStorage) GetCommentReplies(ctx context.Context, parentID string
 	return r0, r1
 }
 
-// GetCommentsByPost provides a mock function with given fields: ctx, postID, limit, offset
-func (_m *CommentStorage) GetCommentsByPost(ctx context.Context, postID string, limit int, offset int) ([]models.Comment, error) {
-	ret := _m.Called(ctx, postID, limit, offset)
+// GetCommentSubtree provides a mock function with given fields: ctx, id, maxDepth
+func (_m *CommentStorage) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	ret := _m.Called(ctx, id, maxDepth)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCommentSubtree")
+	}
+
+	var r0 []models.Comment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]models.Comment, error)); ok {
+		return rf(ctx, id, maxDepth)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []models.Comment); ok {
+		r0 = rf(ctx, id, maxDepth)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Comment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, id, maxDepth)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCommentsByPost provides a mock function with given fields: ctx, postID, filter, limit, offset
+func (_m *CommentStorage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit int, offset int) ([]models.Comment, error) {
+	ret := _m.Called(ctx, postID, filter, limit, offset)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetCommentsByPost")
@@ -138,19 +198,47 @@ func (_m *CommentStorage) GetCommentsByPost(ctx context.Context, postID string,
 
 	var r0 []models.Comment
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) ([]models.Comment, error)); ok {
-		return rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter, int, int) ([]models.Comment, error)); ok {
+		return rf(ctx, postID, filter, limit, offset)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) []models.Comment); ok {
-		r0 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter, int, int) []models.Comment); ok {
+		r0 = rf(ctx, postID, filter, limit, offset)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Comment)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, int, int) error); ok {
-		r1 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.CommentFilter, int, int) error); ok {
+		r1 = rf(ctx, postID, filter, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IsThreadLocked provides a mock function with given fields: ctx, id
+func (_m *CommentStorage) IsThreadLocked(ctx context.Context, id string) (bool, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IsThreadLocked")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (bool, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -158,6 +246,24 @@ func (_m *CommentStorage) GetCommentsByPost(ctx context.Context, postID string,
 	return r0, r1
 }
 
+// LockThread provides a mock function with given fields: ctx, id
+func (_m *CommentStorage) LockThread(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LockThread")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewCommentStorage creates a new instance of CommentStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewCommentStorage(t interface {
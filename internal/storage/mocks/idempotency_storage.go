@@ -0,0 +1,76 @@
+// Code generated by mockery v2.53.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
+
+// IdempotencyStorage is an autogenerated mock type for the IdempotencyStorage type
+type IdempotencyStorage struct {
+	mock.Mock
+}
+
+// GetIdempotencyKey provides a mock function with given fields: ctx, key
+func (_m *IdempotencyStorage) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	ret := _m.Called(ctx, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetIdempotencyKey")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return rf(ctx, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveIdempotencyKey provides a mock function with given fields: ctx, key, entityID, expiresAt
+func (_m *IdempotencyStorage) SaveIdempotencyKey(ctx context.Context, key string, entityID string, expiresAt time.Time) error {
+	ret := _m.Called(ctx, key, entityID, expiresAt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveIdempotencyKey")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, key, entityID, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewIdempotencyStorage creates a new instance of IdempotencyStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewIdempotencyStorage(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *IdempotencyStorage {
+	mock := &IdempotencyStorage{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
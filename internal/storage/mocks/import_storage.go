@@ -0,0 +1,65 @@
+// Code generated by mockery v2.53.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	models "comments-system/internal/models"
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ImportStorage is an autogenerated mock type for the ImportStorage type
+type ImportStorage struct {
+	mock.Mock
+}
+
+// ImportComment provides a mock function with given fields: ctx, comment
+func (_m *ImportStorage) ImportComment(ctx context.Context, comment models.Comment) error {
+	ret := _m.Called(ctx, comment)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImportComment")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Comment) error); ok {
+		r0 = rf(ctx, comment)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ImportPost provides a mock function with given fields: ctx, post
+func (_m *ImportStorage) ImportPost(ctx context.Context, post models.Post) error {
+	ret := _m.Called(ctx, post)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImportPost")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Post) error); ok {
+		r0 = rf(ctx, post)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewImportStorage creates a new instance of ImportStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewImportStorage(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ImportStorage {
+	mock := &ImportStorage{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,103 @@
+// Code generated by mockery v2.53.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	models "comments-system/internal/models"
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ModerationStorage is an autogenerated mock type for the ModerationStorage type
+type ModerationStorage struct {
+	mock.Mock
+}
+
+// DeleteComment provides a mock function with given fields: ctx, id
+func (_m *ModerationStorage) DeleteComment(ctx context.Context, id string) (int, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteComment")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HideComment provides a mock function with given fields: ctx, id, hidden
+func (_m *ModerationStorage) HideComment(ctx context.Context, id string, hidden bool) error {
+	ret := _m.Called(ctx, id, hidden)
+
+	if len(ret) == 0 {
+		panic("no return value specified for HideComment")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) error); ok {
+		r0 = rf(ctx, id, hidden)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeAuthor provides a mock function with given fields: ctx, author
+func (_m *ModerationStorage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	ret := _m.Called(ctx, author)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PurgeAuthor")
+	}
+
+	var r0 models.PurgeResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.PurgeResult, error)); ok {
+		return rf(ctx, author)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.PurgeResult); ok {
+		r0 = rf(ctx, author)
+	} else {
+		r0 = ret.Get(0).(models.PurgeResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, author)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewModerationStorage creates a new instance of ModerationStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewModerationStorage(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ModerationStorage {
+	mock := &ModerationStorage{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -70,9 +70,9 @@ func (_m *PostStorage) GetPost(ctx context.Context, id string) (models.Post, err
 	return r0, r1
 }
 
-// GetPosts provides a mock function with given fields: ctx, limit, offset
-func (_m *PostStorage) GetPosts(ctx context.Context, limit int, offset int) ([]models.Post, error) {
-	ret := _m.Called(ctx, limit, offset)
+// GetPosts provides a mock function with given fields: ctx, filter, limit, offset
+func (_m *PostStorage) GetPosts(ctx context.Context, filter models.PostFilter, limit int, offset int) ([]models.Post, error) {
+	ret := _m.Called(ctx, filter, limit, offset)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetPosts")
@@ -80,19 +80,47 @@ func (_m *PostStorage) GetPosts(ctx context.Context, limit int, offset int) ([]m
 
 	var r0 []models.Post
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, int, int) ([]models.Post, error)); ok {
-		return rf(ctx, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, models.PostFilter, int, int) ([]models.Post, error)); ok {
+		return rf(ctx, filter, limit, offset)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, int, int) []models.Post); ok {
-		r0 = rf(ctx, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, models.PostFilter, int, int) []models.Post); ok {
+		r0 = rf(ctx, filter, limit, offset)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Post)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
-		r1 = rf(ctx, limit, offset)
+	if rf, ok := ret.Get(1).(func(context.Context, models.PostFilter, int, int) error); ok {
+		r1 = rf(ctx, filter, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecountComments provides a mock function with given fields: ctx
+func (_m *PostStorage) RecountComments(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecountComments")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (int, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,59 @@
+// Code generated by mockery v2.53.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	models "comments-system/internal/models"
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// SearchStorage is an autogenerated mock type for the SearchStorage type
+type SearchStorage struct {
+	mock.Mock
+}
+
+// Search provides a mock function with given fields: ctx, query
+func (_m *SearchStorage) Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error) {
+	ret := _m.Called(ctx, query)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Search")
+	}
+
+	var r0 []models.SearchHit
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.SearchQuery) ([]models.SearchHit, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.SearchQuery) []models.SearchHit); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.SearchHit)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.SearchQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewSearchStorage creates a new instance of SearchStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSearchStorage(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *SearchStorage {
+	mock := &SearchStorage{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -7,6 +7,10 @@ import (
 	context "context"
 
 	mock "github.com/stretchr/testify/mock"
+
+	storage "comments-system/internal/storage"
+
+	time "time"
 )
 
 // Storage is an autogenerated mock type for the Storage type
@@ -32,9 +36,9 @@ func (_m *Storage) Close() error {
 	return r0
 }
 
-// CountCommentsByPost provides a mock function with given fields: ctx, postID
-func (_m *Storage) CountCommentsByPost(ctx context.Context, postID string) (int, error) {
-	ret := _m.Called(ctx, postID)
+// CountCommentsByPost provides a mock function with given fields: ctx, postID, filter
+func (_m *Storage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
+	ret := _m.Called(ctx, postID, filter)
 
 	if len(ret) == 0 {
 		panic("no return value specified for CountCommentsByPost")
@@ -42,17 +46,17 @@ func (_m *Storage) CountCommentsByPost(ctx context.Context, postID string) (int,
 
 	var r0 int
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (int, error)); ok {
-		return rf(ctx, postID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter) (int, error)); ok {
+		return rf(ctx, postID, filter)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
-		r0 = rf(ctx, postID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter) int); ok {
+		r0 = rf(ctx, postID, filter)
 	} else {
 		r0 = ret.Get(0).(int)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, postID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.CommentFilter) error); ok {
+		r1 = rf(ctx, postID, filter)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -116,6 +120,34 @@ func (_m *Storage) CreatePost(ctx context.Context, post models.Post) (models.Pos
 	return r0, r1
 }
 
+// DeleteComment provides a mock function with given fields: ctx, id
+func (_m *Storage) DeleteComment(ctx context.Context, id string) (int, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteComment")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetComment provides a mock function with given fields: ctx, id
 func (_m *Storage) GetComment(ctx context.Context, id string) (models.Comment, error) {
 	ret := _m.Called(ctx, id)
@@ -144,6 +176,36 @@ func (_m *Storage) GetComment(ctx context.Context, id string) (models.Comment, e
 	return r0, r1
 }
 
+// GetCommentAncestors provides a mock function with given fields: ctx, id
+func (_m *Storage) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCommentAncestors")
+	}
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]string, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetCommentReplies provides a mock function with given fields: ctx, parentID
 func (_m *Storage) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
 	ret := _m.Called(ctx, parentID)
@@ -174,9 +236,39 @@ func (_m *Storage) GetCommentReplies(ctx context.Context, parentID string) ([]mo
 	return r0, r1
 }
 
-// GetCommentsByPost provides a mock function with given fields: ctx, postID, limit, offset
-func (_m *Storage) GetCommentsByPost(ctx context.Context, postID string, limit int, offset int) ([]models.Comment, error) {
-	ret := _m.Called(ctx, postID, limit, offset)
+// GetCommentSubtree provides a mock function with given fields: ctx, id, maxDepth
+func (_m *Storage) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	ret := _m.Called(ctx, id, maxDepth)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCommentSubtree")
+	}
+
+	var r0 []models.Comment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]models.Comment, error)); ok {
+		return rf(ctx, id, maxDepth)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []models.Comment); ok {
+		r0 = rf(ctx, id, maxDepth)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Comment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, id, maxDepth)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCommentsByPost provides a mock function with given fields: ctx, postID, filter, limit, offset
+func (_m *Storage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit int, offset int) ([]models.Comment, error) {
+	ret := _m.Called(ctx, postID, filter, limit, offset)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetCommentsByPost")
@@ -184,19 +276,47 @@ func (_m *Storage) GetCommentsByPost(ctx context.Context, postID string, limit i
 
 	var r0 []models.Comment
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) ([]models.Comment, error)); ok {
-		return rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter, int, int) ([]models.Comment, error)); ok {
+		return rf(ctx, postID, filter, limit, offset)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, int, int) []models.Comment); ok {
-		r0 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, string, models.CommentFilter, int, int) []models.Comment); ok {
+		r0 = rf(ctx, postID, filter, limit, offset)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Comment)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, int, int) error); ok {
-		r1 = rf(ctx, postID, limit, offset)
+	if rf, ok := ret.Get(1).(func(context.Context, string, models.CommentFilter, int, int) error); ok {
+		r1 = rf(ctx, postID, filter, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetIdempotencyKey provides a mock function with given fields: ctx, key
+func (_m *Storage) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	ret := _m.Called(ctx, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetIdempotencyKey")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return rf(ctx, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -232,9 +352,9 @@ func (_m *Storage) GetPost(ctx context.Context, id string) (models.Post, error)
 	return r0, r1
 }
 
-// GetPosts provides a mock function with given fields: ctx, limit, offset
-func (_m *Storage) GetPosts(ctx context.Context, limit int, offset int) ([]models.Post, error) {
-	ret := _m.Called(ctx, limit, offset)
+// GetPosts provides a mock function with given fields: ctx, filter, limit, offset
+func (_m *Storage) GetPosts(ctx context.Context, filter models.PostFilter, limit int, offset int) ([]models.Post, error) {
+	ret := _m.Called(ctx, filter, limit, offset)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetPosts")
@@ -242,19 +362,223 @@ func (_m *Storage) GetPosts(ctx context.Context, limit int, offset int) ([]model
 
 	var r0 []models.Post
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, int, int) ([]models.Post, error)); ok {
-		return rf(ctx, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, models.PostFilter, int, int) ([]models.Post, error)); ok {
+		return rf(ctx, filter, limit, offset)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, int, int) []models.Post); ok {
-		r0 = rf(ctx, limit, offset)
+	if rf, ok := ret.Get(0).(func(context.Context, models.PostFilter, int, int) []models.Post); ok {
+		r0 = rf(ctx, filter, limit, offset)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Post)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
-		r1 = rf(ctx, limit, offset)
+	if rf, ok := ret.Get(1).(func(context.Context, models.PostFilter, int, int) error); ok {
+		r1 = rf(ctx, filter, limit, offset)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HideComment provides a mock function with given fields: ctx, id, hidden
+func (_m *Storage) HideComment(ctx context.Context, id string, hidden bool) error {
+	ret := _m.Called(ctx, id, hidden)
+
+	if len(ret) == 0 {
+		panic("no return value specified for HideComment")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) error); ok {
+		r0 = rf(ctx, id, hidden)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ImportComment provides a mock function with given fields: ctx, comment
+func (_m *Storage) ImportComment(ctx context.Context, comment models.Comment) error {
+	ret := _m.Called(ctx, comment)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImportComment")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Comment) error); ok {
+		r0 = rf(ctx, comment)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ImportPost provides a mock function with given fields: ctx, post
+func (_m *Storage) ImportPost(ctx context.Context, post models.Post) error {
+	ret := _m.Called(ctx, post)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImportPost")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Post) error); ok {
+		r0 = rf(ctx, post)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IsThreadLocked provides a mock function with given fields: ctx, id
+func (_m *Storage) IsThreadLocked(ctx context.Context, id string) (bool, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IsThreadLocked")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (bool, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LockThread provides a mock function with given fields: ctx, id
+func (_m *Storage) LockThread(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LockThread")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeAuthor provides a mock function with given fields: ctx, author
+func (_m *Storage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	ret := _m.Called(ctx, author)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PurgeAuthor")
+	}
+
+	var r0 models.PurgeResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.PurgeResult, error)); ok {
+		return rf(ctx, author)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.PurgeResult); ok {
+		r0 = rf(ctx, author)
+	} else {
+		r0 = ret.Get(0).(models.PurgeResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, author)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecountComments provides a mock function with given fields: ctx
+func (_m *Storage) RecountComments(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecountComments")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (int, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveIdempotencyKey provides a mock function with given fields: ctx, key, entityID, expiresAt
+func (_m *Storage) SaveIdempotencyKey(ctx context.Context, key string, entityID string, expiresAt time.Time) error {
+	ret := _m.Called(ctx, key, entityID, expiresAt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveIdempotencyKey")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, key, entityID, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Search provides a mock function with given fields: ctx, query
+func (_m *Storage) Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error) {
+	ret := _m.Called(ctx, query)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Search")
+	}
+
+	var r0 []models.SearchHit
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.SearchQuery) ([]models.SearchHit, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, models.SearchQuery) []models.SearchHit); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.SearchHit)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, models.SearchQuery) error); ok {
+		r1 = rf(ctx, query)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -280,6 +604,24 @@ func (_m *Storage) UpdatePost(ctx context.Context, post models.Post) error {
 	return r0
 }
 
+// WithTx provides a mock function with given fields: ctx, fn
+func (_m *Storage) WithTx(ctx context.Context, fn func(storage.Storage) error) error {
+	ret := _m.Called(ctx, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for WithTx")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(storage.Storage) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewStorage creates a new instance of Storage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewStorage(t interface {
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"comments-system/internal/models"
+	"comments-system/pkg/errors"
+	"strings"
+)
+
+// PathSeparator joins comment IDs in models.Comment.Path. It sorts before
+// every character of generated IDs, so ordering comments by path lists a
+// thread depth-first with siblings in creation order. IDs must not contain it.
+const PathSeparator = "."
+
+// ValidateCommentID refuses an ID that cannot be an element of a path:
+// an empty one or one containing PathSeparator.
+func ValidateCommentID(id string) error {
+	if id == "" || strings.Contains(id, PathSeparator) {
+		return errors.ErrInvalidID
+	}
+	return nil
+}
+
+// CommentPath returns the path and depth of comment id placed under parent;
+// parent is nil for a root comment.
+func CommentPath(parent *models.Comment, id string) (string, int) {
+	if parent == nil {
+		return id, 0
+	}
+	return parent.Path + PathSeparator + id, parent.Depth + 1
+}
+
+// PathAncestors returns the IDs on path above its last element, root first.
+func PathAncestors(path string) []string {
+	ids := strings.Split(path, PathSeparator)
+	return ids[:len(ids)-1]
+}
+
+// SubtreeRange returns bounds such that lo < p < hi holds exactly for the
+// paths p of descendants of the comment at path. Both backends compare paths
+// bytewise, so the range is served by the path index.
+func SubtreeRange(path string) (lo, hi string) {
+	return path + PathSeparator, path + string(PathSeparator[0]+1)
+}
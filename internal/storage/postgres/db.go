@@ -0,0 +1,298 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// queryer is implemented by *conn as well as by *sqlx.DB and *sqlx.Tx, so
+// the same methods serve plain calls and calls inside WithTx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+// poolOptions tune a connection pool; zero or negative values keep the
+// database/sql defaults and the statement timeout of the server.
+type poolOptions struct {
+	maxOpenConns     int
+	maxIdleConns     int
+	connMaxLifetime  time.Duration
+	statementTimeout time.Duration
+}
+
+// preparedQueries are the hot queries each pool prepares once and reuses.
+var preparedQueries = map[string]bool{}
+
+// prepared registers query as hot and returns it unchanged.
+func prepared(query string) string {
+	preparedQueries[query] = true
+	return query
+}
+
+// prepareBackoff is how long a hot query that failed to prepare runs
+// unprepared before the next attempt.
+const prepareBackoff = 5 * time.Second
+
+// conn is the queryer of a pool or of a transaction on it. It runs hot
+// queries as prepared statements of the pool.
+type conn struct {
+	db    *sqlx.DB
+	q     queryer // db, or tx inside a transaction
+	tx    *sqlx.Tx
+	stmts *stmtCache
+}
+
+type stmtCache struct {
+	mu    sync.RWMutex
+	stmts map[string]*sqlx.Stmt
+	retry map[string]time.Time // when a query that failed to prepare is tried again
+}
+
+var _ queryer = (*conn)(nil)
+
+func openConn(dsn string, opts poolOptions) (*conn, error) {
+	if opts.statementTimeout > 0 {
+		var err error
+		if dsn, err = withStatementTimeout(dsn, opts.statementTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.maxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.maxOpenConns)
+	}
+	if opts.maxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.maxIdleConns)
+	}
+	if opts.connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.connMaxLifetime)
+	}
+
+	return &conn{
+		db: db,
+		q:  db,
+		stmts: &stmtCache{
+			stmts: make(map[string]*sqlx.Stmt),
+			retry: make(map[string]time.Time),
+		},
+	}, nil
+}
+
+// withStatementTimeout sets the statement_timeout of the sessions opened
+// with dsn, given as a URL or as key=value pairs, so the server cancels
+// queries running longer than timeout.
+func withStatementTimeout(dsn string, timeout time.Duration) (string, error) {
+	ms := strconv.FormatInt(max(timeout.Milliseconds(), 1), 10)
+
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " statement_timeout=" + ms, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("statement_timeout", ms)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// prepareAll prepares the hot queries up front. A query that fails, for
+// example because migrations have not run yet, is prepared on first use.
+func (c *conn) prepareAll(ctx context.Context) {
+	for query := range preparedQueries {
+		c.stmt(ctx, query)
+	}
+}
+
+// inTx returns a conn running on tx with the statements of c.
+func (c *conn) inTx(tx *sqlx.Tx) *conn {
+	return &conn{db: c.db, q: tx, tx: tx, stmts: c.stmts}
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := c.run(ctx, query,
+		func(ctx context.Context, stmt *sqlx.Stmt) (err error) {
+			result, err = stmt.ExecContext(ctx, args...)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			result, err = c.q.ExecContext(ctx, query, args...)
+			return err
+		})
+	return result, err
+}
+
+func (c *conn) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return c.run(ctx, query,
+		func(ctx context.Context, stmt *sqlx.Stmt) error {
+			return stmt.GetContext(ctx, dest, args...)
+		},
+		func(ctx context.Context) error {
+			return c.q.GetContext(ctx, dest, query, args...)
+		})
+}
+
+func (c *conn) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return c.run(ctx, query,
+		func(ctx context.Context, stmt *sqlx.Stmt) error {
+			return stmt.SelectContext(ctx, dest, args...)
+		},
+		func(ctx context.Context) error {
+			return c.q.SelectContext(ctx, dest, query, args...)
+		})
+}
+
+// run executes query, as a prepared statement when it is a hot one. A
+// statement whose plan went stale because a migration changed its tables is
+// dropped, and outside a transaction the query is retried unprepared.
+func (c *conn) run(ctx context.Context, query string,
+	prepared func(context.Context, *sqlx.Stmt) error, plain func(context.Context) error) error {
+	stmt := c.stmt(ctx, query)
+	if stmt == nil {
+		return plain(ctx)
+	}
+
+	err := prepared(ctx, stmt)
+	if !isStalePlan(err) {
+		return err
+	}
+
+	c.drop(query)
+	if c.tx != nil {
+		return err
+	}
+	return plain(ctx)
+}
+
+// stmt returns the prepared statement for a hot query, bound to the
+// transaction if there is one, or nil to run query as is.
+func (c *conn) stmt(ctx context.Context, query string) *sqlx.Stmt {
+	if !preparedQueries[query] {
+		return nil
+	}
+
+	c.stmts.mu.RLock()
+	stmt, retry := c.stmts.stmts[query], c.stmts.retry[query]
+	c.stmts.mu.RUnlock()
+
+	if stmt == nil {
+		if time.Now().Before(retry) {
+			return nil
+		}
+		if stmt = c.prepare(ctx, query); stmt == nil {
+			return nil
+		}
+	}
+
+	if c.tx != nil {
+		return c.tx.StmtxContext(ctx, stmt)
+	}
+	return stmt
+}
+
+// prepare prepares query on the pool, not the transaction, so the statement
+// outlives it. Preparing is a round trip, so it runs without the lock; of
+// two callers preparing at once, the second closes its statement and takes
+// the first one's. After a failure the query runs unprepared for
+// prepareBackoff.
+func (c *conn) prepare(ctx context.Context, query string) *sqlx.Stmt {
+	stmt, err := c.db.PreparexContext(ctx, query)
+
+	c.stmts.mu.Lock()
+	defer c.stmts.mu.Unlock()
+
+	if err != nil {
+		// A cancelled request says nothing about the query.
+		if ctx.Err() == nil {
+			c.stmts.retry[query] = time.Now().Add(prepareBackoff)
+		}
+		return nil
+	}
+	delete(c.stmts.retry, query)
+
+	if cached := c.stmts.stmts[query]; cached != nil {
+		stmt.Close()
+		return cached
+	}
+	c.stmts.stmts[query] = stmt
+	return stmt
+}
+
+func (c *conn) drop(query string) {
+	c.stmts.mu.Lock()
+	defer c.stmts.mu.Unlock()
+
+	if stmt, ok := c.stmts.stmts[query]; ok {
+		stmt.Close()
+		delete(c.stmts.stmts, query)
+	}
+}
+
+// isStalePlan reports whether Postgres refused a prepared statement because
+// the result type of its cached plan has changed.
+func isStalePlan(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "0A000"
+}
+
+func (c *conn) close() error {
+	c.stmts.mu.Lock()
+	defer c.stmts.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.stmts.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts.stmts, query)
+	}
+	errs = append(errs, c.db.Close())
+	return errors.Join(errs...)
+}
+
+// PoolStats describes the connection pools of a Storage.
+type PoolStats struct {
+	Primary  sql.DBStats    `json:"primary"`
+	Replicas []ReplicaStats `json:"replicas,omitempty"`
+	// Prepared is the number of hot queries prepared on the primary.
+	Prepared int `json:"prepared"`
+}
+
+type ReplicaStats struct {
+	Healthy bool        `json:"healthy"`
+	Stats   sql.DBStats `json:"stats"`
+}
+
+func (s *Storage) PoolStats() PoolStats {
+	s.q.stmts.mu.RLock()
+	prepared := len(s.q.stmts.stmts)
+	s.q.stmts.mu.RUnlock()
+
+	stats := PoolStats{Primary: s.db.Stats(), Prepared: prepared}
+	if s.replicas != nil {
+		for _, r := range s.replicas.replicas {
+			stats.Replicas = append(stats.Replicas, ReplicaStats{
+				Healthy: r.healthy.Load(),
+				Stats:   r.conn.db.Stats(),
+			})
+		}
+	}
+	return stats
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"comments-system/internal/models"
+	"strings"
+)
+
+// where collects the conditions of a filtered query. Placeholders are
+// written as ? and rebound by the caller.
+type where struct {
+	conds []string
+	args  []any
+}
+
+func (w *where) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// created_at is a TIMESTAMP holding UTC, so bounds are converted to UTC
+// before they are compared with it.
+func postFilterWhere(site string, f models.PostFilter) *where {
+	w := &where{}
+	if site != "" {
+		w.add("site_id = ?", site)
+	}
+	if f.Author != nil {
+		w.add("author = ?", *f.Author)
+	}
+	if f.CreatedAfter != nil {
+		w.add("created_at > ?", f.CreatedAfter.UTC())
+	}
+	if f.CreatedBefore != nil {
+		w.add("created_at < ?", f.CreatedBefore.UTC())
+	}
+	if f.CommentsEnabled != nil {
+		w.add("comments_enabled = ?", *f.CommentsEnabled)
+	}
+	if f.HasComments != nil {
+		exists := "EXISTS (SELECT 1 FROM comments c WHERE c.post_id = posts.id)"
+		if !*f.HasComments {
+			exists = "NOT " + exists
+		}
+		w.add(exists)
+	}
+	return w
+}
+
+func commentFilterWhere(site, postID string, f models.CommentFilter) *where {
+	w := &where{}
+	w.add("post_id = ?", postID)
+	if site != "" {
+		w.add("site_id = ?", site)
+	}
+	if f.HasParent != nil && *f.HasParent {
+		w.add("parent_id IS NOT NULL")
+	} else {
+		w.add("parent_id IS NULL")
+	}
+	if f.Author != nil {
+		w.add("author = ?", *f.Author)
+	}
+	if f.CreatedAfter != nil {
+		w.add("created_at > ?", f.CreatedAfter.UTC())
+	}
+	if f.CreatedBefore != nil {
+		w.add("created_at < ?", f.CreatedBefore.UTC())
+	}
+	return w
+}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (s *Storage) ImportPost(ctx context.Context, post models.Post) error {
+	const op = "storage.postgres.ImportPost"
+
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = time.Now()
+	}
+	post.CreatedAt = post.CreatedAt.UTC().Truncate(time.Microsecond)
+	if post.Version < 1 {
+		post.Version = 1
+	}
+
+	query := `
+		INSERT INTO posts (id, site_id, title, content, author, comments_enabled, created_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	err := s.inTx(ctx, func(tx *Storage) error {
+		result, err := tx.q.ExecContext(ctx, query,
+			post.ID, post.SiteID, post.Title, post.Content, post.Author, post.CommentsEnabled, post.CreatedAt, post.Version)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+		}
+
+		if rowsAffected == 0 {
+			return errors.ErrAlreadyExists
+		}
+
+		if err := tx.indexPost(ctx, post); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Storage) ImportComment(ctx context.Context, comment models.Comment) error {
+	const op = "storage.postgres.ImportComment"
+
+	if err := storage.ValidateCommentID(comment.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err := s.inTx(ctx, func(tx *Storage) error {
+		post, err := tx.GetPost(ctx, comment.PostID)
+		if err != nil {
+			return err
+		}
+
+		var parent *models.Comment
+		if comment.ParentID != nil {
+			parent = &models.Comment{}
+			err := tx.q.GetContext(ctx, parent,
+				queryGetComment, *comment.ParentID, post.SiteID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("%s: failed to get parent: %w", op, err)
+			}
+			if err == sql.ErrNoRows || parent.PostID != comment.PostID {
+				return errors.ErrParentNotFound
+			}
+		}
+
+		comment.SiteID = post.SiteID
+		comment.Path, comment.Depth = storage.CommentPath(parent, comment.ID)
+		if comment.CreatedAt.IsZero() {
+			comment.CreatedAt = time.Now()
+		}
+		comment.CreatedAt = comment.CreatedAt.UTC().Truncate(time.Microsecond)
+
+		query := `
+			INSERT INTO comments (id, post_id, site_id, parent_id, author, content, created_at, path, depth, locked, hidden)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (id) DO NOTHING
+		`
+
+		result, err := tx.q.ExecContext(ctx, query,
+			comment.ID, comment.PostID, comment.SiteID, comment.ParentID, comment.Author, comment.Content, comment.CreatedAt,
+			comment.Path, comment.Depth, comment.Locked, comment.Hidden)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+		}
+
+		if rowsAffected == 0 {
+			return errors.ErrAlreadyExists
+		}
+
+		if err := tx.countComment(ctx, comment); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.indexComment(ctx, comment); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
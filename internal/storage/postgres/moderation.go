@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"fmt"
+	"strings"
+)
+
+func (s *Storage) HideComment(ctx context.Context, id string, hidden bool) error {
+	const op = "storage.postgres.HideComment"
+
+	result, err := s.q.ExecContext(ctx,
+		`UPDATE comments SET hidden = $2 WHERE id = $1 AND ($3::text = '' OR site_id = $3)`, id, hidden, tenant.SiteFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	s.pins.pin(ctx)
+	return nil
+}
+
+func (s *Storage) DeleteComment(ctx context.Context, id string) (int, error) {
+	const op = "storage.postgres.DeleteComment"
+
+	var deleted int
+	err := s.inTx(ctx, func(tx *Storage) error {
+		comment, err := tx.GetComment(ctx, id)
+		if err != nil {
+			return err
+		}
+		// Locking the post serializes with replies being added to the thread.
+		if _, err := tx.GetPost(ctx, comment.PostID); err != nil {
+			return err
+		}
+
+		deleted, err = tx.deleteThread(ctx, comment)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.recountPost(ctx, comment.PostID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// deleteThread removes comment and its descendants. Search documents go
+// with them through ON DELETE CASCADE.
+func (s *Storage) deleteThread(ctx context.Context, comment models.Comment) (int, error) {
+	lo, hi := storage.SubtreeRange(comment.Path)
+	query := `DELETE FROM comments WHERE id = $1 OR (path > $2 AND path < $3)`
+
+	result, err := s.q.ExecContext(ctx, query, comment.ID, lo, hi)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(deleted), nil
+}
+
+func (s *Storage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	const op = "storage.postgres.PurgeAuthor"
+
+	site := tenant.SiteFromContext(ctx)
+	var purged models.PurgeResult
+	err := s.inTx(ctx, func(tx *Storage) error {
+		result, err := tx.q.ExecContext(ctx, `
+			DELETE FROM comments
+			WHERE post_id IN (SELECT id FROM posts WHERE author = $1 AND ($2::text = '' OR site_id = $2))
+		`, author, site)
+		if err != nil {
+			return fmt.Errorf("%s: failed to delete comments of posts: %w", op, err)
+		}
+		comments, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+		}
+		purged.Comments = int(comments)
+
+		result, err = tx.q.ExecContext(ctx,
+			`DELETE FROM posts WHERE author = $1 AND ($2::text = '' OR site_id = $2)`, author, site)
+		if err != nil {
+			return fmt.Errorf("%s: failed to delete posts: %w", op, err)
+		}
+		posts, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+		}
+		purged.Posts = int(posts)
+
+		// Ordered by path, a thread root comes before the replies it takes
+		// down with it.
+		var authored []models.Comment
+		err = tx.q.SelectContext(ctx, &authored,
+			`SELECT * FROM comments WHERE author = $1 AND ($2::text = '' OR site_id = $2) ORDER BY path FOR UPDATE`, author, site)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get comments: %w", op, err)
+		}
+
+		touched := make(map[string]bool)
+		var last string
+		for _, comment := range authored {
+			if last != "" && strings.HasPrefix(comment.Path, last+storage.PathSeparator) {
+				continue
+			}
+			deleted, err := tx.deleteThread(ctx, comment)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			purged.Comments += deleted
+			touched[comment.PostID] = true
+			last = comment.Path
+		}
+
+		for postID := range touched {
+			if err := tx.recountPost(ctx, postID); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.PurgeResult{}, err
+	}
+
+	return purged, nil
+}
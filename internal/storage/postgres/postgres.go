@@ -3,6 +3,8 @@ package postgres
 import (
 	"comments-system/internal/config"
 	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
 	"comments-system/pkg/errors"
 	"comments-system/pkg/utils"
 	"context"
@@ -15,25 +17,106 @@ import (
 )
 
 type Storage struct {
-	db *sqlx.DB
+	db   *sqlx.DB
+	q    *conn
+	tx   *sqlx.Tx
+	lang string // text search configuration, see config.Postgres.SearchLanguage
+	opts poolOptions
+
+	replicas *replicaSet // nil without replicas
+	pins     *pinSet
 }
 
-func NewPostgresDB(cfg config.Postgres) (*Storage, error) {
-	const op = "storage.postgres.NewPostgresDB"
+// Hot queries, prepared once per pool; see conn. Their $2 is the site of
+// the call, "" for calls that see every site.
+var (
+	queryGetPost     = prepared(`SELECT * FROM posts WHERE id = $1 AND ($2::text = '' OR site_id = $2)`)
+	queryGetComment  = prepared(`SELECT * FROM comments WHERE id = $1 AND ($2::text = '' OR site_id = $2)`)
+	queryCommentPath = prepared(`SELECT path FROM comments WHERE id = $1 AND ($2::text = '' OR site_id = $2)`)
+	queryGetReplies  = prepared(`
+		SELECT * FROM comments
+		WHERE parent_id = $1 AND ($2::text = '' OR site_id = $2)
+		ORDER BY created_at ASC, id ASC
+	`)
+)
+
+func init() {
+	// Unfiltered pages of root comments back every post view, with and
+	// without a site.
+	for _, site := range []string{"", tenant.DefaultSite} {
+		roots := commentFilterWhere(site, "", models.CommentFilter{})
+		prepared(commentsPageQuery(roots))
+		prepared(commentsCountQuery(roots))
+	}
+}
 
+func NewPostgresDB(cfg config.Postgres) (*Storage, error) {
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.DBName, cfg.SSLMode)
 
-	db, err := sqlx.Open("postgres", dsn)
+	s, err := open(dsn, poolOptions{
+		maxOpenConns:     cfg.MaxOpenConns,
+		maxIdleConns:     cfg.MaxIdleConns,
+		connMaxLifetime:  cfg.ConnMaxLifetime,
+		statementTimeout: cfg.StatementTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SearchLanguage != "" {
+		s.lang = cfg.SearchLanguage
+	}
+
+	if len(cfg.Replicas) > 0 {
+		if err := s.UseReplicas(cfg.Replicas, cfg.ReplicaCheckInterval, cfg.ReadYourWrites); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// NewPostgresDBFromDSN opens the database at dsn with the default pool
+// settings and no statement timeout.
+func NewPostgresDBFromDSN(dsn string) (*Storage, error) {
+	return open(dsn, poolOptions{})
+}
+
+func open(dsn string, opts poolOptions) (*Storage, error) {
+	const op = "storage.postgres.NewPostgresDB"
+
+	c, err := openConn(dsn, opts)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := c.db.Ping(); err != nil {
+		c.close()
 		return nil, fmt.Errorf("%s: db.Ping error: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	// The migrator may still be running, so preparing is best effort here
+	// and retried on first use.
+	c.prepareAll(context.Background())
+
+	return &Storage{db: c.db, q: c, lang: defaultSearchLanguage, opts: opts}, nil
+}
+
+// UseReplicas sends reads made outside transactions to the standbys at
+// dsns, checking their health every checkInterval. A session that writes
+// reads from the primary for readYourWrites afterwards.
+func (s *Storage) UseReplicas(dsns []string, checkInterval, readYourWrites time.Duration) error {
+	const op = "storage.postgres.UseReplicas"
+
+	replicas, err := openReplicas(dsns, checkInterval, s.opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.replicas = replicas
+	s.pins = newPinSet(readYourWrites)
+	return nil
 }
 
 func (s *Storage) CreatePost(ctx context.Context, post models.Post) (models.Post, error) {
@@ -42,15 +125,36 @@ func (s *Storage) CreatePost(ctx context.Context, post models.Post) (models.Post
 	if post.ID == "" {
 		post.ID = utils.GenerateID()
 	}
-	post.CreatedAt = time.Now()
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+	// TIMESTAMP columns keep microseconds and no zone, so store what reads return.
+	post.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	post.Version = 1
+	post.CommentCount, post.RootCommentCount = 0, 0
 
 	query := `
-		INSERT INTO posts (id, title, content, author, comments_enabled, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO posts (id, site_id, title, content, author, comments_enabled, created_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO NOTHING
 	`
 
-	_, err := s.db.ExecContext(ctx, query,
-		post.ID, post.Title, post.Content, post.Author, post.CommentsEnabled, post.CreatedAt)
+	err := s.inTx(ctx, func(tx *Storage) error {
+		result, err := tx.q.ExecContext(ctx, query,
+			post.ID, post.SiteID, post.Title, post.Content, post.Author, post.CommentsEnabled, post.CreatedAt, post.Version)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return errors.ErrAlreadyExists
+		}
+
+		return tx.indexPost(ctx, post)
+	})
 	if err != nil {
 		return models.Post{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -58,17 +162,19 @@ func (s *Storage) CreatePost(ctx context.Context, post models.Post) (models.Post
 	return post, nil
 }
 
-func (s *Storage) GetPosts(ctx context.Context, limit, offset int) ([]models.Post, error) {
+func (s *Storage) GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error) {
 	const op = "storage.postgres.GetPosts"
 
+	w := postFilterWhere(tenant.SiteFromContext(ctx), filter)
 	query := `
-		SELECT * FROM posts 
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		SELECT * FROM posts
+		` + w.String() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
 	`
 
 	var posts []models.Post
-	err := s.db.SelectContext(ctx, &posts, query, limit, offset)
+	err := s.reader(ctx).SelectContext(ctx, &posts, s.db.Rebind(query), append(w.args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -79,10 +185,15 @@ func (s *Storage) GetPosts(ctx context.Context, limit, offset int) ([]models.Pos
 func (s *Storage) GetPost(ctx context.Context, id string) (models.Post, error) {
 	const op = "storage.postgres.GetPost"
 
-	query := `SELECT * FROM posts WHERE id = $1`
+	query := queryGetPost
+	if s.tx != nil {
+		// Lock the row so checks made on it (comments enabled, existence)
+		// hold until the transaction ends.
+		query += ` FOR UPDATE`
+	}
 
 	var post models.Post
-	err := s.db.GetContext(ctx, &post, query, id)
+	err := s.reader(ctx).GetContext(ctx, &post, query, id, tenant.SiteFromContext(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Post{}, errors.ErrNotFound
@@ -97,76 +208,110 @@ func (s *Storage) UpdatePost(ctx context.Context, post models.Post) error {
 	const op = "storage.postgres.UpdatePost"
 
 	query := `
-		UPDATE posts 
-		SET title = $1, content = $2, comments_enabled = $3
-		WHERE id = $4
+		UPDATE posts
+		SET title = $1, content = $2, comments_enabled = $3, version = version + 1
+		WHERE id = $4 AND version = $5 AND ($6::text = '' OR site_id = $6)
 	`
 
-	result, err := s.db.ExecContext(ctx, query,
-		post.Title, post.Content, post.CommentsEnabled, post.ID)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	site := tenant.SiteFromContext(ctx)
+	return s.inTx(ctx, func(tx *Storage) error {
+		result, err := tx.q.ExecContext(ctx, query,
+			post.Title, post.Content, post.CommentsEnabled, post.ID, post.Version, site)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+		}
 
-	if rowsAffected == 0 {
-		return errors.ErrNotFound
-	}
+		if rowsAffected == 0 {
+			var current int
+			err := tx.q.GetContext(ctx, &current,
+				`SELECT version FROM posts WHERE id = $1 AND ($2::text = '' OR site_id = $2)`, post.ID, site)
+			if err == sql.ErrNoRows {
+				return errors.ErrNotFound
+			}
+			if err != nil {
+				return fmt.Errorf("%s: failed to get current version: %w", op, err)
+			}
+			return &errors.ConflictError{CurrentVersion: current}
+		}
 
-	return nil
+		if err := tx.indexPost(ctx, post); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
 }
 
 func (s *Storage) CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error) {
 	const op = "storage.postgres.CreateComment"
 
-	if _, err := s.GetPost(ctx, comment.PostID); err != nil {
-		return models.Comment{}, err
-	}
+	err := s.inTx(ctx, func(tx *Storage) error {
+		post, err := tx.GetPost(ctx, comment.PostID)
+		if err != nil {
+			return err
+		}
 
-	if comment.ParentID != nil {
-		var parent models.Comment
-		err := s.db.GetContext(ctx, &parent,
-			"SELECT * FROM comments WHERE id = $1", *comment.ParentID)
-		if err != nil || parent.PostID != comment.PostID {
-			return models.Comment{}, errors.ErrParentNotFound
+		var parent *models.Comment
+		if comment.ParentID != nil {
+			parent = &models.Comment{}
+			err := tx.q.GetContext(ctx, parent,
+				queryGetComment, *comment.ParentID, post.SiteID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("%s: failed to get parent: %w", op, err)
+			}
+			if err == sql.ErrNoRows || parent.PostID != comment.PostID {
+				return errors.ErrParentNotFound
+			}
 		}
-	}
 
-	if comment.ID == "" {
-		comment.ID = utils.GenerateID()
-	}
-	comment.CreatedAt = time.Now()
+		if comment.ID == "" {
+			comment.ID = utils.GenerateID()
+		}
+		comment.SiteID = post.SiteID
+		comment.Path, comment.Depth = storage.CommentPath(parent, comment.ID)
+		comment.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+		query := `
+			INSERT INTO comments (id, post_id, site_id, parent_id, author, content, created_at, path, depth, hidden)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+
+		_, err = tx.q.ExecContext(ctx, query,
+			comment.ID, comment.PostID, comment.SiteID, comment.ParentID, comment.Author, comment.Content, comment.CreatedAt,
+			comment.Path, comment.Depth, comment.Hidden)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	query := `
-		INSERT INTO comments (id, post_id, parent_id, author, content, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
+		if err := tx.countComment(ctx, comment); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 
-	_, err := s.db.ExecContext(ctx, query,
-		comment.ID, comment.PostID, comment.ParentID, comment.Author, comment.Content, comment.CreatedAt)
+		if err := tx.indexComment(ctx, comment); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return models.Comment{}, fmt.Errorf("%s: %w", op, err)
+		return models.Comment{}, err
 	}
 
 	return comment, nil
 }
 
-func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, limit, offset int) ([]models.Comment, error) {
+func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, error) {
 	const op = "storage.postgres.GetCommentsByPost"
 
-	query := `
-		SELECT * FROM comments 
-		WHERE post_id = $1 AND parent_id IS NULL
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+	w := commentFilterWhere(tenant.SiteFromContext(ctx), postID, filter)
 
 	var comments []models.Comment
-	err := s.db.SelectContext(ctx, &comments, query, postID, limit, offset)
+	err := s.reader(ctx).SelectContext(ctx, &comments, commentsPageQuery(w), append(w.args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -174,13 +319,13 @@ func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, limit, o
 	return comments, nil
 }
 
-func (s *Storage) CountCommentsByPost(ctx context.Context, postID string) (int, error) {
+func (s *Storage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
 	const op = "storage.postgres.CountCommentsByPost"
 
-	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1 AND parent_id IS NULL`
+	w := commentFilterWhere(tenant.SiteFromContext(ctx), postID, filter)
 
 	var count int
-	err := s.db.GetContext(ctx, &count, query, postID)
+	err := s.reader(ctx).GetContext(ctx, &count, commentsCountQuery(w), w.args...)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -188,17 +333,24 @@ func (s *Storage) CountCommentsByPost(ctx context.Context, postID string) (int,
 	return count, nil
 }
 
+func commentsPageQuery(w *where) string {
+	return sqlx.Rebind(sqlx.DOLLAR, `
+		SELECT * FROM comments
+		`+w.String()+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`)
+}
+
+func commentsCountQuery(w *where) string {
+	return sqlx.Rebind(sqlx.DOLLAR, `SELECT COUNT(*) FROM comments `+w.String())
+}
+
 func (s *Storage) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
 	const op = "storage.postgres.GetCommentReplies"
 
-	query := `
-		SELECT * FROM comments 
-		WHERE parent_id = $1 
-		ORDER BY created_at ASC
-	`
-
 	var replies []models.Comment
-	err := s.db.SelectContext(ctx, &replies, query, parentID)
+	err := s.reader(ctx).SelectContext(ctx, &replies, queryGetReplies, parentID, tenant.SiteFromContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -209,10 +361,8 @@ func (s *Storage) GetCommentReplies(ctx context.Context, parentID string) ([]mod
 func (s *Storage) GetComment(ctx context.Context, id string) (models.Comment, error) {
 	const op = "storage.postgres.GetComment"
 
-	query := `SELECT * FROM comments WHERE id = $1`
-
 	var comment models.Comment
-	err := s.db.GetContext(ctx, &comment, query, id)
+	err := s.reader(ctx).GetContext(ctx, &comment, queryGetComment, id, tenant.SiteFromContext(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Comment{}, errors.ErrNotFound
@@ -223,6 +373,195 @@ func (s *Storage) GetComment(ctx context.Context, id string) (models.Comment, er
 	return comment, nil
 }
 
+func (s *Storage) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	const op = "storage.postgres.GetCommentAncestors"
+
+	var path string
+	err := s.reader(ctx).GetContext(ctx, &path, queryCommentPath, id, tenant.SiteFromContext(ctx))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return storage.PathAncestors(path), nil
+}
+
+func (s *Storage) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	const op = "storage.postgres.GetCommentSubtree"
+
+	// Both reads go to the same server, so the subtree matches its root even
+	// when replicas lag behind by different amounts.
+	q := s.reader(ctx)
+
+	var root models.Comment
+	if err := q.GetContext(ctx, &root, queryGetComment, id, tenant.SiteFromContext(ctx)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	lo, hi := storage.SubtreeRange(root.Path)
+	query := `
+		SELECT * FROM comments
+		WHERE path > $1 AND path < $2 AND ($3 <= 0 OR depth <= $4)
+		ORDER BY path
+	`
+
+	var subtree []models.Comment
+	err := q.SelectContext(ctx, &subtree, query, lo, hi, maxDepth, root.Depth+maxDepth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return subtree, nil
+}
+
+func (s *Storage) LockThread(ctx context.Context, id string) error {
+	const op = "storage.postgres.LockThread"
+
+	return s.inTx(ctx, func(tx *Storage) error {
+		comment, err := tx.GetComment(ctx, id)
+		if err != nil {
+			return err
+		}
+		// Locking the post serializes with replies being added to the thread,
+		// which check the lock while they hold the post.
+		if _, err := tx.GetPost(ctx, comment.PostID); err != nil {
+			return err
+		}
+
+		if _, err := tx.q.ExecContext(ctx, `UPDATE comments SET locked = true WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) IsThreadLocked(ctx context.Context, id string) (bool, error) {
+	const op = "storage.postgres.IsThreadLocked"
+
+	q := s.reader(ctx)
+
+	var path string
+	err := q.GetContext(ctx, &path, queryCommentPath, id, tenant.SiteFromContext(ctx))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, errors.ErrNotFound
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids := append(storage.PathAncestors(path), id)
+	query, args, err := sqlx.In(`SELECT EXISTS (SELECT 1 FROM comments WHERE id IN (?) AND locked)`, ids)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var locked bool
+	if err := q.GetContext(ctx, &locked, s.db.Rebind(query), args...); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return locked, nil
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	const op = "storage.postgres.GetIdempotencyKey"
+
+	// Always read from the primary: a key is looked up right after a
+	// concurrent request committed it.
+	query := `SELECT entity_id FROM idempotency_keys WHERE key = $1 AND expires_at > $2`
+
+	var entityID string
+	err := s.q.GetContext(ctx, &entityID, query, key, time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.ErrNotFound
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entityID, nil
+}
+
+func (s *Storage) SaveIdempotencyKey(ctx context.Context, key, entityID string, expiresAt time.Time) error {
+	const op = "storage.postgres.SaveIdempotencyKey"
+
+	// Expired keys are dropped here rather than by a background job, which
+	// also frees key for reuse.
+	_, err := s.q.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("%s: failed to delete expired keys: %w", op, err)
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (key, entity_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING
+	`
+
+	result, err := s.q.ExecContext(ctx, query, key, entityID, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrIdempotencyKeyExists
+	}
+
+	return nil
+}
+
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return s.inTx(ctx, func(tx *Storage) error {
+		return fn(tx)
+	})
+}
+
+func (s *Storage) inTx(ctx context.Context, fn func(tx *Storage) error) error {
+	const op = "storage.postgres.WithTx"
+
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: failed to begin: %w", op, err)
+	}
+
+	if err := fn(&Storage{db: s.db, q: s.q.inTx(tx), tx: tx, lang: s.lang, opts: s.opts}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: failed to commit: %w", op, err)
+	}
+
+	s.pins.pin(ctx)
+	return nil
+}
+
+// Close releases the database. Storages handed to WithTx callbacks share the
+// connection pool with their parent, so closing them is a no-op.
 func (s *Storage) Close() error {
-	return s.db.Close()
+	if s.tx != nil {
+		return nil
+	}
+	if s.replicas != nil {
+		if err := s.replicas.close(); err != nil {
+			s.q.close()
+			return err
+		}
+	}
+	return s.q.close()
 }
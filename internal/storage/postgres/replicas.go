@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"comments-system/internal/storage"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type replica struct {
+	conn    *conn
+	healthy atomic.Bool
+}
+
+// replicaSet spreads reads over standbys round-robin, skipping those whose
+// last health check failed.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	interval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func openReplicas(dsns []string, interval time.Duration, opts poolOptions) (*replicaSet, error) {
+	rs := &replicaSet{interval: interval, done: make(chan struct{})}
+	for _, dsn := range dsns {
+		c, err := openConn(dsn, opts)
+		if err != nil {
+			rs.close()
+			return nil, err
+		}
+		rs.replicas = append(rs.replicas, &replica{conn: c})
+	}
+
+	// A replica that is down at startup is only skipped, not fatal.
+	rs.check()
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			r.conn.prepareAll(context.Background())
+		}
+	}
+
+	rs.wg.Add(1)
+	go rs.run()
+
+	return rs, nil
+}
+
+// pick returns the next healthy replica, or nil when there is none.
+func (rs *replicaSet) pick() *conn {
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.conn
+		}
+	}
+	return nil
+}
+
+func (rs *replicaSet) check() {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), rs.interval)
+			defer cancel()
+			r.healthy.Store(r.conn.db.PingContext(ctx) == nil)
+		}()
+	}
+	wg.Wait()
+}
+
+func (rs *replicaSet) run() {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rs.check()
+		case <-rs.done:
+			return
+		}
+	}
+}
+
+func (rs *replicaSet) close() error {
+	close(rs.done)
+	rs.wg.Wait()
+
+	var errs []error
+	for _, r := range rs.replicas {
+		errs = append(errs, r.conn.close())
+	}
+	return errors.Join(errs...)
+}
+
+// pinSet remembers until when each session has to read from the primary.
+type pinSet struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	until     map[string]time.Time
+	nextSweep time.Time
+}
+
+func newPinSet(window time.Duration) *pinSet {
+	return &pinSet{window: window, until: make(map[string]time.Time)}
+}
+
+// pin keeps the request of ctx on the primary for the rest of it, and its
+// session for the window from now.
+func (p *pinSet) pin(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	storage.MarkWritten(ctx)
+
+	id := storage.SessionFromContext(ctx)
+	if p.window <= 0 || id == "" {
+		return
+	}
+
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.until[id] = now.Add(p.window)
+
+	// Sweep at most once per window so expired sessions do not pile up.
+	if now.After(p.nextSweep) {
+		for id, until := range p.until {
+			if !now.Before(until) {
+				delete(p.until, id)
+			}
+		}
+		p.nextSweep = now.Add(p.window)
+	}
+}
+
+func (p *pinSet) pinned(ctx context.Context) bool {
+	if p == nil {
+		return false
+	}
+	if storage.Written(ctx) {
+		return true
+	}
+
+	id := storage.SessionFromContext(ctx)
+	if id == "" {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return time.Now().Before(p.until[id])
+}
+
+// reader returns where a read should go: the transaction inside WithTx,
+// the primary for a request that wrote, a pinned session or when no replica
+// is healthy, and the next healthy replica otherwise.
+func (s *Storage) reader(ctx context.Context) queryer {
+	if s.tx != nil || s.replicas == nil || s.pins.pinned(ctx) {
+		return s.q
+	}
+	if c := s.replicas.pick(); c != nil {
+		return c
+	}
+	return s.q
+}
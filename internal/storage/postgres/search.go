@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultSearchLanguage = "english"
+
+	headlineOptions = "StartSel=<mark>, StopSel=</mark>, MinWords=15, MaxWords=35"
+)
+
+// searchRow is a ranked hit before the post or comment behind it is loaded.
+type searchRow struct {
+	Kind    string  `db:"kind"`
+	ID      string  `db:"id"`
+	Score   float64 `db:"score"`
+	Snippet string  `db:"snippet"`
+}
+
+// indexPost and indexComment keep post_search and comment_search in step
+// with the rows they describe. Title terms rank above body terms.
+func (s *Storage) indexPost(ctx context.Context, post models.Post) error {
+	query := `
+		INSERT INTO post_search (post_id, document)
+		VALUES ($1, setweight(to_tsvector($2::regconfig, $3), 'A') || setweight(to_tsvector($2::regconfig, $4), 'B'))
+		ON CONFLICT (post_id) DO UPDATE SET document = EXCLUDED.document
+	`
+
+	if _, err := s.q.ExecContext(ctx, query, post.ID, s.lang, post.Title, post.Content); err != nil {
+		return fmt.Errorf("failed to index post: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) indexComment(ctx context.Context, comment models.Comment) error {
+	query := `
+		INSERT INTO comment_search (comment_id, post_id, document)
+		VALUES ($1, $2, to_tsvector($3::regconfig, $4))
+		ON CONFLICT (comment_id) DO UPDATE SET document = EXCLUDED.document
+	`
+
+	if _, err := s.q.ExecContext(ctx, query, comment.ID, comment.PostID, s.lang, comment.Content); err != nil {
+		return fmt.Errorf("failed to index comment: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error) {
+	const op = "storage.postgres.Search"
+
+	// Hits are ranked and paged first, so headlines are only built for the
+	// page being returned. Rank normalization 32 maps scores into [0, 1) and
+	// keeps posts and comments comparable.
+	q := `
+		WITH q AS (
+			SELECT websearch_to_tsquery($1::regconfig, $2) AS query
+		),
+		hits AS (
+			SELECT 'post' AS kind, s.post_id AS id, ts_rank_cd(s.document, q.query, 32) AS score
+			FROM post_search s JOIN posts hp ON hp.id = s.post_id, q
+			WHERE $3::boolean AND s.document @@ q.query AND ($4::text IS NULL OR s.post_id = $4)
+				AND ($9::text = '' OR hp.site_id = $9)
+			UNION ALL
+			SELECT 'comment', s.comment_id, ts_rank_cd(s.document, q.query, 32)
+			FROM comment_search s JOIN comments hc ON hc.id = s.comment_id, q
+			WHERE $5::boolean AND s.document @@ q.query AND ($4::text IS NULL OR s.post_id = $4)
+				AND NOT hc.hidden AND ($9::text = '' OR hc.site_id = $9)
+			ORDER BY score DESC, kind, id
+			LIMIT $6 OFFSET $7
+		)
+		SELECT h.kind, h.id, h.score,
+			ts_headline($1::regconfig, COALESCE(p.title || ' ' || p.content, c.content), q.query, $8) AS snippet
+		FROM hits h
+		CROSS JOIN q
+		LEFT JOIN posts p ON h.kind = 'post' AND p.id = h.id
+		LEFT JOIN comments c ON h.kind = 'comment' AND c.id = h.id
+		ORDER BY h.score DESC, h.kind, h.id
+	`
+
+	db := s.reader(ctx)
+
+	var rows []searchRow
+	err := db.SelectContext(ctx, &rows, q,
+		s.lang, query.Query, query.Type.IncludesPosts(), query.PostID, query.Type.IncludesComments(),
+		query.Limit, query.Offset, headlineOptions, tenant.SiteFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hits, err := s.loadHits(ctx, db, rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hits, nil
+}
+
+// loadHits fetches the posts and comments behind rows from db, keeping
+// their order.
+func (s *Storage) loadHits(ctx context.Context, db queryer, rows []searchRow) ([]models.SearchHit, error) {
+	var postIDs, commentIDs []string
+	for _, row := range rows {
+		if row.Kind == "post" {
+			postIDs = append(postIDs, row.ID)
+		} else {
+			commentIDs = append(commentIDs, row.ID)
+		}
+	}
+
+	posts := make(map[string]models.Post, len(postIDs))
+	if len(postIDs) > 0 {
+		query, args, err := sqlx.In(`SELECT * FROM posts WHERE id IN (?)`, postIDs)
+		if err != nil {
+			return nil, err
+		}
+		var found []models.Post
+		if err := db.SelectContext(ctx, &found, s.db.Rebind(query), args...); err != nil {
+			return nil, fmt.Errorf("failed to load posts: %w", err)
+		}
+		for _, p := range found {
+			posts[p.ID] = p
+		}
+	}
+
+	comments := make(map[string]models.Comment, len(commentIDs))
+	if len(commentIDs) > 0 {
+		query, args, err := sqlx.In(`SELECT * FROM comments WHERE id IN (?)`, commentIDs)
+		if err != nil {
+			return nil, err
+		}
+		var found []models.Comment
+		if err := db.SelectContext(ctx, &found, s.db.Rebind(query), args...); err != nil {
+			return nil, fmt.Errorf("failed to load comments: %w", err)
+		}
+		for _, c := range found {
+			comments[c.ID] = c
+		}
+	}
+
+	hits := make([]models.SearchHit, 0, len(rows))
+	for _, row := range rows {
+		hit := models.SearchHit{Score: row.Score, Snippet: row.Snippet}
+		if row.Kind == "post" {
+			post, ok := posts[row.ID]
+			if !ok {
+				continue
+			}
+			hit.Post = &post
+		} else {
+			comment, ok := comments[row.ID]
+			if !ok {
+				continue
+			}
+			hit.Comment = &comment
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
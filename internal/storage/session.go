@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type sessionCtx struct{}
+
+type requestCtx struct{}
+
+// WithSession tags ctx with the ID of the client session making the call.
+// Storages that read from replicas send a session's reads to the primary
+// for a while after it writes, so the session sees its own changes.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionCtx{}, id)
+}
+
+// SessionFromContext returns the session ID set by WithSession, or "".
+func SessionFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionCtx{}).(string)
+	return id
+}
+
+// WithRequest scopes ctx to one client request. Storages that read from
+// replicas send the reads of a request to the primary once it has written,
+// so a request sees its own changes with or without a session.
+func WithRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCtx{}, new(atomic.Bool))
+}
+
+// MarkWritten records that the request of ctx has written. It does nothing
+// outside WithRequest.
+func MarkWritten(ctx context.Context) {
+	if written, ok := ctx.Value(requestCtx{}).(*atomic.Bool); ok {
+		written.Store(true)
+	}
+}
+
+// Written reports whether MarkWritten was called for the request of ctx.
+func Written(ctx context.Context) bool {
+	written, ok := ctx.Value(requestCtx{}).(*atomic.Bool)
+	return ok && written.Load()
+}
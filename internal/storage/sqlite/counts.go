@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"context"
+	"fmt"
+)
+
+// countComment bumps the counters of the post a new comment belongs to. It
+// runs in the transaction that inserts the comment.
+func (s *Storage) countComment(ctx context.Context, comment models.Comment) error {
+	root := 0
+	if comment.ParentID == nil {
+		root = 1
+	}
+
+	query := `
+		UPDATE posts
+		SET comment_count = comment_count + 1, root_comment_count = root_comment_count + ?
+		WHERE id = ?
+	`
+
+	if _, err := s.q.ExecContext(ctx, query, root, comment.PostID); err != nil {
+		return fmt.Errorf("failed to count comment: %w", err)
+	}
+	return nil
+}
+
+// recountPost recomputes the counters of one post after comments were
+// removed from it, in the transaction that removed them.
+func (s *Storage) recountPost(ctx context.Context, postID string) error {
+	query := `
+		UPDATE posts SET
+			comment_count = (SELECT COUNT(*) FROM comments WHERE post_id = ?1),
+			root_comment_count = (SELECT COUNT(*) FROM comments WHERE post_id = ?1 AND parent_id IS NULL)
+		WHERE id = ?1
+	`
+
+	if _, err := s.q.ExecContext(ctx, query, postID); err != nil {
+		return fmt.Errorf("failed to recount comments: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) RecountComments(ctx context.Context) (int, error) {
+	const op = "storage.sqlite.RecountComments"
+
+	query := `
+		UPDATE posts
+		SET comment_count = counts.total, root_comment_count = counts.roots
+		FROM (
+			SELECT p.id,
+				COUNT(c.id) AS total,
+				COUNT(c.id) FILTER (WHERE c.parent_id IS NULL) AS roots
+			FROM posts p
+			LEFT JOIN comments c ON c.post_id = p.id
+			GROUP BY p.id
+		) AS counts
+		WHERE posts.id = counts.id
+			AND (posts.comment_count <> counts.total OR posts.root_comment_count <> counts.roots)
+			AND ` + inSite
+
+	site := tenant.SiteFromContext(ctx)
+	result, err := s.q.ExecContext(ctx, query, site, site)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	fixed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	return int(fixed), nil
+}
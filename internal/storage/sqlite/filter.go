@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"comments-system/internal/models"
+	"strings"
+)
+
+// where collects the conditions of a filtered query and their arguments.
+type where struct {
+	conds []string
+	args  []any
+}
+
+func (w *where) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// inSite limits a query to the site of the call. Both of its arguments are
+// the site from tenant.SiteFromContext, "" for calls that see every site.
+const inSite = "(? = '' OR site_id = ?)"
+
+// created_at keeps the zone offset it was written with, so it is compared
+// through julianday, which normalizes to UTC at millisecond precision.
+func postFilterWhere(site string, f models.PostFilter) *where {
+	w := &where{}
+	if site != "" {
+		w.add("site_id = ?", site)
+	}
+	if f.Author != nil {
+		w.add("author = ?", *f.Author)
+	}
+	if f.CreatedAfter != nil {
+		w.add("julianday(created_at) > julianday(?)", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		w.add("julianday(created_at) < julianday(?)", *f.CreatedBefore)
+	}
+	if f.CommentsEnabled != nil {
+		w.add("comments_enabled = ?", *f.CommentsEnabled)
+	}
+	if f.HasComments != nil {
+		exists := "EXISTS (SELECT 1 FROM comments c WHERE c.post_id = posts.id)"
+		if !*f.HasComments {
+			exists = "NOT " + exists
+		}
+		w.add(exists)
+	}
+	return w
+}
+
+func commentFilterWhere(site, postID string, f models.CommentFilter) *where {
+	w := &where{}
+	w.add("post_id = ?", postID)
+	if site != "" {
+		w.add("site_id = ?", site)
+	}
+	if f.HasParent != nil && *f.HasParent {
+		w.add("parent_id IS NOT NULL")
+	} else {
+		w.add("parent_id IS NULL")
+	}
+	if f.Author != nil {
+		w.add("author = ?", *f.Author)
+	}
+	if f.CreatedAfter != nil {
+		w.add("julianday(created_at) > julianday(?)", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		w.add("julianday(created_at) < julianday(?)", *f.CreatedBefore)
+	}
+	return w
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"fmt"
+	"strings"
+)
+
+func (s *Storage) HideComment(ctx context.Context, id string, hidden bool) error {
+	const op = "storage.sqlite.HideComment"
+
+	site := tenant.SiteFromContext(ctx)
+	result, err := s.q.ExecContext(ctx, `UPDATE comments SET hidden = ? WHERE id = ? AND `+inSite, hidden, id, site, site)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteComment(ctx context.Context, id string) (int, error) {
+	const op = "storage.sqlite.DeleteComment"
+
+	var deleted int
+	err := s.inTx(ctx, func(tx *Storage) error {
+		comment, err := tx.GetComment(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = tx.deleteThread(ctx, comment)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.recountPost(ctx, comment.PostID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// deleteThread removes comment and its descendants. The FTS rows go with
+// them through the delete trigger.
+func (s *Storage) deleteThread(ctx context.Context, comment models.Comment) (int, error) {
+	lo, hi := storage.SubtreeRange(comment.Path)
+	return s.deleteComments(ctx, `id = ? OR (path > ? AND path < ?)`, comment.ID, lo, hi)
+}
+
+// deleteComments removes the comments matching cond. They are counted
+// beforehand: rows that ON DELETE CASCADE takes with a parent are not
+// included in the rows affected.
+func (s *Storage) deleteComments(ctx context.Context, cond string, args ...any) (int, error) {
+	var count int
+	if err := s.q.GetContext(ctx, &count, `SELECT COUNT(*) FROM comments WHERE `+cond, args...); err != nil {
+		return 0, err
+	}
+
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM comments WHERE `+cond, args...); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *Storage) PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error) {
+	const op = "storage.sqlite.PurgeAuthor"
+
+	site := tenant.SiteFromContext(ctx)
+	var purged models.PurgeResult
+	err := s.inTx(ctx, func(tx *Storage) error {
+		comments, err := tx.deleteComments(ctx,
+			`post_id IN (SELECT id FROM posts WHERE author = ? AND `+inSite+`)`, author, site, site)
+		if err != nil {
+			return fmt.Errorf("%s: failed to delete comments of posts: %w", op, err)
+		}
+		purged.Comments = comments
+
+		result, err := tx.q.ExecContext(ctx, `DELETE FROM posts WHERE author = ? AND `+inSite, author, site, site)
+		if err != nil {
+			return fmt.Errorf("%s: failed to delete posts: %w", op, err)
+		}
+		posts, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+		}
+		purged.Posts = int(posts)
+
+		// Ordered by path, a thread root comes before the replies it takes
+		// down with it.
+		var authored []models.Comment
+		err = tx.q.SelectContext(ctx, &authored,
+			`SELECT * FROM comments WHERE author = ? AND `+inSite+` ORDER BY path`, author, site, site)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get comments: %w", op, err)
+		}
+
+		touched := make(map[string]bool)
+		var last string
+		for _, comment := range authored {
+			if last != "" && strings.HasPrefix(comment.Path, last+storage.PathSeparator) {
+				continue
+			}
+			deleted, err := tx.deleteThread(ctx, comment)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			purged.Comments += deleted
+			touched[comment.PostID] = true
+			last = comment.Path
+		}
+
+		for postID := range touched {
+			if err := tx.recountPost(ctx, postID); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.PurgeResult{}, err
+	}
+
+	return purged, nil
+}
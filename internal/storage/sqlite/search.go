@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// searchRow is a ranked hit before the post or comment behind it is loaded.
+type searchRow struct {
+	Kind    string  `db:"kind"`
+	ID      string  `db:"id"`
+	Score   float64 `db:"score"`
+	Snippet string  `db:"snippet"`
+}
+
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error) {
+	const op = "storage.sqlite.Search"
+
+	match := ftsQuery(query.Query)
+	if match == "" {
+		return nil, nil
+	}
+
+	// bm25 is lower for better matches, so it is negated into a score.
+	// Post titles weigh twice as much as post bodies.
+	q := `
+		SELECT kind, id, score, snippet FROM (
+			SELECT 'post' AS kind, post_id AS id, -bm25(posts_fts, 0.0, 2.0, 1.0) AS score,
+				snippet(posts_fts, -1, '<mark>', '</mark>', '…', 24) AS snippet
+			FROM posts_fts
+			WHERE ? AND posts_fts MATCH ? AND (? IS NULL OR post_id = ?)
+				AND (? = '' OR post_id IN (SELECT id FROM posts WHERE site_id = ?))
+			UNION ALL
+			SELECT 'comment', comment_id, -bm25(comments_fts),
+				snippet(comments_fts, 2, '<mark>', '</mark>', '…', 24)
+			FROM comments_fts
+			WHERE ? AND comments_fts MATCH ? AND (? IS NULL OR post_id = ?)
+				AND comment_id NOT IN (SELECT id FROM comments WHERE hidden)
+				AND (? = '' OR comment_id IN (SELECT id FROM comments WHERE site_id = ?))
+		)
+		ORDER BY score DESC, kind, id
+		LIMIT ? OFFSET ?
+	`
+
+	site := tenant.SiteFromContext(ctx)
+	var rows []searchRow
+	err := s.q.SelectContext(ctx, &rows, q,
+		query.Type.IncludesPosts(), match, query.PostID, query.PostID, site, site,
+		query.Type.IncludesComments(), match, query.PostID, query.PostID, site, site,
+		query.Limit, query.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hits, err := s.loadHits(ctx, rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hits, nil
+}
+
+// ftsQuery turns free text into an FTS5 query that requires every word.
+// Words are quoted so FTS5 operators in user input are matched literally.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = `"` + word + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// loadHits fetches the posts and comments behind rows, keeping their order.
+func (s *Storage) loadHits(ctx context.Context, rows []searchRow) ([]models.SearchHit, error) {
+	var postIDs, commentIDs []string
+	for _, row := range rows {
+		if row.Kind == "post" {
+			postIDs = append(postIDs, row.ID)
+		} else {
+			commentIDs = append(commentIDs, row.ID)
+		}
+	}
+
+	posts := make(map[string]models.Post, len(postIDs))
+	if len(postIDs) > 0 {
+		query, args, err := sqlx.In(`SELECT * FROM posts WHERE id IN (?)`, postIDs)
+		if err != nil {
+			return nil, err
+		}
+		var found []models.Post
+		if err := s.q.SelectContext(ctx, &found, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to load posts: %w", err)
+		}
+		for _, p := range found {
+			posts[p.ID] = p
+		}
+	}
+
+	comments := make(map[string]models.Comment, len(commentIDs))
+	if len(commentIDs) > 0 {
+		query, args, err := sqlx.In(`SELECT * FROM comments WHERE id IN (?)`, commentIDs)
+		if err != nil {
+			return nil, err
+		}
+		var found []models.Comment
+		if err := s.q.SelectContext(ctx, &found, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to load comments: %w", err)
+		}
+		for _, c := range found {
+			comments[c.ID] = c
+		}
+	}
+
+	hits := make([]models.SearchHit, 0, len(rows))
+	for _, row := range rows {
+		hit := models.SearchHit{Score: row.Score, Snippet: row.Snippet}
+		if row.Kind == "post" {
+			post, ok := posts[row.ID]
+			if !ok {
+				continue
+			}
+			hit.Post = &post
+		} else {
+			comment, ok := comments[row.ID]
+			if !ok {
+				continue
+			}
+			hit.Comment = &comment
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
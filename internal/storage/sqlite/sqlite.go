@@ -0,0 +1,475 @@
+package sqlite
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"comments-system/pkg/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+type Storage struct {
+	db *sqlx.DB
+	q  queryer
+	tx *sqlx.Tx
+}
+
+// queryer is implemented by both *sqlx.DB and *sqlx.Tx, so the same methods
+// serve plain calls and calls inside WithTx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+func NewSQLiteDB(cfg config.SQLite) (*Storage, error) {
+	const op = "storage.sqlite.NewSQLiteDB"
+
+	if dir := filepath.Dir(cfg.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("%s: failed to create data directory: %w", op, err)
+		}
+	}
+
+	db, err := sqlx.Open("sqlite", DSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s: db.Ping error: %w", op, err)
+	}
+
+	return &Storage{db: db, q: db}, nil
+}
+
+// DSN builds the modernc.org/sqlite connection string. Foreign keys are off by
+// default in SQLite, so they are enabled per connection along with WAL mode.
+// Transactions start as IMMEDIATE so a read followed by a write in WithTx
+// cannot fail to upgrade its lock.
+func DSN(cfg config.SQLite) string {
+	return "file:" + cfg.Path +
+		"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_time_format=sqlite&_txlock=immediate"
+}
+
+func (s *Storage) CreatePost(ctx context.Context, post models.Post) (models.Post, error) {
+	const op = "storage.sqlite.CreatePost"
+
+	if post.ID == "" {
+		post.ID = utils.GenerateID()
+	}
+	post.SiteID = tenant.Assign(ctx, post.SiteID)
+	// Round(0) drops the monotonic reading so the value survives a round trip.
+	post.CreatedAt = time.Now().Round(0)
+	post.Version = 1
+	post.CommentCount, post.RootCommentCount = 0, 0
+
+	query := `
+		INSERT INTO posts (id, site_id, title, content, author, comments_enabled, created_at, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	result, err := s.q.ExecContext(ctx, query,
+		post.ID, post.SiteID, post.Title, post.Content, post.Author, post.CommentsEnabled, post.CreatedAt, post.Version)
+	if err != nil {
+		return models.Post{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return models.Post{}, fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return models.Post{}, fmt.Errorf("%s: %w", op, errors.ErrAlreadyExists)
+	}
+
+	return post, nil
+}
+
+func (s *Storage) GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error) {
+	const op = "storage.sqlite.GetPosts"
+
+	w := postFilterWhere(tenant.SiteFromContext(ctx), filter)
+	query := `
+		SELECT * FROM posts
+		` + w.String() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	var posts []models.Post
+	err := s.q.SelectContext(ctx, &posts, query, append(w.args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return posts, nil
+}
+
+func (s *Storage) GetPost(ctx context.Context, id string) (models.Post, error) {
+	const op = "storage.sqlite.GetPost"
+
+	site := tenant.SiteFromContext(ctx)
+	query := `SELECT * FROM posts WHERE id = ? AND ` + inSite
+
+	var post models.Post
+	err := s.q.GetContext(ctx, &post, query, id, site, site)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Post{}, errors.ErrNotFound
+		}
+		return models.Post{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return post, nil
+}
+
+func (s *Storage) UpdatePost(ctx context.Context, post models.Post) error {
+	const op = "storage.sqlite.UpdatePost"
+
+	site := tenant.SiteFromContext(ctx)
+	query := `
+		UPDATE posts
+		SET title = ?, content = ?, comments_enabled = ?, version = version + 1
+		WHERE id = ? AND version = ? AND ` + inSite
+
+	result, err := s.q.ExecContext(ctx, query,
+		post.Title, post.Content, post.CommentsEnabled, post.ID, post.Version, site, site)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		var current int
+		err := s.q.GetContext(ctx, &current, `SELECT version FROM posts WHERE id = ? AND `+inSite, post.ID, site, site)
+		if err == sql.ErrNoRows {
+			return errors.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("%s: failed to get current version: %w", op, err)
+		}
+		return &errors.ConflictError{CurrentVersion: current}
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error) {
+	const op = "storage.sqlite.CreateComment"
+
+	err := s.inTx(ctx, func(tx *Storage) error {
+		post, err := tx.GetPost(ctx, comment.PostID)
+		if err != nil {
+			return err
+		}
+
+		var parent *models.Comment
+		if comment.ParentID != nil {
+			parent = &models.Comment{}
+			err := tx.q.GetContext(ctx, parent,
+				"SELECT * FROM comments WHERE id = ?", *comment.ParentID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("%s: failed to get parent: %w", op, err)
+			}
+			if err == sql.ErrNoRows || parent.PostID != comment.PostID {
+				return errors.ErrParentNotFound
+			}
+		}
+
+		if comment.ID == "" {
+			comment.ID = utils.GenerateID()
+		}
+		comment.SiteID = post.SiteID
+		comment.Path, comment.Depth = storage.CommentPath(parent, comment.ID)
+		comment.CreatedAt = time.Now().Round(0)
+
+		query := `
+			INSERT INTO comments (id, post_id, site_id, parent_id, author, content, created_at, path, depth, hidden)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		_, err = tx.q.ExecContext(ctx, query,
+			comment.ID, comment.PostID, comment.SiteID, comment.ParentID, comment.Author, comment.Content, comment.CreatedAt,
+			comment.Path, comment.Depth, comment.Hidden)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.countComment(ctx, comment); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	return comment, nil
+}
+
+func (s *Storage) GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, error) {
+	const op = "storage.sqlite.GetCommentsByPost"
+
+	w := commentFilterWhere(tenant.SiteFromContext(ctx), postID, filter)
+	query := `
+		SELECT * FROM comments
+		` + w.String() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	var comments []models.Comment
+	err := s.q.SelectContext(ctx, &comments, query, append(w.args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return comments, nil
+}
+
+func (s *Storage) CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error) {
+	const op = "storage.sqlite.CountCommentsByPost"
+
+	w := commentFilterWhere(tenant.SiteFromContext(ctx), postID, filter)
+	query := `SELECT COUNT(*) FROM comments ` + w.String()
+
+	var count int
+	err := s.q.GetContext(ctx, &count, query, w.args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, nil
+}
+
+func (s *Storage) GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error) {
+	const op = "storage.sqlite.GetCommentReplies"
+
+	site := tenant.SiteFromContext(ctx)
+	query := `
+		SELECT * FROM comments
+		WHERE parent_id = ? AND ` + inSite + `
+		ORDER BY created_at ASC, id ASC
+	`
+
+	var replies []models.Comment
+	err := s.q.SelectContext(ctx, &replies, query, parentID, site, site)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return replies, nil
+}
+
+func (s *Storage) GetComment(ctx context.Context, id string) (models.Comment, error) {
+	const op = "storage.sqlite.GetComment"
+
+	site := tenant.SiteFromContext(ctx)
+	query := `SELECT * FROM comments WHERE id = ? AND ` + inSite
+
+	var comment models.Comment
+	err := s.q.GetContext(ctx, &comment, query, id, site, site)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Comment{}, errors.ErrNotFound
+		}
+		return models.Comment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return comment, nil
+}
+
+func (s *Storage) GetCommentAncestors(ctx context.Context, id string) ([]string, error) {
+	const op = "storage.sqlite.GetCommentAncestors"
+
+	site := tenant.SiteFromContext(ctx)
+	var path string
+	err := s.q.GetContext(ctx, &path, `SELECT path FROM comments WHERE id = ? AND `+inSite, id, site, site)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return storage.PathAncestors(path), nil
+}
+
+func (s *Storage) GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error) {
+	const op = "storage.sqlite.GetCommentSubtree"
+
+	root, err := s.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	lo, hi := storage.SubtreeRange(root.Path)
+	query := `
+		SELECT * FROM comments
+		WHERE path > ? AND path < ? AND (? <= 0 OR depth <= ?)
+		ORDER BY path
+	`
+
+	var subtree []models.Comment
+	err = s.q.SelectContext(ctx, &subtree, query, lo, hi, maxDepth, root.Depth+maxDepth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return subtree, nil
+}
+
+func (s *Storage) LockThread(ctx context.Context, id string) error {
+	const op = "storage.sqlite.LockThread"
+
+	site := tenant.SiteFromContext(ctx)
+	result, err := s.q.ExecContext(ctx, `UPDATE comments SET locked = 1 WHERE id = ? AND `+inSite, id, site, site)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) IsThreadLocked(ctx context.Context, id string) (bool, error) {
+	const op = "storage.sqlite.IsThreadLocked"
+
+	site := tenant.SiteFromContext(ctx)
+	var path string
+	err := s.q.GetContext(ctx, &path, `SELECT path FROM comments WHERE id = ? AND `+inSite, id, site, site)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, errors.ErrNotFound
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids := append(storage.PathAncestors(path), id)
+	query, args, err := sqlx.In(`SELECT EXISTS (SELECT 1 FROM comments WHERE id IN (?) AND locked)`, ids)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var locked bool
+	if err := s.q.GetContext(ctx, &locked, s.db.Rebind(query), args...); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return locked, nil
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	const op = "storage.sqlite.GetIdempotencyKey"
+
+	query := `SELECT entity_id FROM idempotency_keys WHERE key = ? AND expires_at > ?`
+
+	var entityID string
+	err := s.q.GetContext(ctx, &entityID, query, key, time.Now().UnixNano())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.ErrNotFound
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entityID, nil
+}
+
+func (s *Storage) SaveIdempotencyKey(ctx context.Context, key, entityID string, expiresAt time.Time) error {
+	const op = "storage.sqlite.SaveIdempotencyKey"
+
+	// Expired keys are dropped here rather than by a background job, which
+	// also frees key for reuse.
+	_, err := s.q.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: failed to delete expired keys: %w", op, err)
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (key, entity_id, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (key) DO NOTHING
+	`
+
+	result, err := s.q.ExecContext(ctx, query, key, entityID, expiresAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.ErrIdempotencyKeyExists
+	}
+
+	return nil
+}
+
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return s.inTx(ctx, func(tx *Storage) error {
+		return fn(tx)
+	})
+}
+
+func (s *Storage) inTx(ctx context.Context, fn func(tx *Storage) error) error {
+	const op = "storage.sqlite.WithTx"
+
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: failed to begin: %w", op, err)
+	}
+
+	if err := fn(&Storage{db: s.db, q: tx, tx: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: failed to commit: %w", op, err)
+	}
+
+	return nil
+}
+
+// Close releases the database. Storages handed to WithTx callbacks share the
+// connection pool with their parent, so closing them is a no-op.
+func (s *Storage) Close() error {
+	if s.tx != nil {
+		return nil
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,131 @@
+package sqlite_test
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/storage"
+	"comments-system/internal/storage/sqlite"
+	"comments-system/internal/storage/storagetest"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t testing.TB) storage.Storage {
+	t.Helper()
+
+	cfg := config.SQLite{Path: filepath.Join(t.TempDir(), "comments.db")}
+
+	m, err := migrate.New("file://../../../migrations/sqlite", "sqlite://"+cfg.Path)
+	require.NoError(t, err)
+	require.NoError(t, m.Up())
+	srcErr, dbErr := m.Close()
+	require.NoError(t, srcErr)
+	require.NoError(t, dbErr)
+
+	s, err := sqlite.NewSQLiteDB(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, newTestStorage)
+}
+
+func BenchmarkSQLiteStorage(b *testing.B) {
+	storagetest.Bench(b, newTestStorage)
+}
+
+func TestMigration_BackfillCommentPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comments.db")
+
+	m, err := migrate.New("file://../../../migrations/sqlite", "sqlite://"+path)
+	require.NoError(t, err)
+	defer m.Close()
+	require.NoError(t, m.Migrate(3))
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO posts (id, title, content, author) VALUES ('p', 'T', 'C', 'A');
+		INSERT INTO comments (id, post_id, parent_id, author, content) VALUES
+			('r', 'p', NULL, 'A', 'Root'),
+			('c', 'p', 'r', 'A', 'Child'),
+			('g', 'p', 'c', 'A', 'Grandchild');
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up())
+
+	rows, err := db.Query(`SELECT id, path, depth FROM comments ORDER BY path`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type row struct {
+		id, path string
+		depth    int
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.id, &r.path, &r.depth))
+		got = append(got, r)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []row{{"r", "r", 0}, {"c", "r.c", 1}, {"g", "r.c.g", 2}}, got)
+}
+
+func TestMigration_BackfillCommentCounts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "comments.db")
+
+	m, err := migrate.New("file://../../../migrations/sqlite", "sqlite://"+path)
+	require.NoError(t, err)
+	defer m.Close()
+	require.NoError(t, m.Migrate(7))
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO posts (id, title, content, author) VALUES ('p', 'T', 'C', 'A'), ('q', 'T', 'C', 'A');
+		INSERT INTO comments (id, post_id, parent_id, author, content, path, depth) VALUES
+			('r', 'p', NULL, 'A', 'Root', 'r', 0),
+			('c', 'p', 'r', 'A', 'Child', 'r.c', 1);
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up())
+
+	s, err := sqlite.NewSQLiteDB(config.SQLite{Path: path})
+	require.NoError(t, err)
+	defer s.Close()
+
+	post, err := s.GetPost(ctx, "p")
+	require.NoError(t, err)
+	require.Equal(t, 2, post.CommentCount)
+	require.Equal(t, 1, post.RootCommentCount)
+
+	// Counters drifted by hand are put right by a recount.
+	_, err = db.Exec(`UPDATE posts SET comment_count = 7, root_comment_count = 0 WHERE id = 'p'`)
+	require.NoError(t, err)
+
+	fixed, err := s.RecountComments(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, fixed)
+
+	post, err = s.GetPost(ctx, "p")
+	require.NoError(t, err)
+	require.Equal(t, 2, post.CommentCount)
+	require.Equal(t, 1, post.RootCommentCount)
+}
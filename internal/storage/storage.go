@@ -3,28 +3,100 @@ package storage
 import (
 	"comments-system/internal/models"
 	"context"
+	"time"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=PostStorage --output=./mocks --case=underscore
 type PostStorage interface {
+	// CreatePost stores post under a new ID, or under post.ID when it is
+	// set; it fails with errors.ErrAlreadyExists if that ID is taken.
 	CreatePost(ctx context.Context, post models.Post) (models.Post, error)
-	GetPosts(ctx context.Context, limit, offset int) ([]models.Post, error)
+	// GetPosts lists the posts matching filter, newest first.
+	GetPosts(ctx context.Context, filter models.PostFilter, limit, offset int) ([]models.Post, error)
 	GetPost(ctx context.Context, id string) (models.Post, error)
+	// UpdatePost is a compare-and-swap on post.Version: it fails with
+	// errors.ConflictError unless the stored version equals it, and bumps
+	// the stored version by one on success.
 	UpdatePost(ctx context.Context, post models.Post) error
+	// RecountComments recomputes the comment counters of every post from the
+	// comments themselves and returns how many posts had wrong counters.
+	RecountComments(ctx context.Context) (int, error)
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=CommentStorage --output=./mocks --case=underscore
 type CommentStorage interface {
 	CreateComment(ctx context.Context, comment models.Comment) (models.Comment, error)
-	GetCommentsByPost(ctx context.Context, postID string, limit, offset int) ([]models.Comment, error)
+	// GetCommentsByPost lists the comments of a post matching filter, newest
+	// first; CountCommentsByPost counts them.
+	GetCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter, limit, offset int) ([]models.Comment, error)
 	GetComment(ctx context.Context, id string) (models.Comment, error)
-	CountCommentsByPost(ctx context.Context, postID string) (int, error)
+	CountCommentsByPost(ctx context.Context, postID string, filter models.CommentFilter) (int, error)
 	GetCommentReplies(ctx context.Context, parentID string) ([]models.Comment, error)
+	GetCommentAncestors(ctx context.Context, id string) ([]string, error)
+	// GetCommentSubtree returns the descendants of comment id depth-first,
+	// down to maxDepth levels below it; maxDepth <= 0 means no limit.
+	GetCommentSubtree(ctx context.Context, id string, maxDepth int) ([]models.Comment, error)
+	// LockThread marks comment id as locked, closing its subtree to new replies.
+	LockThread(ctx context.Context, id string) error
+	// IsThreadLocked reports whether comment id or one of its ancestors is locked.
+	IsThreadLocked(ctx context.Context, id string) (bool, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=IdempotencyStorage --output=./mocks --case=underscore
+type IdempotencyStorage interface {
+	// GetIdempotencyKey returns the entity ID saved under key, or
+	// errors.ErrNotFound when the key is unknown or has expired.
+	GetIdempotencyKey(ctx context.Context, key string) (string, error)
+	// SaveIdempotencyKey remembers entityID under key until expiresAt. It
+	// fails with errors.ErrIdempotencyKeyExists while the key is still live.
+	SaveIdempotencyKey(ctx context.Context, key, entityID string, expiresAt time.Time) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=SearchStorage --output=./mocks --case=underscore
+type SearchStorage interface {
+	// Search returns posts and comments containing every term of the query,
+	// most relevant first, with ties broken by kind and ID.
+	Search(ctx context.Context, query models.SearchQuery) ([]models.SearchHit, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=ModerationStorage --output=./mocks --case=underscore
+type ModerationStorage interface {
+	// HideComment sets whether comment id is hidden from readers.
+	HideComment(ctx context.Context, id string, hidden bool) error
+	// DeleteComment removes comment id with all its replies and returns how
+	// many comments were removed.
+	DeleteComment(ctx context.Context, id string) (int, error)
+	// PurgeAuthor removes the posts and comments of author, along with
+	// everything posted under them.
+	PurgeAuthor(ctx context.Context, author string) (models.PurgeResult, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=ImportStorage --output=./mocks --case=underscore
+type ImportStorage interface {
+	// ImportPost stores post as it is, keeping its ID, creation time and
+	// version. The comment counters start at zero and follow the imported
+	// comments. It fails with errors.ErrAlreadyExists if the ID is taken.
+	ImportPost(ctx context.Context, post models.Post) error
+	// ImportComment stores comment as it is, keeping its ID, creation time
+	// and flags; the path and depth are derived again from its parent, which
+	// must have been imported before it. It fails with errors.ErrInvalidID
+	// if the ID cannot be part of a path, see ValidateCommentID.
+	ImportComment(ctx context.Context, comment models.Comment) error
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53.4 --name=Storage --output=./mocks --case=underscore
 type Storage interface {
 	PostStorage
 	CommentStorage
+	IdempotencyStorage
+	SearchStorage
+	ModerationStorage
+	ImportStorage
+	// WithTx runs fn against a storage bound to one transaction. It commits
+	// when fn returns nil and rolls back otherwise. Calling WithTx on the
+	// storage passed to fn joins the running transaction. A backend may roll
+	// back and run fn again when it conflicts with another transaction, so
+	// fn must be safe to run again.
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 	Close() error
 }
@@ -0,0 +1,452 @@
+package storagetest
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/seed"
+	"comments-system/internal/storage"
+	"comments-system/pkg/errors"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Size is a dataset the benchmarks run against.
+type Size struct {
+	Posts       int
+	MaxComments int
+}
+
+// Sizes grow tenfold from one to the next, so results show how each method
+// scales with the number of posts and with the comments of the busiest one.
+// The largest is skipped in -short mode.
+var Sizes = []Size{
+	{Posts: 10, MaxComments: 50},
+	{Posts: 100, MaxComments: 500},
+	{Posts: 1000, MaxComments: 5000},
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("posts=%d", s.Posts)
+}
+
+// Config returns the seed configuration of the dataset.
+func (s Size) Config() seed.Config {
+	cfg := seed.DefaultConfig()
+	cfg.Posts = s.Posts
+	cfg.MaxComments = s.MaxComments
+	return cfg
+}
+
+// Dataset describes a seeded storage: where its hot spots are and how to
+// make names no seeded entity uses.
+type Dataset struct {
+	Stats seed.Stats
+	// Posts are the IDs of all posts, oldest first.
+	Posts []string
+	// Busiest is the post with the most comments and Comments are their IDs,
+	// parents before replies.
+	Busiest  string
+	Comments []string
+	// MostReplied is the comment of Busiest with the most direct replies,
+	// Largest the one with the most descendants and Deepest the deepest one.
+	MostReplied string
+	Largest     string
+	Deepest     string
+	// Author is the most active comment author overall.
+	Author string
+
+	seq int
+}
+
+// Seed loads the dataset of cfg into s and surveys it.
+func Seed(tb testing.TB, s storage.Storage, cfg seed.Config) *Dataset {
+	tb.Helper()
+
+	stats, err := seed.Load(context.Background(), s, cfg)
+	if err != nil {
+		tb.Fatalf("seed storage: %v", err)
+	}
+
+	g, err := seed.NewGenerator(cfg)
+	if err != nil {
+		tb.Fatalf("seed generator: %v", err)
+	}
+
+	d := &Dataset{Stats: stats}
+	var busiest []models.Comment
+	authors := make(map[string]int)
+	for {
+		post, comments, ok := g.Next()
+		if !ok {
+			break
+		}
+		d.Posts = append(d.Posts, post.ID)
+		if d.Busiest == "" || len(comments) > len(busiest) {
+			d.Busiest, busiest = post.ID, comments
+		}
+		for _, c := range comments {
+			authors[c.Author]++
+		}
+	}
+	if len(busiest) == 0 {
+		tb.Fatalf("dataset %+v has no comments", cfg)
+	}
+	d.Author = top(authors, "")
+
+	parents := make(map[string]string)
+	replies := make(map[string]int)
+	descendants := make(map[string]int)
+	d.Deepest = busiest[0].ID
+	deepest := 0
+	for _, c := range busiest {
+		d.Comments = append(d.Comments, c.ID)
+		if c.Depth > deepest {
+			d.Deepest, deepest = c.ID, c.Depth
+		}
+		if c.ParentID == nil {
+			continue
+		}
+		parents[c.ID] = *c.ParentID
+		replies[*c.ParentID]++
+		for id, ok := *c.ParentID, true; ok; id, ok = parents[id] {
+			descendants[id]++
+		}
+	}
+	d.MostReplied = top(replies, busiest[0].ID)
+	d.Largest = top(descendants, busiest[0].ID)
+
+	return d
+}
+
+// top returns the key with the highest count, or fallback for an empty map.
+func top(counts map[string]int, fallback string) string {
+	best, n := fallback, 0
+	for k, c := range counts {
+		if c > n || c == n && k < best {
+			best, n = k, c
+		}
+	}
+	return best
+}
+
+// Next returns a number not returned before, for IDs, keys and authors that
+// must not collide with earlier iterations.
+func (d *Dataset) Next() int {
+	d.seq++
+	return d.seq
+}
+
+// EachSize runs fn as a sub-benchmark of b for each of Sizes.
+func EachSize(b *testing.B, fn func(b *testing.B, size Size)) {
+	for _, size := range Sizes {
+		b.Run(size.String(), func(b *testing.B) {
+			if testing.Short() && size.Posts > Sizes[1].Posts {
+				b.Skip("large dataset in short mode")
+			}
+			fn(b, size)
+		})
+	}
+}
+
+// Bench runs a benchmark of every storage method for each of Sizes. Reads
+// run first, against the dataset as seeded; writes follow and leave what
+// they add behind, then a mix of both from parallel goroutines.
+func Bench(b *testing.B, newStorage Factory) {
+	EachSize(b, func(b *testing.B, size Size) {
+		s := newStorage(b)
+		d := Seed(b, s, size.Config())
+
+		benchReads(b, s, d)
+		benchWrites(b, s, d)
+		benchParallel(b, s, d)
+	})
+}
+
+func benchReads(b *testing.B, s storage.Storage, d *Dataset) {
+	ctx := context.Background()
+	page := 20
+
+	run(b, "GetPosts", func(i int) error {
+		_, err := s.GetPosts(ctx, models.PostFilter{}, page, 0)
+		return err
+	})
+	run(b, "GetPosts/LastPage", func(i int) error {
+		_, err := s.GetPosts(ctx, models.PostFilter{}, page, max(len(d.Posts)-page, 0))
+		return err
+	})
+	run(b, "GetPosts/ByAuthor", func(i int) error {
+		_, err := s.GetPosts(ctx, models.PostFilter{Author: &d.Author}, page, 0)
+		return err
+	})
+	run(b, "GetPost", func(i int) error {
+		_, err := s.GetPost(ctx, d.Posts[i%len(d.Posts)])
+		return err
+	})
+
+	run(b, "GetCommentsByPost", func(i int) error {
+		_, err := s.GetCommentsByPost(ctx, d.Busiest, models.CommentFilter{}, page, 0)
+		return err
+	})
+	run(b, "GetCommentsByPost/LastPage", func(i int) error {
+		_, err := s.GetCommentsByPost(ctx, d.Busiest, models.CommentFilter{}, page, max(len(d.Comments)-page, 0))
+		return err
+	})
+	run(b, "GetCommentsByPost/ByAuthor", func(i int) error {
+		_, err := s.GetCommentsByPost(ctx, d.Busiest, models.CommentFilter{Author: &d.Author}, page, 0)
+		return err
+	})
+	run(b, "CountCommentsByPost", func(i int) error {
+		_, err := s.CountCommentsByPost(ctx, d.Busiest, models.CommentFilter{})
+		return err
+	})
+	run(b, "GetComment", func(i int) error {
+		_, err := s.GetComment(ctx, d.Comments[i%len(d.Comments)])
+		return err
+	})
+	run(b, "GetCommentReplies", func(i int) error {
+		_, err := s.GetCommentReplies(ctx, d.MostReplied)
+		return err
+	})
+	run(b, "GetCommentAncestors", func(i int) error {
+		_, err := s.GetCommentAncestors(ctx, d.Deepest)
+		return err
+	})
+	run(b, "GetCommentSubtree", func(i int) error {
+		_, err := s.GetCommentSubtree(ctx, d.Largest, 0)
+		return err
+	})
+	run(b, "IsThreadLocked", func(i int) error {
+		_, err := s.IsThreadLocked(ctx, d.Deepest)
+		return err
+	})
+
+	run(b, "Search", func(i int) error {
+		_, err := s.Search(ctx, models.SearchQuery{Query: "latency", Type: models.SearchTypeAll, Limit: page})
+		return err
+	})
+	run(b, "Search/Comments", func(i int) error {
+		_, err := s.Search(ctx, models.SearchQuery{Query: "comment thread", Type: models.SearchTypeComments, PostID: &d.Busiest, Limit: page})
+		return err
+	})
+
+	key := fmt.Sprintf("bench-get-%d", d.Next())
+	if err := s.SaveIdempotencyKey(ctx, key, d.Busiest, time.Now().Add(time.Hour)); err != nil {
+		b.Fatalf("save idempotency key: %v", err)
+	}
+	run(b, "GetIdempotencyKey", func(i int) error {
+		_, err := s.GetIdempotencyKey(ctx, key)
+		return err
+	})
+
+	run(b, "WithTx", func(i int) error {
+		return s.WithTx(ctx, func(tx storage.Storage) error {
+			_, err := tx.GetPost(ctx, d.Busiest)
+			return err
+		})
+	})
+}
+
+func benchWrites(b *testing.B, s storage.Storage, d *Dataset) {
+	ctx := context.Background()
+
+	run(b, "CreatePost", func(i int) error {
+		_, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "bench", CommentsEnabled: true})
+		return err
+	})
+	run(b, "CreateComment", func(i int) error {
+		_, err := s.CreateComment(ctx, models.Comment{PostID: d.Busiest, Author: "bench", Content: "Content"})
+		return err
+	})
+	run(b, "CreateComment/Reply", func(i int) error {
+		_, err := s.CreateComment(ctx, models.Comment{PostID: d.Busiest, ParentID: &d.Deepest, Author: "bench", Content: "Content"})
+		return err
+	})
+
+	b.Run("UpdatePost", func(b *testing.B) {
+		post, err := s.GetPost(ctx, d.Busiest)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := s.UpdatePost(ctx, post); err != nil {
+				b.Fatal(err)
+			}
+			post.Version++
+		}
+	})
+
+	run(b, "ImportPost", func(i int) error {
+		return s.ImportPost(ctx, models.Post{
+			ID: fmt.Sprintf("bench%08d", d.Next()), Title: "Title", Content: "Content", Author: "bench",
+			CommentsEnabled: true, CreatedAt: time.Now(), Version: 1,
+		})
+	})
+	run(b, "ImportComment", func(i int) error {
+		return s.ImportComment(ctx, models.Comment{
+			ID: fmt.Sprintf("bench%08d", d.Next()), PostID: d.Busiest, ParentID: &d.Largest,
+			Author: "bench", Content: "Content", CreatedAt: time.Now(),
+		})
+	})
+
+	run(b, "SaveIdempotencyKey", func(i int) error {
+		return s.SaveIdempotencyKey(ctx, fmt.Sprintf("bench-save-%d", d.Next()), d.Busiest, time.Now().Add(time.Hour))
+	})
+
+	run(b, "HideComment", func(i int) error {
+		return s.HideComment(ctx, d.Comments[i%len(d.Comments)], i%2 == 0)
+	})
+	for _, id := range d.Comments {
+		if err := s.HideComment(ctx, id, false); err != nil {
+			b.Fatalf("unhide comment: %v", err)
+		}
+	}
+
+	run(b, "LockThread", func(i int) error {
+		return s.LockThread(ctx, d.Comments[i%len(d.Comments)])
+	})
+
+	b.Run("DeleteComment", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			c, err := s.CreateComment(ctx, models.Comment{PostID: d.Busiest, Author: "bench", Content: "Content"})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			if _, err := s.DeleteComment(ctx, c.ID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("PurgeAuthor", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			author := fmt.Sprintf("bench-purge-%d", d.Next())
+			post, err := s.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: author, CommentsEnabled: true})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := s.CreateComment(ctx, models.Comment{PostID: d.Busiest, Author: author, Content: "Content"}); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "bench", Content: "Content"}); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			if _, err := s.PurgeAuthor(ctx, author); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// RecountComments walks every post and comment; it runs last so the
+	// counters it fixes are the ones the writes above kept.
+	run(b, "RecountComments", func(i int) error {
+		_, err := s.RecountComments(ctx)
+		return err
+	})
+}
+
+// benchParallel measures contention: the same operations from all of
+// GOMAXPROCS goroutines at once. Writers each comment on a post of their
+// own, never the busiest one, which the readers list, and write the way
+// CommentService.CreateComment does.
+func benchParallel(b *testing.B, s storage.Storage, d *Dataset) {
+	ctx := context.Background()
+	page := 20
+
+	var workers, keys atomic.Int64
+	// others hands each goroutine of a benchmark a post other than Busiest.
+	others := func() string {
+		for {
+			id := d.Posts[int(workers.Add(1))%len(d.Posts)]
+			if id != d.Busiest || len(d.Posts) == 1 {
+				return id
+			}
+		}
+	}
+
+	runParallel(b, "Parallel/GetCommentsByPost", func() func(i int) error {
+		return func(i int) error {
+			_, err := s.GetCommentsByPost(ctx, d.Busiest, models.CommentFilter{}, page, 0)
+			return err
+		}
+	})
+	runParallel(b, "Parallel/CreateComment", func() func(i int) error {
+		postID := others()
+		return func(i int) error {
+			return commentInTx(ctx, s, postID, fmt.Sprintf("bench-parallel-%d", keys.Add(1)))
+		}
+	})
+	// Mixed is nine reads of the busiest post to one write elsewhere.
+	runParallel(b, "Parallel/Mixed", func() func(i int) error {
+		postID := others()
+		return func(i int) error {
+			if i%10 == 9 {
+				return commentInTx(ctx, s, postID, fmt.Sprintf("bench-parallel-%d", keys.Add(1)))
+			}
+			_, err := s.GetCommentsByPost(ctx, d.Busiest, models.CommentFilter{}, page, 0)
+			return err
+		}
+	})
+}
+
+// commentInTx comments on post postID in one transaction that looks up
+// the idempotency key, reads the post, creates the comment and saves the key,
+// as CommentService.CreateComment does.
+func commentInTx(ctx context.Context, s storage.Storage, postID, key string) error {
+	return s.WithTx(ctx, func(tx storage.Storage) error {
+		_, err := tx.GetIdempotencyKey(ctx, key)
+		if err == nil {
+			return fmt.Errorf("idempotency key %s already used", key)
+		}
+		if !errors.Is(err, errors.ErrNotFound) {
+			return err
+		}
+
+		if _, err := tx.GetPost(ctx, postID); err != nil {
+			return err
+		}
+		comment, err := tx.CreateComment(ctx, models.Comment{PostID: postID, Author: "bench", Content: "Content"})
+		if err != nil {
+			return err
+		}
+		return tx.SaveIdempotencyKey(ctx, key, comment.ID, time.Now().Add(time.Hour))
+	})
+}
+
+// run benchmarks op as a sub-benchmark of b, failing on the first error.
+func run(b *testing.B, name string, op func(i int) error) {
+	b.Run(name, func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := op(i); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// runParallel benchmarks an operation from many goroutines as a
+// sub-benchmark of b. newOp is called once per goroutine for its operation.
+func runParallel(b *testing.B, name string, newOp func() func(i int) error) {
+	b.Run(name, func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			op := newOp()
+			for i := 0; pb.Next(); i++ {
+				if err := op(i); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
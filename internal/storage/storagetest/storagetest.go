@@ -0,0 +1,1585 @@
+// Package storagetest is a conformance suite for storage.Storage
+// implementations. Every backend runs the same scenarios so behavior that
+// callers rely on (ordering, error values, empty results) stays identical.
+package storagetest
+
+import (
+	"comments-system/internal/models"
+	"comments-system/internal/storage"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty storage for a single test or benchmark. It is
+// responsible for releasing the storage, typically with t.Cleanup.
+type Factory func(t testing.TB) storage.Storage
+
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("Posts", func(t *testing.T) { testPosts(t, newStorage) })
+	t.Run("Comments", func(t *testing.T) { testComments(t, newStorage) })
+	t.Run("Comment Counters", func(t *testing.T) { testCommentCounters(t, newStorage) })
+	t.Run("Replies", func(t *testing.T) { testReplies(t, newStorage) })
+	t.Run("Ancestors", func(t *testing.T) { testAncestors(t, newStorage) })
+	t.Run("Subtree", func(t *testing.T) { testSubtree(t, newStorage) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, newStorage) })
+	t.Run("Moderation", func(t *testing.T) { testModeration(t, newStorage) })
+	t.Run("Import", func(t *testing.T) { testImport(t, newStorage) })
+	t.Run("Sites", func(t *testing.T) { testSites(t, newStorage) })
+	t.Run("Idempotency Keys", func(t *testing.T) { testIdempotencyKeys(t, newStorage) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, newStorage) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newStorage) })
+}
+
+func testPosts(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Create and Get Post", func(t *testing.T) {
+		s := newStorage(t)
+
+		created, err := s.CreatePost(ctx, models.Post{
+			Title:           "Test Post",
+			Content:         "Content",
+			Author:          "Author",
+			CommentsEnabled: true,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, created.ID)
+		require.False(t, created.CreatedAt.IsZero())
+
+		got, err := s.GetPost(ctx, created.ID)
+		require.NoError(t, err)
+		requirePostEqual(t, created, got)
+	})
+
+	t.Run("Create Post keeps given ID", func(t *testing.T) {
+		s := newStorage(t)
+
+		created, err := s.CreatePost(ctx, models.Post{ID: "post1", Title: "Title", Content: "Content", Author: "Author"})
+		require.NoError(t, err)
+		require.Equal(t, "post1", created.ID)
+
+		_, err = s.GetPost(ctx, "post1")
+		require.NoError(t, err)
+	})
+
+	t.Run("Create Post with taken ID", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		createComment(t, s, post.ID, nil)
+
+		_, err := s.CreatePost(ctx, models.Post{ID: post.ID, Title: "Duplicate", Content: "Content", Author: "Author"})
+		require.ErrorIs(t, err, errors.ErrAlreadyExists)
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		post.CommentCount, post.RootCommentCount = 1, 1
+		requirePostEqual(t, post, got)
+	})
+
+	t.Run("Get Post Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.GetPost(ctx, "nonexistent")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Update Post", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+
+		post.Title = "Updated Title"
+		post.Content = "Updated Content"
+		post.CommentsEnabled = false
+		require.NoError(t, s.UpdatePost(ctx, post))
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Updated Title", got.Title)
+		require.Equal(t, "Updated Content", got.Content)
+		require.False(t, got.CommentsEnabled)
+		require.True(t, post.CreatedAt.Equal(got.CreatedAt))
+		require.Equal(t, post.Version+1, got.Version)
+	})
+
+	t.Run("Update Post with stale version", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		require.Equal(t, 1, post.Version)
+
+		first := post
+		first.Title = "First editor"
+		require.NoError(t, s.UpdatePost(ctx, first))
+
+		second := post
+		second.Title = "Second editor"
+		err := s.UpdatePost(ctx, second)
+		require.ErrorIs(t, err, errors.ErrConflict)
+
+		var conflict *errors.ConflictError
+		require.True(t, errors.As(err, &conflict))
+		require.Equal(t, 2, conflict.CurrentVersion)
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, "First editor", got.Title)
+	})
+
+	t.Run("Update Post Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		err := s.UpdatePost(ctx, models.Post{ID: "nonexistent"})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Get Posts newest first with pagination", func(t *testing.T) {
+		s := newStorage(t)
+
+		var ids []string
+		for i := 0; i < 5; i++ {
+			ids = append(ids, createPost(t, s, true).ID)
+		}
+
+		page, err := s.GetPosts(ctx, models.PostFilter{}, 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{ids[4], ids[3]}, postIDs(page))
+
+		page, err = s.GetPosts(ctx, models.PostFilter{}, 2, 2)
+		require.NoError(t, err)
+		require.Equal(t, []string{ids[2], ids[1]}, postIDs(page))
+
+		page, err = s.GetPosts(ctx, models.PostFilter{}, 2, 4)
+		require.NoError(t, err)
+		require.Equal(t, []string{ids[0]}, postIDs(page))
+	})
+
+	t.Run("Get Posts past the end", func(t *testing.T) {
+		s := newStorage(t)
+		createPost(t, s, true)
+
+		page, err := s.GetPosts(ctx, models.PostFilter{}, 10, 5)
+		require.NoError(t, err)
+		require.Empty(t, page)
+	})
+
+	t.Run("Get Posts empty storage", func(t *testing.T) {
+		s := newStorage(t)
+
+		page, err := s.GetPosts(ctx, models.PostFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Empty(t, page)
+	})
+
+	t.Run("Get Posts filtered", func(t *testing.T) {
+		s := newStorage(t)
+
+		older, err := s.CreatePost(ctx, models.Post{Title: "T", Content: "C", Author: "alice", CommentsEnabled: true})
+		require.NoError(t, err)
+		createComment(t, s, older.ID, nil)
+		time.Sleep(10 * time.Millisecond)
+		mid := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		newer, err := s.CreatePost(ctx, models.Post{Title: "T", Content: "C", Author: "bob", CommentsEnabled: false})
+		require.NoError(t, err)
+
+		alice, yes, no := "alice", true, false
+		cases := []struct {
+			name   string
+			filter models.PostFilter
+			want   []string
+		}{
+			{"none", models.PostFilter{}, []string{newer.ID, older.ID}},
+			{"author", models.PostFilter{Author: &alice}, []string{older.ID}},
+			{"created after", models.PostFilter{CreatedAfter: &mid}, []string{newer.ID}},
+			{"created before", models.PostFilter{CreatedBefore: &mid}, []string{older.ID}},
+			{"comments enabled", models.PostFilter{CommentsEnabled: &no}, []string{newer.ID}},
+			{"has comments", models.PostFilter{HasComments: &yes}, []string{older.ID}},
+			{"has no comments", models.PostFilter{HasComments: &no}, []string{newer.ID}},
+			{"combined", models.PostFilter{Author: &alice, CreatedAfter: &mid}, []string{}},
+		}
+		for _, tc := range cases {
+			page, err := s.GetPosts(ctx, tc.filter, 10, 0)
+			require.NoError(t, err, tc.name)
+			require.Equal(t, tc.want, postIDs(page), tc.name)
+		}
+	})
+}
+
+func testComments(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Create and Get Comment", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+
+		created, err := s.CreateComment(ctx, models.Comment{
+			PostID:  post.ID,
+			Author:  "Commenter",
+			Content: "Comment",
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, created.ID)
+		require.Nil(t, created.ParentID)
+
+		got, err := s.GetComment(ctx, created.ID)
+		require.NoError(t, err)
+		requireCommentEqual(t, created, got)
+	})
+
+	t.Run("Get Comment Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.GetComment(ctx, "nonexistent")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Create Comment on missing Post", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.CreateComment(ctx, models.Comment{PostID: "nonexistent", Author: "A", Content: "C"})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Create Comment with Nonexistent Parent", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+
+		parentID := "nonexistent"
+		_, err := s.CreateComment(ctx, models.Comment{
+			PostID:   post.ID,
+			ParentID: &parentID,
+			Author:   "Child",
+			Content:  "Child comment",
+		})
+		require.ErrorIs(t, err, errors.ErrParentNotFound)
+	})
+
+	t.Run("Create Comment with Parent from another Post", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		other := createPost(t, s, true)
+		parent := createComment(t, s, other.ID, nil)
+
+		_, err := s.CreateComment(ctx, models.Comment{
+			PostID:   post.ID,
+			ParentID: &parent.ID,
+			Author:   "Child",
+			Content:  "Child comment",
+		})
+		require.ErrorIs(t, err, errors.ErrParentNotFound)
+	})
+
+	t.Run("Get Comments By Post returns roots newest first", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			root := createComment(t, s, post.ID, nil)
+			ids = append(ids, root.ID)
+			createComment(t, s, post.ID, &root.ID)
+		}
+
+		page, err := s.GetCommentsByPost(ctx, post.ID, models.CommentFilter{}, 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{ids[2], ids[1]}, commentIDs(page))
+
+		page, err = s.GetCommentsByPost(ctx, post.ID, models.CommentFilter{}, 2, 2)
+		require.NoError(t, err)
+		require.Equal(t, []string{ids[0]}, commentIDs(page))
+	})
+
+	t.Run("Get Comments By Post isolates posts", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		other := createPost(t, s, true)
+		createComment(t, s, other.ID, nil)
+
+		page, err := s.GetCommentsByPost(ctx, post.ID, models.CommentFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Empty(t, page)
+	})
+
+	t.Run("Get Comments By missing Post", func(t *testing.T) {
+		s := newStorage(t)
+
+		page, err := s.GetCommentsByPost(ctx, "nonexistent", models.CommentFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Empty(t, page)
+	})
+
+	t.Run("Count Comments By Post counts roots only", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+
+		for i := 0; i < 3; i++ {
+			root := createComment(t, s, post.ID, nil)
+			createComment(t, s, post.ID, &root.ID)
+		}
+
+		count, err := s.CountCommentsByPost(ctx, post.ID, models.CommentFilter{})
+		require.NoError(t, err)
+		require.Equal(t, 3, count)
+
+		count, err = s.CountCommentsByPost(ctx, "nonexistent", models.CommentFilter{})
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+
+	t.Run("Get Comments By Post filtered", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+
+		root, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "alice", Content: "Root"})
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		mid := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		other := createComment(t, s, post.ID, nil)
+		reply, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &root.ID, Author: "alice", Content: "Reply"})
+		require.NoError(t, err)
+
+		alice, yes, no := "alice", true, false
+		cases := []struct {
+			name   string
+			filter models.CommentFilter
+			want   []string
+		}{
+			{"none", models.CommentFilter{}, []string{other.ID, root.ID}},
+			{"roots", models.CommentFilter{HasParent: &no}, []string{other.ID, root.ID}},
+			{"replies", models.CommentFilter{HasParent: &yes}, []string{reply.ID}},
+			{"author", models.CommentFilter{Author: &alice}, []string{root.ID}},
+			{"replies by author", models.CommentFilter{Author: &alice, HasParent: &yes}, []string{reply.ID}},
+			{"created after", models.CommentFilter{CreatedAfter: &mid}, []string{other.ID}},
+			{"created before", models.CommentFilter{CreatedBefore: &mid}, []string{root.ID}},
+		}
+		for _, tc := range cases {
+			page, err := s.GetCommentsByPost(ctx, post.ID, tc.filter, 10, 0)
+			require.NoError(t, err, tc.name)
+			require.Equal(t, tc.want, commentIDs(page), tc.name)
+
+			count, err := s.CountCommentsByPost(ctx, post.ID, tc.filter)
+			require.NoError(t, err, tc.name)
+			require.Equal(t, len(tc.want), count, tc.name)
+		}
+	})
+}
+
+func testCommentCounters(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("New Post has no comments", func(t *testing.T) {
+		s := newStorage(t)
+
+		created, err := s.CreatePost(ctx, models.Post{Title: "T", Content: "C", Author: "A", CommentCount: 5, RootCommentCount: 5})
+		require.NoError(t, err)
+		require.Zero(t, created.CommentCount)
+		require.Zero(t, created.RootCommentCount)
+
+		got, err := s.GetPost(ctx, created.ID)
+		require.NoError(t, err)
+		require.Zero(t, got.CommentCount)
+		require.Zero(t, got.RootCommentCount)
+	})
+
+	t.Run("Creating comments updates counters", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		other := createPost(t, s, true)
+
+		for i := 0; i < 2; i++ {
+			root := createComment(t, s, post.ID, nil)
+			reply := createComment(t, s, post.ID, &root.ID)
+			createComment(t, s, post.ID, &reply.ID)
+		}
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 6, got.CommentCount)
+		require.Equal(t, 2, got.RootCommentCount)
+		require.Equal(t, post.Version, got.Version)
+
+		got, err = s.GetPost(ctx, other.ID)
+		require.NoError(t, err)
+		require.Zero(t, got.CommentCount)
+	})
+
+	t.Run("Update Post keeps counters", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		createComment(t, s, post.ID, nil)
+
+		post.Title = "Updated"
+		require.NoError(t, s.UpdatePost(ctx, post))
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 1, got.CommentCount)
+		require.Equal(t, 1, got.RootCommentCount)
+	})
+
+	t.Run("Recount leaves correct counters alone", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		createComment(t, s, post.ID, &root.ID)
+		createPost(t, s, true)
+
+		fixed, err := s.RecountComments(ctx)
+		require.NoError(t, err)
+		require.Zero(t, fixed)
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, got.CommentCount)
+		require.Equal(t, 1, got.RootCommentCount)
+	})
+}
+
+func testReplies(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Get Comment Replies oldest first", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		parent := createComment(t, s, post.ID, nil)
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			reply := createComment(t, s, post.ID, &parent.ID)
+			ids = append(ids, reply.ID)
+			createComment(t, s, post.ID, &reply.ID)
+		}
+
+		replies, err := s.GetCommentReplies(ctx, parent.ID)
+		require.NoError(t, err)
+		require.Equal(t, ids, commentIDs(replies))
+		for _, reply := range replies {
+			require.NotNil(t, reply.ParentID)
+			require.Equal(t, parent.ID, *reply.ParentID)
+		}
+	})
+
+	t.Run("Get Comment Replies without replies", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		parent := createComment(t, s, post.ID, nil)
+
+		replies, err := s.GetCommentReplies(ctx, parent.ID)
+		require.NoError(t, err)
+		require.Empty(t, replies)
+	})
+
+	t.Run("Get Comment Replies of missing Comment", func(t *testing.T) {
+		s := newStorage(t)
+
+		replies, err := s.GetCommentReplies(ctx, "nonexistent")
+		require.NoError(t, err)
+		require.Empty(t, replies)
+	})
+}
+
+func testAncestors(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Get Comment Ancestors root first", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		child := createComment(t, s, post.ID, &root.ID)
+		grandchild := createComment(t, s, post.ID, &child.ID)
+
+		ancestors, err := s.GetCommentAncestors(ctx, grandchild.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{root.ID, child.ID}, ancestors)
+
+		ancestors, err = s.GetCommentAncestors(ctx, root.ID)
+		require.NoError(t, err)
+		require.Empty(t, ancestors)
+	})
+
+	t.Run("Get Comment Ancestors Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.GetCommentAncestors(ctx, "nonexistent")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+}
+
+func testSubtree(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Path and Depth", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		child := createComment(t, s, post.ID, &root.ID)
+
+		require.Equal(t, root.ID, root.Path)
+		require.Equal(t, 0, root.Depth)
+		require.Equal(t, root.ID+storage.PathSeparator+child.ID, child.Path)
+		require.Equal(t, 1, child.Depth)
+
+		got, err := s.GetComment(ctx, child.ID)
+		require.NoError(t, err)
+		require.Equal(t, child.Path, got.Path)
+		require.Equal(t, child.Depth, got.Depth)
+	})
+
+	t.Run("Whole Subtree depth-first", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		a := createComment(t, s, post.ID, &root.ID)
+		b := createComment(t, s, post.ID, &root.ID)
+		a1 := createComment(t, s, post.ID, &a.ID)
+		a1x := createComment(t, s, post.ID, &a1.ID)
+		other := createComment(t, s, post.ID, nil)
+		createComment(t, s, post.ID, &other.ID)
+
+		subtree, err := s.GetCommentSubtree(ctx, root.ID, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{a.ID, a1.ID, a1x.ID, b.ID}, commentIDs(subtree))
+
+		subtree, err = s.GetCommentSubtree(ctx, a.ID, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{a1.ID, a1x.ID}, commentIDs(subtree))
+	})
+
+	t.Run("Depth-limited Subtree", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		a := createComment(t, s, post.ID, &root.ID)
+		a1 := createComment(t, s, post.ID, &a.ID)
+		createComment(t, s, post.ID, &a1.ID)
+
+		subtree, err := s.GetCommentSubtree(ctx, root.ID, 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{a.ID}, commentIDs(subtree))
+
+		subtree, err = s.GetCommentSubtree(ctx, a.ID, 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{a1.ID}, commentIDs(subtree))
+	})
+
+	t.Run("Leaf Has Empty Subtree", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+
+		subtree, err := s.GetCommentSubtree(ctx, root.ID, 0)
+		require.NoError(t, err)
+		require.Empty(t, subtree)
+	})
+
+	t.Run("Lock Thread", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		a := createComment(t, s, post.ID, &root.ID)
+		a1 := createComment(t, s, post.ID, &a.ID)
+		b := createComment(t, s, post.ID, &root.ID)
+
+		require.NoError(t, s.LockThread(ctx, a.ID))
+
+		got, err := s.GetComment(ctx, a.ID)
+		require.NoError(t, err)
+		require.True(t, got.Locked)
+
+		for id, want := range map[string]bool{root.ID: false, a.ID: true, a1.ID: true, b.ID: false} {
+			locked, err := s.IsThreadLocked(ctx, id)
+			require.NoError(t, err)
+			require.Equal(t, want, locked, "comment %s", id)
+		}
+	})
+
+	t.Run("Lock Thread Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		require.ErrorIs(t, s.LockThread(ctx, "nonexistent"), errors.ErrNotFound)
+
+		_, err := s.IsThreadLocked(ctx, "nonexistent")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Subtree Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.GetCommentSubtree(ctx, "nonexistent", 0)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+}
+
+// searchFixture creates two posts with one comment each. "golang" appears in
+// both posts and in the first comment; "generics" only around the first post.
+func searchFixture(t *testing.T, s storage.Storage) (p1, p2 models.Post, c1, c2 models.Comment) {
+	t.Helper()
+	ctx := context.Background()
+
+	var err error
+	p1, err = s.CreatePost(ctx, models.Post{Title: "Golang generics", Content: "A deep dive into type parameters", Author: "A", CommentsEnabled: true})
+	require.NoError(t, err)
+	p2, err = s.CreatePost(ctx, models.Post{Title: "Rust ownership", Content: "Borrowing explained with golang comparisons", Author: "A", CommentsEnabled: true})
+	require.NoError(t, err)
+	c1, err = s.CreateComment(ctx, models.Comment{PostID: p1.ID, Author: "B", Content: "generics make golang code reusable"})
+	require.NoError(t, err)
+	c2, err = s.CreateComment(ctx, models.Comment{PostID: p2.ID, Author: "B", Content: "ownership rules are strict"})
+	require.NoError(t, err)
+
+	return p1, p2, c1, c2
+}
+
+func hitIDs(hits []models.SearchHit) []string {
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		if hit.Post != nil {
+			ids = append(ids, hit.Post.ID)
+		} else {
+			ids = append(ids, hit.Comment.ID)
+		}
+	}
+	return ids
+}
+
+func testSearch(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Type Filter", func(t *testing.T) {
+		s := newStorage(t)
+		p1, p2, c1, _ := searchFixture(t, s)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{p1.ID, p2.ID, c1.ID}, hitIDs(hits))
+
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypePosts, Limit: 10})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{p1.ID, p2.ID}, hitIDs(hits))
+
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypeComments, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{c1.ID}, hitIDs(hits))
+		require.Equal(t, p1.ID, hits[0].Comment.PostID)
+	})
+
+	t.Run("Every Term Must Match", func(t *testing.T) {
+		s := newStorage(t)
+		p1, _, c1, _ := searchFixture(t, s)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "golang generics", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{p1.ID, c1.ID}, hitIDs(hits))
+
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "nonexistentterm", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, hits)
+	})
+
+	t.Run("Post Filter", func(t *testing.T) {
+		s := newStorage(t)
+		_, p2, _, c2 := searchFixture(t, s)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "ownership", Type: models.SearchTypeAll, PostID: &p2.ID, Limit: 10})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{p2.ID, c2.ID}, hitIDs(hits))
+
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypeComments, PostID: &p2.ID, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, hits)
+	})
+
+	t.Run("Ranking and Snippets", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		weak, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A",
+			Content: "a long story about many things where kubernetes shows up only once near the end of it"})
+		require.NoError(t, err)
+		strong, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A", Content: "kubernetes kubernetes kubernetes"})
+		require.NoError(t, err)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "kubernetes", Type: models.SearchTypeComments, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{strong.ID, weak.ID}, hitIDs(hits))
+		require.Greater(t, hits[0].Score, hits[1].Score)
+		for _, hit := range hits {
+			require.Contains(t, hit.Snippet, "<mark>kubernetes</mark>")
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		s := newStorage(t)
+		searchFixture(t, s)
+
+		all, err := s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+
+		first, err := s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypeAll, Limit: 2})
+		require.NoError(t, err)
+		second, err := s.Search(ctx, models.SearchQuery{Query: "golang", Type: models.SearchTypeAll, Limit: 2, Offset: 2})
+		require.NoError(t, err)
+		require.Equal(t, hitIDs(all), append(hitIDs(first), hitIDs(second)...))
+	})
+
+	t.Run("Updated Post Is Reindexed", func(t *testing.T) {
+		s := newStorage(t)
+		_, p2, _, _ := searchFixture(t, s)
+
+		p2.Title = "Zig ownership"
+		require.NoError(t, s.UpdatePost(ctx, p2))
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "rust", Type: models.SearchTypePosts, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, hits)
+
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "zig", Type: models.SearchTypePosts, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{p2.ID}, hitIDs(hits))
+	})
+
+	t.Run("Rolled Back Post Is Not Indexed", func(t *testing.T) {
+		s := newStorage(t)
+
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			if _, err := tx.CreatePost(ctx, models.Post{Title: "Ephemeral", Content: "Content", Author: "A"}); err != nil {
+				return err
+			}
+			return fmt.Errorf("abort")
+		})
+		require.Error(t, err)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "ephemeral", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, hits)
+	})
+}
+
+func testModeration(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	errAbort := fmt.Errorf("abort")
+
+	t.Run("Hide Comment", func(t *testing.T) {
+		s := newStorage(t)
+		_, _, c1, _ := searchFixture(t, s)
+
+		require.NoError(t, s.HideComment(ctx, c1.ID, true))
+
+		got, err := s.GetComment(ctx, c1.ID)
+		require.NoError(t, err)
+		require.True(t, got.Hidden)
+		require.Equal(t, c1.Content, got.Content)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "reusable", Type: models.SearchTypeComments, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, hits)
+
+		require.NoError(t, s.HideComment(ctx, c1.ID, false))
+
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "reusable", Type: models.SearchTypeComments, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{c1.ID}, hitIDs(hits))
+	})
+
+	t.Run("Hide Comment Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		require.ErrorIs(t, s.HideComment(ctx, "nonexistent", true), errors.ErrNotFound)
+	})
+
+	t.Run("Delete Comment removes its thread", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		a := createComment(t, s, post.ID, &root.ID)
+		a1 := createComment(t, s, post.ID, &a.ID)
+		b := createComment(t, s, post.ID, &root.ID)
+		other := createComment(t, s, post.ID, nil)
+
+		deleted, err := s.DeleteComment(ctx, a.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, deleted)
+
+		for _, id := range []string{a.ID, a1.ID} {
+			_, err := s.GetComment(ctx, id)
+			require.ErrorIs(t, err, errors.ErrNotFound)
+		}
+		replies, err := s.GetCommentReplies(ctx, root.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{b.ID}, commentIDs(replies))
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 3, got.CommentCount)
+		require.Equal(t, 2, got.RootCommentCount)
+
+		deleted, err = s.DeleteComment(ctx, root.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, deleted)
+
+		roots, err := s.GetCommentsByPost(ctx, post.ID, models.CommentFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{other.ID}, commentIDs(roots))
+
+		got, err = s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 1, got.CommentCount)
+		require.Equal(t, 1, got.RootCommentCount)
+	})
+
+	t.Run("Delete Comment Not Found", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.DeleteComment(ctx, "nonexistent")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Deleted Comment Is Not Found By Search", func(t *testing.T) {
+		s := newStorage(t)
+		_, _, c1, _ := searchFixture(t, s)
+
+		_, err := s.DeleteComment(ctx, c1.ID)
+		require.NoError(t, err)
+
+		hits, err := s.Search(ctx, models.SearchQuery{Query: "reusable", Type: models.SearchTypeComments, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, hits)
+	})
+
+	t.Run("Purge Author", func(t *testing.T) {
+		s := newStorage(t)
+		spam, err := s.CreatePost(ctx, models.Post{Title: "Spam", Content: "Spam", Author: "spammer", CommentsEnabled: true})
+		require.NoError(t, err)
+		createComment(t, s, spam.ID, nil)
+
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		bad, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &root.ID, Author: "spammer", Content: "Spam"})
+		require.NoError(t, err)
+		createComment(t, s, post.ID, &bad.ID)
+		_, err = s.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &bad.ID, Author: "spammer", Content: "Spam"})
+		require.NoError(t, err)
+
+		purged, err := s.PurgeAuthor(ctx, "spammer")
+		require.NoError(t, err)
+		require.Equal(t, models.PurgeResult{Posts: 1, Comments: 4}, purged)
+
+		_, err = s.GetPost(ctx, spam.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		posts, err := s.GetPosts(ctx, models.PostFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{post.ID}, postIDs(posts))
+		require.Equal(t, 1, posts[0].CommentCount)
+
+		replies, err := s.GetCommentReplies(ctx, root.ID)
+		require.NoError(t, err)
+		require.Empty(t, replies)
+
+		purged, err = s.PurgeAuthor(ctx, "spammer")
+		require.NoError(t, err)
+		require.Equal(t, models.PurgeResult{}, purged)
+	})
+
+	t.Run("Rolled Back Delete Restores the Thread", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+		reply := createComment(t, s, post.ID, &root.ID)
+
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			if _, err := tx.PurgeAuthor(ctx, "Author"); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		require.ErrorIs(t, err, errAbort)
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, got.CommentCount)
+		require.Equal(t, 1, got.RootCommentCount)
+
+		replies, err := s.GetCommentReplies(ctx, root.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{reply.ID}, commentIDs(replies))
+	})
+}
+
+func testImport(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	// Every backend keeps microseconds.
+	created := time.Date(2021, 3, 4, 5, 6, 7, 891011000, time.UTC)
+
+	t.Run("Import keeps IDs, timestamps and flags", func(t *testing.T) {
+		s := newStorage(t)
+		post := models.Post{
+			ID: "imported-post", Title: "Imported", Content: "Imported content", Author: "Author",
+			CommentsEnabled: false, CreatedAt: created, Version: 7, CommentCount: 99,
+		}
+		require.NoError(t, s.ImportPost(ctx, post))
+
+		root := models.Comment{
+			ID: "imported-root", PostID: post.ID, Author: "Commenter", Content: "Root",
+			CreatedAt: created.Add(time.Minute), Locked: true,
+		}
+		require.NoError(t, s.ImportComment(ctx, root))
+		reply := models.Comment{
+			ID: "imported-reply", PostID: post.ID, ParentID: &root.ID, Author: "Commenter", Content: "Reply",
+			CreatedAt: created.Add(2 * time.Minute), Hidden: true,
+		}
+		require.NoError(t, s.ImportComment(ctx, reply))
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		// Posts imported without a site go to the default site.
+		post.SiteID = tenant.DefaultSite
+		post.CommentCount, post.RootCommentCount = 2, 1
+		requirePostEqual(t, post, got)
+
+		gotRoot, err := s.GetComment(ctx, root.ID)
+		require.NoError(t, err)
+		root.SiteID, root.Path, root.Depth = tenant.DefaultSite, root.ID, 0
+		requireCommentEqual(t, root, gotRoot)
+
+		gotReply, err := s.GetComment(ctx, reply.ID)
+		require.NoError(t, err)
+		reply.SiteID, reply.Path, reply.Depth = tenant.DefaultSite, root.ID+storage.PathSeparator+reply.ID, 1
+		requireCommentEqual(t, reply, gotReply)
+
+		subtree, err := s.GetCommentSubtree(ctx, root.ID, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{reply.ID}, commentIDs(subtree))
+	})
+
+	t.Run("Import refuses IDs unfit for a path", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+
+		for _, id := range []string{"", "a" + storage.PathSeparator + "b"} {
+			err := s.ImportComment(ctx, models.Comment{ID: id, PostID: post.ID, ParentID: &root.ID, Content: "Bad", CreatedAt: created})
+			require.ErrorIs(t, err, errors.ErrInvalidID, "ID %q", id)
+		}
+
+		replies, err := s.GetCommentReplies(ctx, root.ID)
+		require.NoError(t, err)
+		require.Empty(t, replies)
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.Equal(t, 1, got.CommentCount)
+	})
+
+	t.Run("Import duplicate IDs", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		comment := createComment(t, s, post.ID, nil)
+
+		err := s.ImportPost(ctx, models.Post{ID: post.ID, Title: "Duplicate", CreatedAt: created})
+		require.ErrorIs(t, err, errors.ErrAlreadyExists)
+
+		err = s.ImportComment(ctx, models.Comment{ID: comment.ID, PostID: post.ID, Content: "Duplicate", CreatedAt: created})
+		require.ErrorIs(t, err, errors.ErrAlreadyExists)
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		post.CommentCount, post.RootCommentCount = 1, 1
+		requirePostEqual(t, post, got)
+	})
+
+	t.Run("Import Comment before its parent", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		parentID := "not-imported-yet"
+
+		err := s.ImportComment(ctx, models.Comment{ID: "orphan", PostID: post.ID, ParentID: &parentID, CreatedAt: created})
+		require.ErrorIs(t, err, errors.ErrParentNotFound)
+
+		err = s.ImportComment(ctx, models.Comment{ID: "homeless", PostID: "nonexistent", CreatedAt: created})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Imported out of order lists by creation time", func(t *testing.T) {
+		s := newStorage(t)
+		at := func(minutes int) time.Time { return created.Add(time.Duration(minutes) * time.Minute) }
+
+		for _, p := range []struct {
+			id      string
+			minutes int
+		}{{"post-b", 2}, {"post-c", 3}, {"post-a", 1}} {
+			require.NoError(t, s.ImportPost(ctx, models.Post{ID: p.id, Title: "T", Content: "C", Author: "A", CreatedAt: at(p.minutes)}))
+		}
+		posts, err := s.GetPosts(ctx, models.PostFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"post-c", "post-b", "post-a"}, postIDs(posts))
+
+		postID := "post-a"
+		roots := []string{"root-b", "root-d", "root-a", "root-c"}
+		for _, id := range roots {
+			minutes := map[string]int{"root-a": 10, "root-b": 20, "root-c": 30, "root-d": 40}[id]
+			require.NoError(t, s.ImportComment(ctx, models.Comment{ID: id, PostID: postID, Author: "A", Content: "Root", CreatedAt: at(minutes)}))
+		}
+		parentID := "root-a"
+		for _, r := range []struct {
+			id      string
+			minutes int
+		}{{"reply-b", 50}, {"reply-a", 45}, {"reply-c", 55}} {
+			require.NoError(t, s.ImportComment(ctx, models.Comment{ID: r.id, PostID: postID, ParentID: &parentID, Author: "A", Content: "Reply", CreatedAt: at(r.minutes)}))
+		}
+
+		page, err := s.GetCommentsByPost(ctx, postID, models.CommentFilter{}, 3, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"root-d", "root-c", "root-b"}, commentIDs(page))
+
+		after, before := at(10), at(40)
+		window := models.CommentFilter{CreatedAfter: &after, CreatedBefore: &before}
+		page, err = s.GetCommentsByPost(ctx, postID, window, 10, 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{"root-b"}, commentIDs(page))
+		count, err := s.CountCommentsByPost(ctx, postID, window)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		replies, err := s.GetCommentReplies(ctx, parentID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"reply-a", "reply-b", "reply-c"}, commentIDs(replies))
+	})
+}
+
+func testSites(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	blog := tenant.WithSite(ctx, "blog")
+	shop := tenant.WithSite(ctx, "shop")
+
+	t.Run("Posts go to the site of the call", func(t *testing.T) {
+		s := newStorage(t)
+
+		bound, err := s.CreatePost(blog, models.Post{SiteID: "shop", Title: "Post", Content: "Content", Author: "Author"})
+		require.NoError(t, err)
+		require.Equal(t, "blog", bound.SiteID)
+
+		unbound, err := s.CreatePost(ctx, models.Post{Title: "Post", Content: "Content", Author: "Author"})
+		require.NoError(t, err)
+		require.Equal(t, tenant.DefaultSite, unbound.SiteID)
+
+		require.NoError(t, s.ImportPost(ctx, models.Post{ID: "imported", SiteID: "shop", Title: "Post", Content: "Content"}))
+		got, err := s.GetPost(shop, "imported")
+		require.NoError(t, err)
+		require.Equal(t, "shop", got.SiteID)
+
+		comment, err := s.CreateComment(blog, models.Comment{PostID: bound.ID, Author: "Commenter", Content: "Comment"})
+		require.NoError(t, err)
+		require.Equal(t, "blog", comment.SiteID)
+	})
+
+	t.Run("Sites are isolated", func(t *testing.T) {
+		s := newStorage(t)
+		blogPost, err := s.CreatePost(blog, models.Post{Title: "Blog", Content: "Content", Author: "Author", CommentsEnabled: true})
+		require.NoError(t, err)
+		shopPost, err := s.CreatePost(shop, models.Post{Title: "Shop", Content: "Content", Author: "Author", CommentsEnabled: true})
+		require.NoError(t, err)
+		root, err := s.CreateComment(blog, models.Comment{PostID: blogPost.ID, Author: "Commenter", Content: "Root"})
+		require.NoError(t, err)
+		_, err = s.CreateComment(blog, models.Comment{PostID: blogPost.ID, ParentID: &root.ID, Author: "Commenter", Content: "Reply"})
+		require.NoError(t, err)
+
+		posts, err := s.GetPosts(shop, models.PostFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{shopPost.ID}, postIDs(posts))
+		author := "Author"
+		posts, err = s.GetPosts(blog, models.PostFilter{Author: &author}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{blogPost.ID}, postIDs(posts))
+		posts, err = s.GetPosts(ctx, models.PostFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{shopPost.ID, blogPost.ID}, postIDs(posts), "calls bound to no site see every site")
+
+		_, err = s.GetPost(shop, blogPost.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		err = s.UpdatePost(shop, blogPost)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		_, err = s.CreateComment(shop, models.Comment{PostID: blogPost.ID, Author: "Commenter", Content: "Comment"})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		err = s.ImportComment(shop, models.Comment{ID: "imported", PostID: blogPost.ID, Author: "Commenter", Content: "Comment"})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		comments, err := s.GetCommentsByPost(shop, blogPost.ID, models.CommentFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Empty(t, comments)
+		count, err := s.CountCommentsByPost(shop, blogPost.ID, models.CommentFilter{})
+		require.NoError(t, err)
+		require.Zero(t, count)
+		replies, err := s.GetCommentReplies(shop, root.ID)
+		require.NoError(t, err)
+		require.Empty(t, replies)
+
+		_, err = s.GetComment(shop, root.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		_, err = s.GetCommentAncestors(shop, root.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		_, err = s.GetCommentSubtree(shop, root.ID, 0)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		_, err = s.IsThreadLocked(shop, root.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+		require.ErrorIs(t, s.LockThread(shop, root.ID), errors.ErrNotFound)
+		require.ErrorIs(t, s.HideComment(shop, root.ID, true), errors.ErrNotFound)
+		_, err = s.DeleteComment(shop, root.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		err = s.WithTx(shop, func(tx storage.Storage) error {
+			_, err := tx.GetPost(shop, blogPost.ID)
+			return err
+		})
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		comments, err = s.GetCommentsByPost(blog, blogPost.ID, models.CommentFilter{}, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{root.ID}, commentIDs(comments))
+		got, err := s.GetComment(blog, root.ID)
+		require.NoError(t, err)
+		require.False(t, got.Locked || got.Hidden)
+		subtree, err := s.GetCommentSubtree(ctx, root.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, subtree, 1)
+	})
+
+	t.Run("Search and Purge Author stay in the site", func(t *testing.T) {
+		s := newStorage(t)
+		blogPost, err := s.CreatePost(blog, models.Post{Title: "Spam", Content: "Spam", Author: "spammer", CommentsEnabled: true})
+		require.NoError(t, err)
+		shopPost, err := s.CreatePost(shop, models.Post{Title: "Spam", Content: "Spam", Author: "spammer", CommentsEnabled: true})
+		require.NoError(t, err)
+		shopComment, err := s.CreateComment(shop, models.Comment{PostID: shopPost.ID, Author: "spammer", Content: "Spam"})
+		require.NoError(t, err)
+
+		hits, err := s.Search(blog, models.SearchQuery{Query: "spam", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{blogPost.ID}, hitIDs(hits))
+		hits, err = s.Search(ctx, models.SearchQuery{Query: "spam", Type: models.SearchTypeAll, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, hits, 3)
+
+		purged, err := s.PurgeAuthor(blog, "spammer")
+		require.NoError(t, err)
+		require.Equal(t, models.PurgeResult{Posts: 1}, purged)
+
+		_, err = s.GetPost(ctx, shopPost.ID)
+		require.NoError(t, err)
+		_, err = s.GetComment(ctx, shopComment.ID)
+		require.NoError(t, err)
+	})
+}
+
+func testIdempotencyKeys(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("Save and Get", func(t *testing.T) {
+		s := newStorage(t)
+
+		err := s.SaveIdempotencyKey(ctx, "key1", "entity1", time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		id, err := s.GetIdempotencyKey(ctx, "key1")
+		require.NoError(t, err)
+		require.Equal(t, "entity1", id)
+	})
+
+	t.Run("Unknown Key", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.GetIdempotencyKey(ctx, "unknown")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+
+	t.Run("Live Key Cannot Be Reused", func(t *testing.T) {
+		s := newStorage(t)
+
+		require.NoError(t, s.SaveIdempotencyKey(ctx, "key1", "entity1", time.Now().Add(time.Hour)))
+
+		err := s.SaveIdempotencyKey(ctx, "key1", "entity2", time.Now().Add(time.Hour))
+		require.ErrorIs(t, err, errors.ErrIdempotencyKeyExists)
+
+		id, err := s.GetIdempotencyKey(ctx, "key1")
+		require.NoError(t, err)
+		require.Equal(t, "entity1", id)
+	})
+
+	t.Run("Expired Key", func(t *testing.T) {
+		s := newStorage(t)
+
+		require.NoError(t, s.SaveIdempotencyKey(ctx, "key1", "entity1", time.Now().Add(-time.Second)))
+
+		_, err := s.GetIdempotencyKey(ctx, "key1")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		require.NoError(t, s.SaveIdempotencyKey(ctx, "key1", "entity2", time.Now().Add(time.Hour)))
+
+		id, err := s.GetIdempotencyKey(ctx, "key1")
+		require.NoError(t, err)
+		require.Equal(t, "entity2", id)
+	})
+
+	t.Run("Rollback Discards Key", func(t *testing.T) {
+		s := newStorage(t)
+
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			if err := tx.SaveIdempotencyKey(ctx, "key1", "entity1", time.Now().Add(time.Hour)); err != nil {
+				return err
+			}
+			return fmt.Errorf("abort")
+		})
+		require.Error(t, err)
+
+		_, err = s.GetIdempotencyKey(ctx, "key1")
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+}
+
+func testTransactions(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	errAbort := fmt.Errorf("abort")
+
+	t.Run("Commit", func(t *testing.T) {
+		s := newStorage(t)
+
+		var post models.Post
+		var comment models.Comment
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			var err error
+			post, err = tx.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author"})
+			if err != nil {
+				return err
+			}
+
+			got, err := tx.GetPost(ctx, post.ID)
+			if err != nil {
+				return err
+			}
+			got.CommentsEnabled = true
+			if err := tx.UpdatePost(ctx, got); err != nil {
+				return err
+			}
+
+			comment, err = tx.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "A", Content: "C"})
+			return err
+		})
+		require.NoError(t, err)
+
+		got, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.True(t, got.CommentsEnabled)
+
+		_, err = s.GetComment(ctx, comment.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		s := newStorage(t)
+		existing := createPost(t, s, true)
+		root := createComment(t, s, existing.ID, nil)
+
+		var post models.Post
+		var reply models.Comment
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			var err error
+			post, err = tx.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author"})
+			if err != nil {
+				return err
+			}
+
+			existing.Title = "Changed"
+			if err := tx.UpdatePost(ctx, existing); err != nil {
+				return err
+			}
+
+			reply, err = tx.CreateComment(ctx, models.Comment{PostID: existing.ID, ParentID: &root.ID, Author: "A", Content: "C"})
+			if err != nil {
+				return err
+			}
+
+			return errAbort
+		})
+		require.ErrorIs(t, err, errAbort)
+
+		_, err = s.GetPost(ctx, post.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		got, err := s.GetPost(ctx, existing.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Post", got.Title)
+		require.Equal(t, 1, got.Version)
+		require.Equal(t, 1, got.CommentCount)
+		require.Equal(t, 1, got.RootCommentCount)
+
+		_, err = s.GetComment(ctx, reply.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+
+		replies, err := s.GetCommentReplies(ctx, root.ID)
+		require.NoError(t, err)
+		require.Empty(t, replies)
+	})
+
+	t.Run("Nested WithTx joins the outer transaction", func(t *testing.T) {
+		s := newStorage(t)
+
+		var post models.Post
+		err := s.WithTx(ctx, func(tx storage.Storage) error {
+			err := tx.WithTx(ctx, func(inner storage.Storage) error {
+				var err error
+				post, err = inner.CreatePost(ctx, models.Post{Title: "Title", Content: "Content", Author: "Author"})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			return errAbort
+		})
+		require.ErrorIs(t, err, errAbort)
+
+		_, err = s.GetPost(ctx, post.ID)
+		require.ErrorIs(t, err, errors.ErrNotFound)
+	})
+}
+
+func testConcurrency(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+	const workers = 20
+
+	t.Run("Concurrent Post creation", func(t *testing.T) {
+		s := newStorage(t)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := s.CreatePost(ctx, models.Post{
+					Title:   fmt.Sprintf("Post %d", i),
+					Content: "Content",
+					Author:  "Author",
+				})
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		posts, err := s.GetPosts(ctx, models.PostFilter{}, workers*2, 0)
+		require.NoError(t, err)
+		require.Len(t, posts, workers)
+	})
+
+	t.Run("Concurrent Comment creation and reads", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		parent := createComment(t, s, post.ID, nil)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers*3)
+		for i := 0; i < workers; i++ {
+			wg.Add(3)
+			go func(i int) {
+				defer wg.Done()
+				_, err := s.CreateComment(ctx, models.Comment{
+					PostID:  post.ID,
+					Author:  fmt.Sprintf("Author %d", i),
+					Content: "Root",
+				})
+				errs <- err
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				_, err := s.CreateComment(ctx, models.Comment{
+					PostID:   post.ID,
+					ParentID: &parent.ID,
+					Author:   fmt.Sprintf("Author %d", i),
+					Content:  "Reply",
+				})
+				errs <- err
+			}(i)
+			go func() {
+				defer wg.Done()
+				if _, err := s.GetCommentsByPost(ctx, post.ID, models.CommentFilter{}, 10, 0); err != nil {
+					errs <- err
+					return
+				}
+				_, err := s.CountCommentsByPost(ctx, post.ID, models.CommentFilter{})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		count, err := s.CountCommentsByPost(ctx, post.ID, models.CommentFilter{})
+		require.NoError(t, err)
+		require.Equal(t, workers+1, count)
+
+		replies, err := s.GetCommentReplies(ctx, parent.ID)
+		require.NoError(t, err)
+		require.Len(t, replies, workers)
+	})
+
+	t.Run("Concurrent writes to different posts", func(t *testing.T) {
+		s := newStorage(t)
+		posts := make([]models.Post, workers)
+		for i := range posts {
+			posts[i] = createPost(t, s, true)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers*2)
+		for i := 0; i < workers; i++ {
+			wg.Add(2)
+			go func(post models.Post) {
+				defer wg.Done()
+				root, err := s.CreateComment(ctx, models.Comment{PostID: post.ID, Author: "Author", Content: "Root"})
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = s.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &root.ID, Author: "Author", Content: "Reply"})
+				errs <- err
+			}(posts[i])
+			go func() {
+				defer wg.Done()
+				if _, err := s.GetPosts(ctx, models.PostFilter{}, workers, 0); err != nil {
+					errs <- err
+					return
+				}
+				_, err := s.Search(ctx, models.SearchQuery{Query: "root", Type: models.SearchTypeAll, Limit: workers})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		for _, post := range posts {
+			got, err := s.GetPost(ctx, post.ID)
+			require.NoError(t, err)
+			require.Equal(t, 2, got.CommentCount)
+			require.Equal(t, 1, got.RootCommentCount)
+		}
+	})
+
+	t.Run("Thread lock waits for a reply in flight", func(t *testing.T) {
+		s := newStorage(t)
+		post := createPost(t, s, true)
+		root := createComment(t, s, post.ID, nil)
+
+		// The reply checks the lock the way CommentService.CreateComment
+		// does, then dawdles before it inserts. A lock taken meanwhile must
+		// wait for it rather than let it slip into a locked thread.
+		checked := make(chan struct{})
+		var once sync.Once
+		replied := make(chan error, 1)
+		go func() {
+			replied <- s.WithTx(ctx, func(tx storage.Storage) error {
+				if _, err := tx.GetPost(ctx, post.ID); err != nil {
+					return err
+				}
+				locked, err := tx.IsThreadLocked(ctx, root.ID)
+				if err != nil {
+					return err
+				}
+				if locked {
+					return errors.ErrThreadLocked
+				}
+				once.Do(func() { close(checked) })
+
+				time.Sleep(50 * time.Millisecond)
+				_, err = tx.CreateComment(ctx, models.Comment{PostID: post.ID, ParentID: &root.ID, Author: "Author", Content: "Reply"})
+				return err
+			})
+		}()
+
+		<-checked
+		require.NoError(t, s.LockThread(ctx, root.ID))
+
+		select {
+		case err := <-replied:
+			require.NoError(t, err)
+		default:
+			t.Fatal("thread locked while a reply to it was being added")
+		}
+	})
+}
+
+func createPost(t *testing.T, s storage.Storage, commentsEnabled bool) models.Post {
+	t.Helper()
+
+	post, err := s.CreatePost(context.Background(), models.Post{
+		Title:           "Post",
+		Content:         "Content",
+		Author:          "Author",
+		CommentsEnabled: commentsEnabled,
+	})
+	require.NoError(t, err)
+	return post
+}
+
+func createComment(t *testing.T, s storage.Storage, postID string, parentID *string) models.Comment {
+	t.Helper()
+
+	comment, err := s.CreateComment(context.Background(), models.Comment{
+		PostID:   postID,
+		ParentID: parentID,
+		Author:   "Commenter",
+		Content:  "Comment",
+	})
+	require.NoError(t, err)
+	return comment
+}
+
+func requirePostEqual(t *testing.T, expected, actual models.Post) {
+	t.Helper()
+
+	require.True(t, expected.CreatedAt.Equal(actual.CreatedAt),
+		"created_at: expected %s, got %s", expected.CreatedAt, actual.CreatedAt)
+	expected.CreatedAt = actual.CreatedAt
+	require.Equal(t, expected, actual)
+}
+
+func requireCommentEqual(t *testing.T, expected, actual models.Comment) {
+	t.Helper()
+
+	require.True(t, expected.CreatedAt.Equal(actual.CreatedAt),
+		"created_at: expected %s, got %s", expected.CreatedAt, actual.CreatedAt)
+	expected.CreatedAt = actual.CreatedAt
+	require.Equal(t, expected, actual)
+}
+
+func postIDs(posts []models.Post) []string {
+	ids := make([]string, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func commentIDs(comments []models.Comment) []string {
+	ids := make([]string, 0, len(comments))
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
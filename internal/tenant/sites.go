@@ -0,0 +1,172 @@
+package tenant
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/pkg/errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Site is a configured site with the comment settings it overrides.
+type Site struct {
+	ID       string
+	Settings models.SiteSettings
+}
+
+// Sites resolves the site of a request from the configured sites.
+type Sites struct {
+	sites       []Site
+	known       map[string]bool
+	byHost      map[string]string
+	byKey       map[string]string
+	moderators  map[string]string // moderator key -> site
+	requireSite bool
+	tokenSecret []byte
+	tokenClaim  string
+}
+
+// New checks the sites of cfg: IDs, hosts and keys must be unique and
+// moderation modes valid. The default site is served even if not listed.
+func New(cfg config.Tenancy) (*Sites, error) {
+	const op = "tenant.New"
+
+	s := &Sites{
+		known:       make(map[string]bool),
+		byHost:      make(map[string]string),
+		byKey:       make(map[string]string),
+		moderators:  make(map[string]string),
+		requireSite: cfg.RequireSite,
+		tokenSecret: []byte(cfg.TokenSecret),
+		tokenClaim:  cfg.TokenClaim,
+	}
+
+	for _, site := range cfg.Sites {
+		if site.ID == "" {
+			return nil, fmt.Errorf("%s: site without id", op)
+		}
+		if s.known[site.ID] {
+			return nil, fmt.Errorf("%s: duplicate site %q", op, site.ID)
+		}
+		s.known[site.ID] = true
+
+		mode := models.ModerationMode(site.Comments.Moderation)
+		if mode != "" && !mode.IsValid() {
+			return nil, fmt.Errorf("%s: site %q: unknown moderation mode %q", op, site.ID, mode)
+		}
+		if site.Comments.MaxLength < -1 {
+			return nil, fmt.Errorf("%s: site %q: max_length below -1", op, site.ID)
+		}
+
+		for _, host := range site.Hosts {
+			host = normalizeHost(host)
+			if other, ok := s.byHost[host]; ok {
+				return nil, fmt.Errorf("%s: host %q of site %q is taken by %q", op, host, site.ID, other)
+			}
+			s.byHost[host] = site.ID
+		}
+		for _, key := range site.APIKeys {
+			if other, ok := s.byKey[key]; ok {
+				return nil, fmt.Errorf("%s: an api key of site %q is taken by %q", op, site.ID, other)
+			}
+			s.byKey[key] = site.ID
+		}
+		for _, key := range site.ModeratorKeys {
+			if other, ok := s.moderators[key]; ok {
+				return nil, fmt.Errorf("%s: a moderator key of site %q is taken by %q", op, site.ID, other)
+			}
+			s.moderators[key] = site.ID
+		}
+
+		s.sites = append(s.sites, Site{
+			ID: site.ID,
+			Settings: models.SiteSettings{
+				MaxCommentLength: site.Comments.MaxLength,
+				Moderation:       mode,
+			},
+		})
+	}
+
+	if !s.known[DefaultSite] {
+		s.known[DefaultSite] = true
+		s.sites = append(s.sites, Site{ID: DefaultSite})
+	}
+
+	return s, nil
+}
+
+// List returns the sites served, the default site included.
+func (s *Sites) List() []Site {
+	return s.sites
+}
+
+// Resolve returns the site of r. An X-API-Key header picks the site it was
+// issued to; otherwise a bearer token names the site in its claim, if a
+// token secret is configured; otherwise the Host header picks the site
+// serving that host. A request matching none of them goes to the default
+// site unless sites are required.
+//
+// Credentials that match no site fail with errors.ErrInvalidCredentials
+// rather than falling through, so a mistyped key never reaches another
+// site.
+func (s *Sites) Resolve(r *http.Request) (string, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		site, ok := s.byKey[key]
+		if !ok {
+			return "", errors.ErrInvalidCredentials
+		}
+		return site, nil
+	}
+
+	if token, ok := bearerToken(r); ok && len(s.tokenSecret) > 0 {
+		site, err := verifyToken(token, s.tokenSecret, s.tokenClaim)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errors.ErrInvalidCredentials, err)
+		}
+		if !s.known[site] {
+			return "", errors.ErrUnknownSite
+		}
+		return site, nil
+	}
+
+	if site, ok := s.byHost[normalizeHost(r.Host)]; ok {
+		return site, nil
+	}
+
+	if s.requireSite {
+		return "", errors.ErrUnknownSite
+	}
+	return DefaultSite, nil
+}
+
+// Moderator reports whether r carries, in the X-Moderator-Key header, a
+// moderator key of site. A key of no site or of another site fails with
+// errors.ErrInvalidCredentials.
+func (s *Sites) Moderator(r *http.Request, site string) (bool, error) {
+	key := r.Header.Get("X-Moderator-Key")
+	if key == "" {
+		return false, nil
+	}
+	if s.moderators[key] != site {
+		return false, errors.ErrInvalidCredentials
+	}
+	return true, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// normalizeHost drops the port and lowercases host.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
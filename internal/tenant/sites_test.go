@@ -0,0 +1,232 @@
+package tenant_test
+
+import (
+	"comments-system/internal/config"
+	"comments-system/internal/models"
+	"comments-system/internal/tenant"
+	"comments-system/pkg/errors"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "token-secret"
+
+func testConfig() config.Tenancy {
+	return config.Tenancy{
+		TokenSecret: secret,
+		TokenClaim:  "site",
+		Sites: []config.Site{
+			{
+				ID:            "blog",
+				Hosts:         []string{"blog.example.com", "Www.Blog.Example.com"},
+				APIKeys:       []string{"blog-key"},
+				ModeratorKeys: []string{"blog-moderator"},
+				Comments:      config.SiteComments{MaxLength: 500, Moderation: "premoderation"},
+			},
+			{ID: "shop", Hosts: []string{"shop.example.com"}, APIKeys: []string{"shop-key"}},
+		},
+	}
+}
+
+// token signs claims with HS256 under key.
+func token(t *testing.T, key string, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSites_Resolve(t *testing.T) {
+	sites, err := tenant.New(testConfig())
+	require.NoError(t, err)
+
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		host    string
+		headers map[string]string
+		want    string
+		wantErr error
+	}{
+		{name: "Host", host: "blog.example.com", want: "blog"},
+		{name: "Host with port and case", host: "WWW.blog.example.com:8080", want: "blog"},
+		{name: "Unknown host", host: "other.example.com", want: tenant.DefaultSite},
+		{name: "API key", host: "blog.example.com", headers: map[string]string{"X-API-Key": "shop-key"}, want: "shop"},
+		{name: "Unknown API key", host: "blog.example.com", headers: map[string]string{"X-API-Key": "nope"}, wantErr: errors.ErrInvalidCredentials},
+		{
+			name:    "Token",
+			host:    "blog.example.com",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, secret, map[string]any{"site": "shop"})},
+			want:    "shop",
+		},
+		{
+			name:    "Token of unknown site",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, secret, map[string]any{"site": "nope"})},
+			wantErr: errors.ErrUnknownSite,
+		},
+		{
+			name:    "Token with bad signature",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, "other-secret", map[string]any{"site": "shop"})},
+			wantErr: errors.ErrInvalidCredentials,
+		},
+		{
+			name:    "Expired token",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, secret, map[string]any{"site": "shop", "exp": expired})},
+			wantErr: errors.ErrInvalidCredentials,
+		},
+		{
+			name:    "Token without claim",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, secret, map[string]any{"sub": "user"})},
+			wantErr: errors.ErrInvalidCredentials,
+		},
+		{name: "Malformed token", headers: map[string]string{"Authorization": "Bearer abc"}, wantErr: errors.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/query", nil)
+			r.Host = tt.host
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			site, err := sites.Resolve(r)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, site)
+		})
+	}
+}
+
+func TestSites_Moderator(t *testing.T) {
+	sites, err := tenant.New(testConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		key     string
+		site    string
+		want    bool
+		wantErr error
+	}{
+		{name: "No key", site: "blog"},
+		{name: "Key of the site", key: "blog-moderator", site: "blog", want: true},
+		{name: "Key of another site", key: "blog-moderator", site: "shop", wantErr: errors.ErrInvalidCredentials},
+		{name: "Unknown key", key: "nope", site: "blog", wantErr: errors.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/query", nil)
+			if tt.key != "" {
+				r.Header.Set("X-Moderator-Key", tt.key)
+			}
+
+			moderator, err := sites.Moderator(r, tt.site)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, moderator)
+		})
+	}
+}
+
+func TestSites_Resolve_TokensWithoutSecret(t *testing.T) {
+	cfg := testConfig()
+	cfg.TokenSecret = ""
+	sites, err := tenant.New(cfg)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/query", nil)
+	r.Host = "shop.example.com"
+	r.Header.Set("Authorization", "Bearer "+token(t, secret, map[string]any{"site": "blog"}))
+
+	site, err := sites.Resolve(r)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", site)
+}
+
+func TestSites_Resolve_RequireSite(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequireSite = true
+	sites, err := tenant.New(cfg)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/query", nil)
+	r.Host = "other.example.com"
+
+	_, err = sites.Resolve(r)
+	require.ErrorIs(t, err, errors.ErrUnknownSite)
+}
+
+func TestNew(t *testing.T) {
+	sites, err := tenant.New(testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, []tenant.Site{
+		{ID: "blog", Settings: models.SiteSettings{MaxCommentLength: 500, Moderation: models.ModerationPremoderation}},
+		{ID: "shop"},
+		{ID: tenant.DefaultSite},
+	}, sites.List())
+
+	invalid := map[string]func(cfg *config.Tenancy){
+		"Duplicate ID":            func(cfg *config.Tenancy) { cfg.Sites[1].ID = "blog" },
+		"Empty ID":                func(cfg *config.Tenancy) { cfg.Sites[1].ID = "" },
+		"Duplicate host":          func(cfg *config.Tenancy) { cfg.Sites[1].Hosts = []string{"BLOG.example.com"} },
+		"Duplicate API key":       func(cfg *config.Tenancy) { cfg.Sites[1].APIKeys = []string{"blog-key"} },
+		"Duplicate moderator key": func(cfg *config.Tenancy) { cfg.Sites[1].ModeratorKeys = []string{"blog-moderator"} },
+		"Unknown moderation":      func(cfg *config.Tenancy) { cfg.Sites[1].Comments.Moderation = "strict" },
+		"max_length below -1":     func(cfg *config.Tenancy) { cfg.Sites[1].Comments.MaxLength = -2 },
+	}
+	for name, change := range invalid {
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig()
+			change(&cfg)
+			_, err := tenant.New(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAssign(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, tenant.DefaultSite, tenant.Assign(ctx, ""))
+	assert.Equal(t, "blog", tenant.Assign(ctx, "blog"))
+
+	ctx = tenant.WithSite(ctx, "shop")
+	assert.Equal(t, "shop", tenant.Assign(ctx, ""))
+	assert.Equal(t, "shop", tenant.Assign(ctx, "blog"))
+	assert.True(t, tenant.Visible(ctx, "shop"))
+	assert.False(t, tenant.Visible(ctx, "blog"))
+	assert.True(t, tenant.Visible(context.Background(), "blog"))
+}
+
+func TestIsModerator(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, tenant.IsModerator(ctx), "calls bound to no site come from maintenance tools")
+
+	ctx = tenant.WithSite(ctx, "blog")
+	assert.False(t, tenant.IsModerator(ctx))
+	assert.True(t, tenant.IsModerator(tenant.WithModerator(ctx)))
+}
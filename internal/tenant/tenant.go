@@ -0,0 +1,61 @@
+// Package tenant keeps the sites served by one deployment apart. Every post
+// belongs to a site and every request is bound to one; storages show a
+// request only the posts of its site and the comments under them.
+package tenant
+
+import "context"
+
+// DefaultSite owns the posts created without a site, including all posts
+// created before sites existed.
+const DefaultSite = "default"
+
+type siteCtx struct{}
+
+// WithSite binds ctx to site id.
+func WithSite(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, siteCtx{}, id)
+}
+
+// SiteFromContext returns the site set by WithSite, or "" when ctx is bound
+// to none. Storages serve such calls, made by maintenance tools, from every
+// site.
+func SiteFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(siteCtx{}).(string)
+	return id
+}
+
+type moderatorCtx struct{}
+
+// WithModerator marks ctx as made by a moderator of its site.
+func WithModerator(ctx context.Context) context.Context {
+	return context.WithValue(ctx, moderatorCtx{}, true)
+}
+
+// IsModerator reports whether ctx may moderate its site: it was marked by
+// WithModerator, or it is bound to no site, as maintenance tools are.
+func IsModerator(ctx context.Context) bool {
+	if SiteFromContext(ctx) == "" {
+		return true
+	}
+	moderator, _ := ctx.Value(moderatorCtx{}).(bool)
+	return moderator
+}
+
+// Assign returns the site a new post goes to: the site of ctx, else site,
+// else DefaultSite. A call bound to a site cannot write to another one.
+func Assign(ctx context.Context, site string) string {
+	if id := SiteFromContext(ctx); id != "" {
+		return id
+	}
+	if site != "" {
+		return site
+	}
+	return DefaultSite
+}
+
+// Visible reports whether an entity of site may be seen by a call made
+// with ctx.
+func Visible(ctx context.Context, site string) bool {
+	id := SiteFromContext(ctx)
+	return id == "" || id == site
+}
@@ -0,0 +1,65 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// verifyToken checks a JWT signed with HS256 under secret and returns its
+// claim. Tokens past their exp claim are refused.
+func verifyToken(token string, secret []byte, claim string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", err
+	}
+	if header.Alg != "HS256" {
+		return "", errors.New("unsupported token algorithm " + header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", errors.New("bad token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", err
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() >= int64(exp) {
+		return "", errors.New("token expired")
+	}
+	site, _ := claims[claim].(string)
+	if site == "" {
+		return "", errors.New("token has no " + claim + " claim")
+	}
+
+	return site, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
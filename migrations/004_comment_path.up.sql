@@ -0,0 +1,23 @@
+-- path is compared bytewise ("C" collation) so that ORDER BY path walks a
+-- thread depth-first and subtree lookups are index range scans.
+ALTER TABLE comments ADD COLUMN path TEXT COLLATE "C";
+ALTER TABLE comments ADD COLUMN depth INTEGER;
+
+WITH RECURSIVE tree AS (
+    SELECT id, id AS path, 0 AS depth
+    FROM comments
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT c.id, t.path || '.' || c.id, t.depth + 1
+    FROM comments c
+    JOIN tree t ON c.parent_id = t.id
+)
+UPDATE comments
+SET path = tree.path, depth = tree.depth
+FROM tree
+WHERE comments.id = tree.id;
+
+ALTER TABLE comments ALTER COLUMN path SET NOT NULL;
+ALTER TABLE comments ALTER COLUMN depth SET NOT NULL;
+
+CREATE INDEX idx_comments_path ON comments(path);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN locked BOOLEAN NOT NULL DEFAULT false;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS comment_search;
+DROP TABLE IF EXISTS post_search;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- Search documents live in their own tables, maintained by the storage, so
+-- the language they are built with follows the configured search_language.
+-- Existing rows are indexed with the default language.
+CREATE TABLE post_search (
+    post_id TEXT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    document TSVECTOR NOT NULL
+);
+
+CREATE TABLE comment_search (
+    comment_id TEXT PRIMARY KEY REFERENCES comments(id) ON DELETE CASCADE,
+    post_id TEXT NOT NULL,
+    document TSVECTOR NOT NULL
+);
+
+INSERT INTO post_search (post_id, document)
+SELECT id, setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', content), 'B')
+FROM posts;
+
+INSERT INTO comment_search (comment_id, post_id, document)
+SELECT id, post_id, to_tsvector('english', content)
+FROM comments;
+
+CREATE INDEX idx_post_search_document ON post_search USING GIN (document);
+CREATE INDEX idx_comment_search_document ON comment_search USING GIN (document);
+CREATE INDEX idx_comment_search_post_id ON comment_search(post_id);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comments_post_author;
+DROP INDEX IF EXISTS idx_comments_post_created_at;
+DROP INDEX IF EXISTS idx_posts_comments_enabled;
+DROP INDEX IF EXISTS idx_posts_author;
+DROP INDEX IF EXISTS idx_posts_created_at;
\ No newline at end of file
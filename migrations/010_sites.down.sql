@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_site_created_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS site_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS site_id;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN site_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE comments ADD COLUMN site_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX idx_posts_site_created_at ON posts(site_id, created_at DESC, id DESC);
\ No newline at end of file
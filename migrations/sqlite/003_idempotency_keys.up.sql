@@ -0,0 +1,8 @@
+-- expires_at holds Unix nanoseconds so expiry checks compare integers.
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    entity_id TEXT NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
\ No newline at end of file
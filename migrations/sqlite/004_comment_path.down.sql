@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_path;
+ALTER TABLE comments DROP COLUMN depth;
+ALTER TABLE comments DROP COLUMN path;
\ No newline at end of file
@@ -0,0 +1,18 @@
+ALTER TABLE comments ADD COLUMN path TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+
+WITH RECURSIVE tree AS (
+    SELECT id, id AS path, 0 AS depth
+    FROM comments
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT c.id, t.path || '.' || c.id, t.depth + 1
+    FROM comments c
+    JOIN tree t ON c.parent_id = t.id
+)
+UPDATE comments
+SET path = tree.path, depth = tree.depth
+FROM tree
+WHERE comments.id = tree.id;
+
+CREATE INDEX idx_comments_path ON comments(path);
\ No newline at end of file
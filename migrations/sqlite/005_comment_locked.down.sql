@@ -0,0 +1 @@
+ALTER TABLE comments DROP COLUMN locked;
\ No newline at end of file
@@ -0,0 +1,27 @@
+-- FTS5 tables mirror posts and comments through triggers. The porter
+-- tokenizer stems English; there is no per-deployment language setting.
+CREATE VIRTUAL TABLE posts_fts USING fts5(post_id UNINDEXED, title, content, tokenize = 'porter unicode61');
+CREATE VIRTUAL TABLE comments_fts USING fts5(comment_id UNINDEXED, post_id UNINDEXED, content, tokenize = 'porter unicode61');
+
+INSERT INTO posts_fts (post_id, title, content) SELECT id, title, content FROM posts;
+INSERT INTO comments_fts (comment_id, post_id, content) SELECT id, post_id, content FROM comments;
+
+CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (post_id, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+    UPDATE posts_fts SET title = new.title, content = new.content WHERE post_id = new.id;
+END;
+
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM posts_fts WHERE post_id = old.id;
+END;
+
+CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+    INSERT INTO comments_fts (comment_id, post_id, content) VALUES (new.id, new.post_id, new.content);
+END;
+
+CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+    DELETE FROM comments_fts WHERE comment_id = old.id;
+END;
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE INDEX idx_posts_created_at ON posts(created_at DESC, id DESC);
+CREATE INDEX idx_posts_author ON posts(author);
+CREATE INDEX idx_posts_comments_enabled ON posts(comments_enabled);
+CREATE INDEX idx_comments_post_created_at ON comments(post_id, created_at DESC, id DESC);
+CREATE INDEX idx_comments_post_author ON comments(post_id, author);
\ No newline at end of file
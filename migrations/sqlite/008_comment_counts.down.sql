@@ -0,0 +1,2 @@
+ALTER TABLE posts DROP COLUMN root_comment_count;
+ALTER TABLE posts DROP COLUMN comment_count;
\ No newline at end of file
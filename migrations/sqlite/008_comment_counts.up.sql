@@ -0,0 +1,12 @@
+ALTER TABLE posts ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN root_comment_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET
+    comment_count = counts.total,
+    root_comment_count = counts.roots
+FROM (
+    SELECT post_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE parent_id IS NULL) AS roots
+    FROM comments
+    GROUP BY post_id
+) AS counts
+WHERE posts.id = counts.post_id;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE comments DROP COLUMN hidden;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_site_created_at;
+ALTER TABLE comments DROP COLUMN site_id;
+ALTER TABLE posts DROP COLUMN site_id;
\ No newline at end of file
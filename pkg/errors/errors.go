@@ -1,9 +1,45 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrNotFound         = errors.New("not found")
-	ErrParentNotFound   = errors.New("parent comment not found")
-	ErrCommentsDisabled = errors.New("comments are disabled")
+	ErrNotFound             = errors.New("not found")
+	ErrAlreadyExists        = errors.New("already exists")
+	ErrParentNotFound       = errors.New("parent comment not found")
+	ErrCommentsDisabled     = errors.New("comments are disabled")
+	ErrConflict             = errors.New("version conflict")
+	ErrIdempotencyKeyExists = errors.New("idempotency key already used")
+	ErrMaxDepthExceeded     = errors.New("maximum reply depth exceeded")
+	ErrThreadLocked         = errors.New("thread is locked")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrInvalidID            = errors.New("invalid ID")
+	ErrUnknownSite          = errors.New("unknown site")
+	ErrInvalidCredentials   = errors.New("invalid site credentials")
+	ErrForbidden            = errors.New("moderator rights required")
+	ErrSessionRequired      = errors.New("session required")
 )
+
+// ConflictError is returned when an update was based on a stale version.
+// It matches ErrConflict with errors.Is and carries the version now stored.
+type ConflictError struct {
+	CurrentVersion int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: current version is %d", ErrConflict, e.CurrentVersion)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
@@ -4,20 +4,41 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultMaxCommentLength is the longest comment accepted, in bytes, unless
+// configured otherwise.
+const DefaultMaxCommentLength = 2000
+
+var lastID atomic.Int64
+
+// GenerateID returns a hex-encoded nanosecond timestamp. Calls landing on the
+// same nanosecond are bumped forward, so IDs are unique and increasing within
+// the process.
 func GenerateID() string {
-	return fmt.Sprintf("%x", time.Now().UnixNano())
+	for {
+		last := lastID.Load()
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if lastID.CompareAndSwap(last, next) {
+			return fmt.Sprintf("%x", next)
+		}
+	}
 }
 
-func ValidateComment(content string) error {
+// ValidateComment checks that content is not blank and is at most
+// maxLength bytes long; a maxLength of 0 or less disables the length check.
+func ValidateComment(content string, maxLength int) error {
 	if strings.TrimSpace(content) == "" {
 		return errors.New("comment cannot be empty")
 	}
 
-	if len(content) > 2000 {
-		return errors.New("comment exceeds 2000 characters limit")
+	if maxLength > 0 && len(content) > maxLength {
+		return fmt.Errorf("comment exceeds %d characters limit", maxLength)
 	}
 
 	return nil